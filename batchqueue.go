@@ -0,0 +1,121 @@
+package monitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/samber/lo"
+	"go.uber.org/zap"
+)
+
+// BatchOptions BatchQueue 的参数。
+// Name: 日志前缀，如 otlp、mqtt-sink。
+// QueueSize: 队列长度，队列满时丢弃新数据。
+// BatchSize/FlushInterval: 每批最多条数与最长聚合时间。
+type BatchOptions struct {
+	Name          string
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+}
+
+// BatchQueue 非阻塞入队、按 BatchSize/FlushInterval 聚合后批量发送的后台队列，供各后端（OTLP、MQTT sink 等）复用。
+type BatchQueue[T any] struct {
+	opts   BatchOptions
+	logger *zap.Logger
+	queue  chan T
+	done   chan struct{}
+	mu     sync.RWMutex
+	closed bool
+}
+
+// NewBatchQueue 创建队列并启动后台聚合协程。
+// opts: 队列参数。
+// logger: 应用日志实例。
+// flush: 发送一批数据，返回错误时记录日志并丢弃该批。
+// 返回值：队列实例。
+func NewBatchQueue[T any](opts BatchOptions, logger *zap.Logger, flush func([]T) error) *BatchQueue[T] {
+	q := &BatchQueue[T]{
+		opts:   opts,
+		logger: logger,
+		queue:  make(chan T, opts.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go q.run(flush)
+	return q
+}
+
+// run 聚合队列中的数据并发送，队列关闭后发送剩余数据再退出。
+func (q *BatchQueue[T]) run(flush func([]T) error) {
+	defer close(q.done)
+	for {
+		items, length, _, ok := lo.BufferWithTimeout(q.queue, q.opts.BatchSize, q.opts.FlushInterval)
+		if length > 0 {
+			if err := flush(items); err != nil {
+				q.logger.Error("["+q.opts.Name+"] flush failed, drop batch", zap.Int("count", length), zap.Error(err))
+			}
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// Push 非阻塞入队，队列满或停机中时丢弃并告警，避免影响业务。
+// source: 数据来源，仅用于日志。
+func (q *BatchQueue[T]) Push(item T, source string) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		q.logger.Warn("["+q.opts.Name+"] queue is stopping, skip", zap.String("source", source))
+		return
+	}
+	select {
+	case q.queue <- item:
+	default:
+		q.logger.Warn("["+q.opts.Name+"] queue is full, drop", zap.String("source", source), zap.Int("capacity", cap(q.queue)))
+	}
+}
+
+// Close 停止接收新数据，后台协程发送完剩余数据后关闭 Done；可重复调用。
+func (q *BatchQueue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.queue)
+}
+
+// Closed 是否已停止接收新数据。
+func (q *BatchQueue[T]) Closed() bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.closed
+}
+
+// Done 剩余数据发送完毕、后台协程退出后关闭。
+func (q *BatchQueue[T]) Done() <-chan struct{} {
+	return q.done
+}
+
+// Len 队列中尚未发送的数据条数。
+func (q *BatchQueue[T]) Len() int {
+	return len(q.queue)
+}
+
+// WaitDone 等待所有 done 关闭，用于停机时等待各队列排空。
+// timeout: 最长等待时间。
+// 返回值：超时返回 false。
+func WaitDone(timeout time.Duration, done ...<-chan struct{}) bool {
+	deadline := time.After(timeout)
+	for _, ch := range done {
+		select {
+		case <-ch:
+		case <-deadline:
+			return false
+		}
+	}
+	return true
+}
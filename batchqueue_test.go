@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestBatchQueue(t *testing.T) {
+	var mu sync.Mutex
+	batches := [][]int{}
+	q := NewBatchQueue(BatchOptions{Name: "test", QueueSize: 3, BatchSize: 2, FlushInterval: time.Hour}, zap.NewNop(), func(items []int) error {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, items)
+		return errors.New("dropped batches are only logged")
+	})
+
+	// 达到 BatchSize 立即发送，剩余数据在关闭时发送。
+	q.Push(1, "test")
+	q.Push(2, "test")
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(batches) == 1
+	}, time.Second, 5*time.Millisecond)
+	q.Push(3, "test")
+	assert.False(t, q.Closed())
+
+	q.Close()
+	q.Close()
+	assert.True(t, q.Closed())
+	assert.True(t, WaitDone(time.Second, q.Done()))
+	q.Push(4, "test")
+	assert.Equal(t, [][]int{{1, 2}, {3}}, batches)
+}
+
+func TestBatchQueueDropsWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	q := NewBatchQueue(BatchOptions{Name: "test", QueueSize: 1, BatchSize: 1, FlushInterval: time.Hour}, zap.NewNop(), func([]int) error {
+		<-release
+		return nil
+	})
+	q.Push(1, "test")
+	assert.Eventually(t, func() bool { return q.Len() == 0 }, time.Second, 5*time.Millisecond)
+	q.Push(2, "test")
+	q.Push(3, "test")
+	assert.Equal(t, 1, q.Len())
+
+	q.Close()
+	assert.False(t, WaitDone(10*time.Millisecond, q.Done()))
+	close(release)
+	assert.True(t, WaitDone(time.Second, q.Done()))
+}
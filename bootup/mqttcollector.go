@@ -0,0 +1,9 @@
+//go:build monitor_mqttcollector
+
+package bootup
+
+import "github.com/techquest-tech/monitor/mqtt"
+
+func init() {
+	mqtt.EnableMqttCollector()
+}
@@ -0,0 +1,9 @@
+//go:build monitor_mqttsink
+
+package bootup
+
+import "github.com/techquest-tech/monitor/mqtt"
+
+func init() {
+	mqtt.EnableMqttSink()
+}
@@ -0,0 +1,9 @@
+//go:build monitor_otlp
+
+package bootup
+
+import "github.com/techquest-tech/monitor/otlp"
+
+func init() {
+	otlp.EnableOTLPExporter()
+}
@@ -0,0 +1,123 @@
+package monitor
+
+import (
+	"bytes"
+	"hash"
+	"io"
+)
+
+const (
+	// DefaultMaxCaptureBytes 请求/响应默认最大采集字节数。
+	DefaultMaxCaptureBytes = 1 << 20
+)
+
+// resolveCaptureLimit 解析采集上限：0 使用默认值，负数表示不限制。
+func resolveCaptureLimit(limit int) int {
+	if limit == 0 {
+		return DefaultMaxCaptureBytes
+	}
+	if limit < 0 {
+		return 0
+	}
+	return limit
+}
+
+// captureBuffer 只保留前 limit 字节，同时统计实际流经的总字节数。
+// limit 为 0 时不限制；discard 为 true 时不保留内容，仅统计大小与哈希。
+type captureBuffer struct {
+	buf     bytes.Buffer
+	limit   int
+	size    int64
+	discard bool
+	hash    hash.Hash
+	partial bool
+}
+
+func newCaptureBuffer(limit int) *captureBuffer {
+	return &captureBuffer{limit: limit}
+}
+
+func (c *captureBuffer) Write(p []byte) (int, error) {
+	c.size += int64(len(p))
+	if c.hash != nil {
+		c.hash.Write(p)
+	}
+	if c.discard {
+		return len(p), nil
+	}
+	if c.limit <= 0 {
+		c.buf.Write(p)
+		return len(p), nil
+	}
+	if remain := c.limit - c.buf.Len(); remain > 0 {
+		if len(p) > remain {
+			c.buf.Write(p[:remain])
+		} else {
+			c.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (c *captureBuffer) Bytes() []byte {
+	return c.buf.Bytes()
+}
+
+// Size 返回流经的总字节数。
+func (c *captureBuffer) Size() int64 {
+	return c.size
+}
+
+// Truncated 判断是否有数据因超出上限或未补读而未被保留。
+func (c *captureBuffer) Truncated() bool {
+	return c.partial || (!c.discard && c.limit > 0 && c.size > int64(c.limit))
+}
+
+// remaining 返回还可以保留的字节数；不限制时返回 -1。
+func (c *captureBuffer) remaining() int64 {
+	if c.limit <= 0 {
+		return -1
+	}
+	return int64(c.limit - c.buf.Len())
+}
+
+// teeReadCloser 在业务读取请求体时旁路复制到 captureBuffer，不会预先读取整个请求体。
+type teeReadCloser struct {
+	io.ReadCloser
+	capture *captureBuffer
+	eof     bool
+}
+
+func (t *teeReadCloser) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.capture.Write(p[:n])
+	}
+	if err == io.EOF {
+		t.eof = true
+	}
+	return n, err
+}
+
+// fill 在业务处理完成后补读尚未消费的请求体，最多读到采集上限为止。
+func (t *teeReadCloser) fill() {
+	if t.eof {
+		return
+	}
+	// 仅统计摘要时不补读，避免为计算哈希而读完业务未消费的大文件。
+	if t.capture.discard {
+		t.capture.partial = true
+		return
+	}
+	remain := t.capture.remaining()
+	if remain < 0 {
+		// 不限制采集时最多补读 DefaultMaxCaptureBytes，避免业务未读取的大文件上传被整体读完。
+		_, _ = io.CopyN(io.Discard, t, DefaultMaxCaptureBytes)
+		if !t.eof {
+			t.capture.partial = true
+		}
+		return
+	}
+	// 多读 1 个字节用于判断是否被截断。
+	_, _ = io.CopyN(io.Discard, t, remain+1)
+}
@@ -0,0 +1,128 @@
+package monitor
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeeReadCloserKeepsLimit(t *testing.T) {
+	payload := strings.Repeat("a", 100)
+	tee := &teeReadCloser{
+		ReadCloser: io.NopCloser(strings.NewReader(payload)),
+		capture:    newCaptureBuffer(10),
+	}
+
+	read, err := io.ReadAll(tee)
+	assert.NoError(t, err)
+	assert.Equal(t, payload, string(read))
+	assert.Equal(t, strings.Repeat("a", 10), string(tee.capture.Bytes()))
+	assert.Equal(t, int64(100), tee.capture.Size())
+	assert.True(t, tee.capture.Truncated())
+}
+
+func TestTeeReadCloserFill(t *testing.T) {
+	tee := &teeReadCloser{
+		ReadCloser: io.NopCloser(strings.NewReader("0123456789abcdef")),
+		capture:    newCaptureBuffer(8),
+	}
+	tee.fill()
+	assert.Equal(t, "01234567", string(tee.capture.Bytes()))
+	assert.True(t, tee.capture.Truncated())
+
+	small := &teeReadCloser{
+		ReadCloser: io.NopCloser(strings.NewReader("0123")),
+		capture:    newCaptureBuffer(8),
+	}
+	small.fill()
+	assert.Equal(t, "0123", string(small.capture.Bytes()))
+	assert.False(t, small.capture.Truncated())
+	// 不限制采集时补读也有上限，业务未读取的大文件不会被整体读完。
+	payload := strings.NewReader(strings.Repeat("a", DefaultMaxCaptureBytes+100))
+	unlimited := &teeReadCloser{
+		ReadCloser: io.NopCloser(payload),
+		capture:    newCaptureBuffer(0),
+	}
+	unlimited.fill()
+	assert.Equal(t, int64(DefaultMaxCaptureBytes), unlimited.capture.Size())
+	assert.Equal(t, 100, payload.Len())
+	assert.True(t, unlimited.capture.Truncated())
+}
+
+func TestResolveCaptureLimit(t *testing.T) {
+	assert.Equal(t, DefaultMaxCaptureBytes, resolveCaptureLimit(0))
+	assert.Equal(t, 0, resolveCaptureLimit(-1))
+	assert.Equal(t, 512, resolveCaptureLimit(512))
+}
+
+func TestCaptureModeFor(t *testing.T) {
+	var sr *TracingRequestService
+	assert.Equal(t, CaptureModeFull, sr.CaptureModeFor("application/json; charset=utf-8"))
+	assert.Equal(t, CaptureModeFull, sr.CaptureModeFor("application/problem+json"))
+	assert.Equal(t, CaptureModeFull, sr.CaptureModeFor(""))
+	assert.Equal(t, CaptureModeMeta, sr.CaptureModeFor("multipart/form-data; boundary=x"))
+	assert.Equal(t, CaptureModeDigest, sr.CaptureModeFor("image/png"))
+	assert.Equal(t, CaptureModeDigest, sr.CaptureModeFor("application/octet-stream"))
+
+	sr = &TracingRequestService{CapturePolicies: []CapturePolicy{{ContentTypes: []string{"image/*"}, Mode: "skip"}}}
+	assert.Equal(t, CaptureModeSkip, sr.CaptureModeFor("image/jpeg"))
+	assert.Equal(t, CaptureModeDigest, sr.CaptureModeFor("video/mp4"))
+}
+
+func TestSummarizeCapture(t *testing.T) {
+	sum := sha256.Sum256([]byte("png-bytes"))
+	digest := summarizePayload(CaptureModeDigest, "image/png", []byte("png-bytes"))
+	assert.JSONEq(t, fmt.Sprintf(`{"policy":"digest","contentType":"image/png","size":9,"sha256":"%x"}`, sum), string(digest))
+
+	body := "--b\r\nContent-Disposition: form-data; name=\"title\"\r\n\r\nhello\r\n" +
+		"--b\r\nContent-Disposition: form-data; name=\"file\"; filename=\"a.png\"\r\nContent-Type: image/png\r\n\r\n0123456789\r\n--b--\r\n"
+	meta := summarizePayload(CaptureModeMeta, "multipart/form-data; boundary=b", []byte(body))
+	assert.JSONEq(t, fmt.Sprintf(`{"policy":"meta","contentType":"multipart/form-data; boundary=b","size":%d,`+
+		`"fields":[{"name":"title","size":5}],"files":[{"field":"file","filename":"a.png","contentType":"image/png","size":10}]}`, len(body)), string(meta))
+
+	assert.Nil(t, summarizePayload(CaptureModeSkip, "video/mp4", []byte("data")))
+}
+
+func TestTracingRespBody(t *testing.T) {
+	calls := 0
+	var got *captureBuffer
+	body := &tracingRespBody{
+		teeReadCloser: teeReadCloser{
+			ReadCloser: io.NopCloser(strings.NewReader("0123456789abcdef")),
+			capture:    newCaptureBuffer(8),
+		},
+		done: func(capture *captureBuffer) {
+			calls++
+			got = capture
+		},
+	}
+	read, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef", string(read))
+	assert.NoError(t, body.Close())
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "01234567", string(got.Bytes()))
+	assert.Equal(t, int64(16), got.Size())
+	assert.True(t, got.Truncated())
+
+	// 摘要模式只计算哈希，调用方提前关闭时标记为截断且不输出哈希。
+	digest := &tracingRespBody{
+		teeReadCloser: teeReadCloser{
+			ReadCloser: io.NopCloser(strings.NewReader("png-bytes")),
+			capture:    newPolicyCapture(CaptureModeDigest, 8),
+		},
+		done: func(capture *captureBuffer) { got = capture },
+	}
+	buf := make([]byte, 3)
+	_, err = digest.Read(buf)
+	assert.NoError(t, err)
+	assert.NoError(t, digest.Close())
+	assert.Empty(t, got.Bytes())
+	assert.True(t, got.Truncated())
+	assert.JSONEq(t, `{"policy":"digest","contentType":"image/png","size":3,"truncated":true}`,
+		string(summarizeCapture(CaptureModeDigest, "image/png", got, nil)))
+}
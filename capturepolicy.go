@@ -0,0 +1,243 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"path"
+	"strings"
+)
+
+const (
+	// CaptureModeFull 完整采集正文。
+	CaptureModeFull = "full"
+	// CaptureModeMeta 仅记录 multipart 的字段名、文件名与大小。
+	CaptureModeMeta = "meta"
+	// CaptureModeDigest 仅记录长度与 sha256。
+	CaptureModeDigest = "digest"
+	// CaptureModeSkip 不采集正文。
+	CaptureModeSkip = "skip"
+)
+
+// CapturePolicy 按 Content-Type 指定采集方式，ContentTypes 支持 image/*、application/*+json 等通配。
+type CapturePolicy struct {
+	ContentTypes []string
+	Mode         string
+}
+
+var defaultCapturePolicies = []CapturePolicy{
+	{
+		ContentTypes: []string{
+			"application/json", "application/*+json",
+			"application/xml", "application/*+xml",
+			"application/x-www-form-urlencoded",
+			"application/javascript", "application/grpc-web-text",
+			"text/*",
+		},
+		Mode: CaptureModeFull,
+	},
+	{
+		ContentTypes: []string{"multipart/form-data", "multipart/mixed"},
+		Mode:         CaptureModeMeta,
+	},
+	{
+		ContentTypes: []string{
+			"application/octet-stream", "application/pdf",
+			"application/zip", "application/gzip", "application/x-gzip", "application/x-tar",
+			"application/vnd.ms-excel", "application/vnd.openxmlformats-officedocument.*",
+			"application/protobuf", "application/x-protobuf",
+			"image/*", "audio/*", "video/*", "font/*",
+		},
+		Mode: CaptureModeDigest,
+	},
+}
+
+func normalizeCaptureMode(mode string) string {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case CaptureModeMeta:
+		return CaptureModeMeta
+	case CaptureModeDigest:
+		return CaptureModeDigest
+	case CaptureModeSkip:
+		return CaptureModeSkip
+	default:
+		return CaptureModeFull
+	}
+}
+
+func matchCapturePolicies(policies []CapturePolicy, mediaType string) (string, bool) {
+	for _, policy := range policies {
+		for _, pattern := range policy.ContentTypes {
+			pattern = strings.ToLower(strings.TrimSpace(pattern))
+			if pattern == mediaType {
+				return normalizeCaptureMode(policy.Mode), true
+			}
+			if matched, _ := path.Match(pattern, mediaType); matched {
+				return normalizeCaptureMode(policy.Mode), true
+			}
+		}
+	}
+	return "", false
+}
+
+// CaptureModeFor 返回指定 Content-Type 的采集方式；自定义策略优先，未命中时完整采集。
+// contentType: 请求或响应的 Content-Type 头部。
+// 返回值：full/meta/digest/skip 之一。
+func (tr *TracingRequestService) CaptureModeFor(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	if mediaType == "" {
+		return CaptureModeFull
+	}
+	if tr != nil {
+		if mode, ok := matchCapturePolicies(tr.CapturePolicies, mediaType); ok {
+			return mode
+		}
+	}
+	if mode, ok := matchCapturePolicies(defaultCapturePolicies, mediaType); ok {
+		return mode
+	}
+	return CaptureModeFull
+}
+
+// newPolicyCapture 按采集方式创建 captureBuffer：digest 只计算哈希不保留内容，skip 只统计大小。
+func newPolicyCapture(mode string, limit int) *captureBuffer {
+	capture := newCaptureBuffer(limit)
+	switch mode {
+	case CaptureModeDigest:
+		capture.discard = true
+		capture.hash = sha256.New()
+	case CaptureModeSkip:
+		capture.discard = true
+	}
+	return capture
+}
+
+type multipartFieldSummary struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+type multipartFileSummary struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int64  `json:"size"`
+}
+
+type payloadSummary struct {
+	Policy      string                  `json:"policy"`
+	ContentType string                  `json:"contentType,omitempty"`
+	Size        int64                   `json:"size"`
+	Sha256      string                  `json:"sha256,omitempty"`
+	Fields      []multipartFieldSummary `json:"fields,omitempty"`
+	Files       []multipartFileSummary  `json:"files,omitempty"`
+	Truncated   bool                    `json:"truncated,omitempty"`
+}
+
+// summarizeCapture 将非完整采集的正文转换为摘要 JSON。
+// mode: 采集方式。
+// contentType: 原始 Content-Type。
+// capture: 采集缓冲。
+// form: 业务已解析的 multipart 表单，可为 nil，此时从已采集字节中解析。
+// 返回值：摘要 JSON；skip 模式返回 nil。
+func summarizeCapture(mode string, contentType string, capture *captureBuffer, form *multipart.Form) []byte {
+	summary := payloadSummary{
+		Policy:      mode,
+		ContentType: contentType,
+		Size:        capture.Size(),
+	}
+	switch mode {
+	case CaptureModeSkip:
+		return nil
+	case CaptureModeDigest:
+		summary.Truncated = capture.partial
+		if capture.hash != nil && !capture.partial {
+			summary.Sha256 = hex.EncodeToString(capture.hash.Sum(nil))
+		}
+	case CaptureModeMeta:
+		if form != nil {
+			summary.Fields, summary.Files = describeMultipartForm(form)
+		} else {
+			summary.Fields, summary.Files, summary.Truncated = describeMultipartBytes(contentType, capture.Bytes())
+			summary.Truncated = summary.Truncated || capture.Truncated()
+		}
+	default:
+		return capture.Bytes()
+	}
+	b, _ := json.Marshal(summary)
+	return b
+}
+
+// summarizePayload 对已完整读取的正文应用采集策略，用于对外请求的 RoundTripper。
+func summarizePayload(mode string, contentType string, payload []byte) []byte {
+	if mode == CaptureModeFull {
+		return payload
+	}
+	capture := newPolicyCapture(mode, 0)
+	capture.Write(payload)
+	return summarizeCapture(mode, contentType, capture, nil)
+}
+
+func describeMultipartForm(form *multipart.Form) ([]multipartFieldSummary, []multipartFileSummary) {
+	fields := make([]multipartFieldSummary, 0, len(form.Value))
+	for name, values := range form.Value {
+		var size int64
+		for _, v := range values {
+			size += int64(len(v))
+		}
+		fields = append(fields, multipartFieldSummary{Name: name, Size: size})
+	}
+	files := make([]multipartFileSummary, 0, len(form.File))
+	for field, headers := range form.File {
+		for _, fh := range headers {
+			files = append(files, multipartFileSummary{
+				Field:       field,
+				Filename:    fh.Filename,
+				ContentType: fh.Header.Get("Content-Type"),
+				Size:        fh.Size,
+			})
+		}
+	}
+	return fields, files
+}
+
+// describeMultipartBytes 从已采集的字节中尽量解析 multipart 结构，截断时返回已解析部分。
+func describeMultipartBytes(contentType string, payload []byte) ([]multipartFieldSummary, []multipartFileSummary, bool) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		return nil, nil, true
+	}
+	reader := multipart.NewReader(bytes.NewReader(payload), params["boundary"])
+	var fields []multipartFieldSummary
+	var files []multipartFileSummary
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return fields, files, false
+		}
+		if err != nil {
+			return fields, files, true
+		}
+		size, copyErr := io.Copy(io.Discard, part)
+		if part.FileName() != "" {
+			files = append(files, multipartFileSummary{
+				Field:       part.FormName(),
+				Filename:    part.FileName(),
+				ContentType: part.Header.Get("Content-Type"),
+				Size:        size,
+			})
+		} else {
+			fields = append(fields, multipartFieldSummary{Name: part.FormName(), Size: size})
+		}
+		if copyErr != nil {
+			return fields, files, true
+		}
+	}
+}
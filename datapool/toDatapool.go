@@ -105,8 +105,13 @@ func Enabled2Datapool() {
 		scheError.Filter = func(msg []any) []any {
 			return lo.Map(msg, func(item any, index int) any {
 				raw := item.(core.ErrorReport)
+				// 部分上报（如 mqtt collector 转发的空错误信息）不带 Error。
+				message := ""
+				if raw.Error != nil {
+					message = raw.Error.Error()
+				}
 				return ErrorReport4Parquet{
-					Error:     raw.Error.Error(),
+					Error:     message,
 					FullStack: raw.FullStack,
 					Uri:       raw.Uri,
 					HappendAT: raw.HappendAT,
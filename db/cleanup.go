@@ -12,45 +12,37 @@ import (
 
 func init() {
 	core.ProvideStartup(func(logger *zap.Logger, db *gorm.DB) core.Startup {
-		settings := viper.Sub("tracing.db.cleanup")
-		scheduleStr := ""
-		if settings != nil {
-			scheduleStr = settings.GetString("schedule")
+		conf := defaultCleanupConfig()
+		if err := viper.UnmarshalKey("tracing.db.cleanup", &conf); err != nil {
+			logger.Error("db cleanup config error", zap.Error(err))
+			return nil
 		}
-		if scheduleStr == "" {
-			scheduleStr = "11 2 * * 0"
+		if conf.Schedule == "" {
+			conf.Schedule = defaultCleanupConfig().Schedule
 		}
-
-		err := schedule.CreateSchedule("monitor_db_cleanup", scheduleStr, func() {
-			now := time.Now()
-
-			cutoff0to10 := now.AddDate(0, -6, 0)
-			cutoff10to50 := now.AddDate(0, 0, -14)
-			cutoff50plus := now.AddDate(0, 0, -3)
-
-			result := db.Unscoped().
-				Where("created_at <= ? AND verbosity_level <= ?", cutoff0to10, 10).
-				Delete(&FullRequestDetails{})
-			if result.Error != nil {
-				logger.Error("delete data failed", zap.Error(result.Error), zap.Int("minLevel", 0), zap.Int("maxLevel", 10))
-				return
-			}
-
-			result = db.Unscoped().
-				Where("created_at <= ? AND verbosity_level > ? AND verbosity_level <= ?", cutoff10to50, 10, 50).
-				Delete(&FullRequestDetails{})
-			if result.Error != nil {
-				logger.Error("delete data failed", zap.Error(result.Error), zap.Int("minLevel", 11), zap.Int("maxLevel", 50))
-				return
+		if conf.BatchSize <= 0 {
+			conf.BatchSize = defaultCleanupConfig().BatchSize
+		}
+		if len(conf.Rules) == 0 {
+			conf.Rules = DefaultRetentionRules()
+		}
+		for i, rule := range conf.Rules {
+			if _, _, err := rule.condition(); err != nil {
+				logger.Error("invalid retention rule", zap.Int("index", i), zap.String("rule", rule.Name), zap.Error(err))
 			}
+		}
 
-			result = db.Unscoped().
-				Where("created_at <= ? AND verbosity_level > ?", cutoff50plus, 50).
-				Delete(&FullRequestDetails{})
-			if result.Error != nil {
-				logger.Error("delete data failed", zap.Error(result.Error), zap.Int("minLevel", 51))
-				return
-			}
+		cleaner := &retentionCleaner{db: db, logger: logger, conf: conf}
+		logger.Info("monitor db cleanup enabled",
+			zap.String("schedule", conf.Schedule),
+			zap.Bool("dryRun", conf.DryRun),
+			zap.Int("batchSize", conf.BatchSize),
+			zap.Duration("batchPause", conf.BatchPause),
+			zap.Int("rules", len(conf.Rules)),
+		)
+
+		err := schedule.CreateSchedule("monitor_db_cleanup", conf.Schedule, func() {
+			cleaner.run(time.Now())
 		})
 		if err != nil {
 			logger.Error("schedule db cleanup job failed", zap.Error(err))
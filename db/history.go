@@ -0,0 +1,68 @@
+package db
+
+import (
+	"time"
+
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+	"gorm.io/gorm"
+)
+
+// JobHistoryDetails 定时任务执行记录。
+type JobHistoryDetails struct {
+	gorm.Model
+	App        string `gorm:"size:64"`
+	AppVersion string `gorm:"size:64"`
+	Job        string `gorm:"size:128;index"`
+	Succeed    bool
+	Duration   time.Duration
+}
+
+// ErrorReportDetails 错误上报记录，error 以字符串 ErrorText 持久化。
+type ErrorReportDetails struct {
+	gorm.Model
+	AppName    string `gorm:"size:64"`
+	AppVersion string `gorm:"size:64"`
+	Uri        string `gorm:"size:256"`
+	ErrorText  string `gorm:"type:text"`
+	FullStack  string `gorm:"type:longtext"`
+	StackEnc   string `gorm:"size:16"`
+	HappendAT  time.Time
+}
+
+func (tr *TracingRequestServiceDBImpl) buildJobModel(req schedule.JobHistory) (*JobHistoryDetails, bool) {
+	return &JobHistoryDetails{
+		App:        req.App,
+		AppVersion: req.AppVersion,
+		Job:        req.Job,
+		Succeed:    req.Succeed,
+		Duration:   req.Duration,
+	}, true
+}
+
+func (tr *TracingRequestServiceDBImpl) buildErrorModel(rr core.ErrorReport) (*ErrorReportDetails, bool) {
+	errText := ""
+	if rr.Error != nil {
+		errText = rr.Error.Error()
+	}
+	stackText, stackEnc := monitor.EncodePayloadForText(rr.FullStack)
+	happened := rr.HappendAT
+	if happened.IsZero() {
+		happened = time.Now()
+	}
+	// 大部分上报点不填写应用信息，缺省记为当前应用。
+	appName, appVersion := rr.AppName, rr.AppVersion
+	if appName == "" {
+		appName, appVersion = core.AppName, core.Version
+	}
+	return &ErrorReportDetails{
+		AppName:    appName,
+		AppVersion: appVersion,
+		Uri:        rr.Uri,
+		ErrorText:  errText,
+		FullStack:  stackText,
+		StackEnc:   stackEnc,
+		HappendAT:  happened,
+	}, true
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func TestBuildErrorModel(t *testing.T) {
+	tr := &TracingRequestServiceDBImpl{}
+	happened := time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)
+
+	model, keep := tr.buildErrorModel(core.ErrorReport{
+		Error:     errors.New("boom"),
+		Uri:       "/api/orders",
+		FullStack: []byte("goroutine 1 [running]"),
+		HappendAT: happened,
+	})
+	assert.True(t, keep)
+	assert.Equal(t, core.AppName, model.AppName)
+	assert.Equal(t, core.Version, model.AppVersion)
+	assert.Equal(t, "boom", model.ErrorText)
+	assert.Equal(t, "goroutine 1 [running]", model.FullStack)
+	assert.Equal(t, happened, model.HappendAT)
+
+	// 调用方填写的应用信息优先；二进制堆栈按编码保存，时间缺省为当前时间。
+	model, _ = tr.buildErrorModel(core.ErrorReport{AppName: "edge", AppVersion: "1.2.0", FullStack: []byte{0xff, 0x00}})
+	assert.Equal(t, "edge", model.AppName)
+	assert.Equal(t, "1.2.0", model.AppVersion)
+	assert.Empty(t, model.ErrorText)
+	assert.NotEmpty(t, model.StackEnc)
+	assert.WithinDuration(t, time.Now(), model.HappendAT, time.Second)
+}
+
+func TestErrorModelPersistedColumns(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+
+	model, _ := (&TracingRequestServiceDBImpl{}).buildErrorModel(core.ErrorReport{
+		Error:     errors.New("boom"),
+		Uri:       "/api/orders",
+		FullStack: []byte("stack"),
+	})
+	stmt := db.Create(model).Statement
+	sql := stmt.SQL.String()
+	for _, column := range []string{"`app_name`", "`app_version`", "`uri`", "`error_text`", "`full_stack`", "`stack_enc`", "`happend_at`"} {
+		assert.Contains(t, sql, column)
+	}
+	assert.Contains(t, stmt.Vars, "boom")
+	assert.Contains(t, stmt.Vars, "/api/orders")
+	assert.Contains(t, stmt.Vars, "stack")
+	assert.Contains(t, stmt.Vars, core.AppName)
+}
@@ -0,0 +1,419 @@
+package db
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	HeaderQueryToken = "X-Monitor-Token"
+)
+
+// TraceQueryConfig 查询接口配置，对应 tracing.db.api。
+// Traced: 为 true 时查询接口自身的请求也记录 tracing，缺省不记录。
+type TraceQueryConfig struct {
+	Enabled     bool
+	BasePath    string
+	Tokens      []string
+	MaxPageSize int
+	Traced      bool
+}
+
+// TraceQueryService 基于 FullRequestDetails 的只读查询接口。
+type TraceQueryService struct {
+	DB      *gorm.DB
+	Logger  *zap.Logger
+	Config  TraceQueryConfig
+	Tracing *monitor.TracingRequestService
+}
+
+// TraceSummary 列表接口返回的记录，不包含正文。
+type TraceSummary struct {
+	ID             uint                          `json:"id"`
+	StartedAt      time.Time                     `json:"startedAt"`
+	Optionname     string                        `json:"optionname"`
+	Uri            string                        `json:"uri"`
+	Method         string                        `json:"method"`
+	Status         int                           `json:"status"`
+	DurationMs     float64                       `json:"durationMs"`
+	VerbosityLevel monitor.TracingVerbosityLevel `json:"verbosityLevel"`
+	AppName        string                        `json:"app"`
+	AppVersion     string                        `json:"version"`
+	Tenant         string                        `json:"tenant"`
+	Operator       string                        `json:"operator"`
+	ClientIP       string                        `json:"clientIp"`
+	Device         string                        `json:"device"`
+	TraceID        string                        `json:"traceId"`
+	SpanID         string                        `json:"spanId"`
+}
+
+// TraceDetail 详情接口返回的记录，正文按编码还原。
+type TraceDetail struct {
+	TraceSummary
+	ParentSpanID string  `json:"parentSpanId"`
+	UserAgent    string  `json:"userAgent"`
+	TargetID     uint    `json:"targetId"`
+	SampleRate   float64 `json:"sampleRate"`
+	SampledBy    string  `json:"sampledBy"`
+	Body         any     `json:"body"`
+	BodyEnc      string  `json:"bodyEnc"`
+	Resp         any     `json:"resp"`
+	RespEnc      string  `json:"respEnc"`
+}
+
+// TracePage 分页结果。
+type TracePage struct {
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+	Items    []TraceSummary `json:"items"`
+}
+
+// traceSortFields 允许排序的字段，key 为接口参数，value 为列名。
+var traceSortFields = map[string]string{
+	"id":        "id",
+	"startedAt": "started_at",
+	"duration":  "durtion",
+	"status":    "status",
+}
+
+// traceQuery 解析后的查询条件。
+type traceQuery struct {
+	From        time.Time
+	To          time.Time
+	Tenant      string
+	Operator    string
+	Optionname  string
+	Method      string
+	ClientIP    string
+	Device      string
+	TraceID     string
+	StatusMin   int
+	StatusMax   int
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	Page        int
+	PageSize    int
+	Order       string
+}
+
+// parseStatus 支持精确状态码（404）与状态分类（5xx）。
+func parseStatus(value string) (int, int, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if strings.HasSuffix(value, "xx") {
+		lower, upper, err := parseStatusClass(value)
+		return lower, upper - 1, err
+	}
+	code, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid status %q", value)
+	}
+	return code, code, nil
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use RFC3339 or unix milliseconds", value)
+}
+
+// parseTraceQuery 解析查询参数。
+// c: 当前请求上下文。
+// maxPageSize: 单页最大条数。
+// 返回值：查询条件；参数非法时返回错误。
+func parseTraceQuery(c *gin.Context, maxPageSize int) (*traceQuery, error) {
+	q := &traceQuery{
+		Tenant:     c.Query("tenant"),
+		Operator:   c.Query("operator"),
+		Optionname: c.Query("optionname"),
+		Method:     strings.ToUpper(c.Query("method")),
+		ClientIP:   c.Query("clientIp"),
+		Device:     c.Query("device"),
+		TraceID:    strings.ToLower(c.Query("traceId")),
+		Page:       1,
+		PageSize:   20,
+		Order:      "started_at DESC, id DESC",
+	}
+	var err error
+	if v := c.Query("from"); v != "" {
+		if q.From, err = parseQueryTime(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if q.To, err = parseQueryTime(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := c.Query("status"); v != "" {
+		if q.StatusMin, q.StatusMax, err = parseStatus(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := c.Query("minDuration"); v != "" {
+		if q.MinDuration, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid minDuration %q", v)
+		}
+	}
+	if v := c.Query("maxDuration"); v != "" {
+		if q.MaxDuration, err = time.ParseDuration(v); err != nil {
+			return nil, fmt.Errorf("invalid maxDuration %q", v)
+		}
+	}
+	if v := c.Query("page"); v != "" {
+		if q.Page, err = strconv.Atoi(v); err != nil || q.Page < 1 {
+			return nil, fmt.Errorf("invalid page %q", v)
+		}
+	}
+	if v := c.Query("pageSize"); v != "" {
+		if q.PageSize, err = strconv.Atoi(v); err != nil || q.PageSize < 1 {
+			return nil, fmt.Errorf("invalid pageSize %q", v)
+		}
+	}
+	if maxPageSize > 0 && q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+	if v := c.Query("sort"); v != "" {
+		direction := "ASC"
+		field := v
+		if strings.HasPrefix(v, "-") {
+			direction = "DESC"
+			field = v[1:]
+		}
+		column, ok := traceSortFields[field]
+		if !ok {
+			return nil, fmt.Errorf("invalid sort field %q", field)
+		}
+		q.Order = column + " " + direction
+		if column != "id" {
+			q.Order += ", id " + direction
+		}
+	}
+	return q, nil
+}
+
+// apply 将查询条件应用到 GORM 查询，Optionname 按前缀匹配。
+func (q *traceQuery) apply(tx *gorm.DB) *gorm.DB {
+	if !q.From.IsZero() {
+		tx = tx.Where("started_at >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		tx = tx.Where("started_at < ?", q.To)
+	}
+	if q.Tenant != "" {
+		tx = tx.Where("tenant = ?", q.Tenant)
+	}
+	if q.Operator != "" {
+		tx = tx.Where("operator = ?", q.Operator)
+	}
+	if q.Optionname != "" {
+		tx = tx.Where("optionname LIKE ? ESCAPE ?", escapeLike(q.Optionname)+"%", `\`)
+	}
+	if q.Method != "" {
+		tx = tx.Where("method = ?", q.Method)
+	}
+	if q.ClientIP != "" {
+		tx = tx.Where("client_ip = ?", q.ClientIP)
+	}
+	if q.Device != "" {
+		tx = tx.Where("device = ?", q.Device)
+	}
+	if q.TraceID != "" {
+		tx = tx.Where("trace_id = ?", q.TraceID)
+	}
+	if q.StatusMin > 0 {
+		tx = tx.Where("status >= ? AND status <= ?", q.StatusMin, q.StatusMax)
+	}
+	if q.MinDuration > 0 {
+		tx = tx.Where("durtion >= ?", int64(q.MinDuration))
+	}
+	if q.MaxDuration > 0 {
+		tx = tx.Where("durtion <= ?", int64(q.MaxDuration))
+	}
+	return tx
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func toSummary(m FullRequestDetails) TraceSummary {
+	return TraceSummary{
+		ID:             m.ID,
+		StartedAt:      m.StartedAt,
+		Optionname:     m.Optionname,
+		Uri:            m.Uri,
+		Method:         m.Method,
+		Status:         m.Status,
+		DurationMs:     float64(m.Durtion) / float64(time.Millisecond),
+		VerbosityLevel: m.VerbosityLevel,
+		AppName:        m.AppName,
+		AppVersion:     m.AppVersion,
+		Tenant:         m.Tenant,
+		Operator:       m.Operator,
+		ClientIP:       m.ClientIP,
+		Device:         m.Device,
+		TraceID:        m.TraceID,
+		SpanID:         m.SpanID,
+	}
+}
+
+// decodeStoredPayload 按 enc 还原正文：JSON 原样嵌入，文本返回字符串，二进制保留 base64。
+// 返回值：正文与最终编码方式。
+func decodeStoredPayload(text string, enc string) (any, string) {
+	raw, err := monitor.DecodePayloadText(text, enc)
+	if err != nil {
+		return text, enc
+	}
+	if len(raw) == 0 {
+		return nil, monitor.PayloadEncodingEmpty
+	}
+	if json.Valid(raw) {
+		return json.RawMessage(raw), "json"
+	}
+	if utf8.Valid(raw) {
+		return string(raw), monitor.PayloadEncodingUTF8
+	}
+	return text, enc
+}
+
+func toDetail(m FullRequestDetails) TraceDetail {
+	detail := TraceDetail{
+		TraceSummary: toSummary(m),
+		ParentSpanID: m.ParentSpanID,
+		UserAgent:    m.UserAgent,
+		TargetID:     m.TargetID,
+		SampleRate:   m.SampleRate,
+		SampledBy:    m.SampledBy,
+	}
+	detail.Body, detail.BodyEnc = decodeStoredPayload(m.BodyText, m.BodyEnc)
+	detail.Resp, detail.RespEnc = decodeStoredPayload(m.RespText, m.RespEnc)
+	return detail
+}
+
+func (s *TraceQueryService) Priority() int { return 10 }
+
+// OnEngineInited 注册查询接口；未启用或未配置 Tokens 时不注册。
+func (s *TraceQueryService) OnEngineInited(r *gin.Engine) error {
+	if !s.Config.Enabled {
+		return nil
+	}
+	if len(s.Config.Tokens) == 0 {
+		s.Logger.Warn("trace query api enabled but no tokens configured, skipped")
+		return nil
+	}
+	group := r.Group(s.Config.BasePath, s.authenticate)
+	group.GET("", s.Search)
+	group.GET("/:id", s.Detail)
+	if !s.Config.Traced && s.Tracing != nil {
+		// 查询结果包含大量正文，记录查询请求会使明细表自我膨胀。
+		s.Tracing.Excluded = append(s.Tracing.Excluded, s.Config.BasePath, s.Config.BasePath+"/:id")
+	}
+	s.Logger.Info("trace query api ready", zap.String("basePath", s.Config.BasePath))
+	return nil
+}
+
+// authenticate 校验 Authorization: Bearer <token> 或 X-Monitor-Token。
+func (s *TraceQueryService) authenticate(c *gin.Context) {
+	token := c.GetHeader(HeaderQueryToken)
+	if auth := c.GetHeader("Authorization"); token == "" && strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if token != "" {
+		for _, allowed := range s.Config.Tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(allowed)) == 1 {
+				c.Next()
+				return
+			}
+		}
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+}
+
+// Search 按条件分页查询请求明细。
+func (s *TraceQueryService) Search(c *gin.Context) {
+	q, err := parseTraceQuery(c, s.Config.MaxPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page := TracePage{Page: q.Page, PageSize: q.PageSize, Items: []TraceSummary{}}
+	tx := q.apply(s.DB.WithContext(c.Request.Context()).Model(&FullRequestDetails{}))
+	if err := tx.Count(&page.Total).Error; err != nil {
+		s.Logger.Error("count traces failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+
+	models := []FullRequestDetails{}
+	err = q.apply(s.DB.WithContext(c.Request.Context())).
+		Omit("body", "body_text", "resp", "resp_text").
+		Order(q.Order).
+		Offset((q.Page - 1) * q.PageSize).
+		Limit(q.PageSize).
+		Find(&models).Error
+	if err != nil {
+		s.Logger.Error("query traces failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	for _, m := range models {
+		page.Items = append(page.Items, toSummary(m))
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// Detail 返回单条请求明细，包含还原后的请求体与响应体。
+func (s *TraceQueryService) Detail(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	model := FullRequestDetails{}
+	err = s.DB.WithContext(c.Request.Context()).First(&model, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not found"})
+		return
+	}
+	if err != nil {
+		s.Logger.Error("query trace detail failed", zap.Error(err), zap.Uint64("id", id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "query failed"})
+		return
+	}
+	c.JSON(http.StatusOK, toDetail(model))
+}
+
+// NewTraceQueryService 从 tracing.db.api 读取配置创建查询接口组件。
+func NewTraceQueryService(dbm *TracingRequestServiceDBImpl, sr *monitor.TracingRequestService, logger *zap.Logger) *TraceQueryService {
+	conf := TraceQueryConfig{
+		BasePath:    "/monitor/traces",
+		MaxPageSize: 200,
+	}
+	if err := viper.UnmarshalKey("tracing.db.api", &conf); err != nil {
+		logger.Error("trace query api config error", zap.Error(err))
+		conf.Enabled = false
+	}
+	if conf.BasePath == "" {
+		conf.BasePath = "/monitor/traces"
+	}
+	return &TraceQueryService{DB: dbm.DB, Logger: logger, Config: conf, Tracing: sr}
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+func newQueryContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/monitor/traces?"+query, nil)
+	return c
+}
+
+func TestParseTraceQuery(t *testing.T) {
+	c := newQueryContext("from=2024-05-01T00:00:00Z&to=1714608000000&tenant=t1&status=5xx&method=post&minDuration=500ms&page=3&pageSize=500&sort=-duration")
+	q, err := parseTraceQuery(c, 200)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), q.From)
+	assert.Equal(t, time.UnixMilli(1714608000000), q.To)
+	assert.Equal(t, "t1", q.Tenant)
+	assert.Equal(t, "POST", q.Method)
+	assert.Equal(t, 500, q.StatusMin)
+	assert.Equal(t, 599, q.StatusMax)
+	assert.Equal(t, 500*time.Millisecond, q.MinDuration)
+	assert.Equal(t, 3, q.Page)
+	assert.Equal(t, 200, q.PageSize)
+	assert.Equal(t, "durtion DESC, id DESC", q.Order)
+
+	q, err = parseTraceQuery(newQueryContext("status=404"), 200)
+	assert.NoError(t, err)
+	assert.Equal(t, 404, q.StatusMin)
+	assert.Equal(t, 404, q.StatusMax)
+	assert.Equal(t, "started_at DESC, id DESC", q.Order)
+
+	for _, query := range []string{"sort=body", "from=yesterday", "page=0", "status=abc", "maxDuration=10"} {
+		_, err = parseTraceQuery(newQueryContext(query), 200)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestTraceQueryAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &TraceQueryService{
+		Logger: zap.NewNop(),
+		Config: TraceQueryConfig{Enabled: true, BasePath: "/monitor/traces", Tokens: []string{"secret"}},
+	}
+	r := gin.New()
+	r.Use(s.authenticate)
+	r.GET("/monitor/traces", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	cases := map[string]int{"": http.StatusUnauthorized, "Bearer wrong": http.StatusUnauthorized, "Bearer secret": http.StatusOK}
+	for auth, status := range cases {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/monitor/traces", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		r.ServeHTTP(w, req)
+		assert.Equal(t, status, w.Code, auth)
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/monitor/traces", nil)
+	req.Header.Set(HeaderQueryToken, "secret")
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestToDetailDecodesPayload(t *testing.T) {
+	binary := []byte{0xff, 0xfe, 0x00}
+	detail := toDetail(FullRequestDetails{
+		BodyText: `{"a":1}`,
+		BodyEnc:  "utf8",
+		RespText: base64.StdEncoding.EncodeToString(binary),
+		RespEnc:  "base64",
+	})
+	b, err := json.Marshal(detail)
+	assert.NoError(t, err)
+	out := map[string]any{}
+	assert.NoError(t, json.Unmarshal(b, &out))
+	assert.Equal(t, map[string]any{"a": float64(1)}, out["body"])
+	assert.Equal(t, "json", out["bodyEnc"])
+	assert.Equal(t, base64.StdEncoding.EncodeToString(binary), out["resp"])
+	assert.Equal(t, "base64", out["respEnc"])
+
+	detail = toDetail(FullRequestDetails{RespText: base64.StdEncoding.EncodeToString([]byte("plain")), RespEnc: "base64"})
+	assert.Equal(t, "plain", detail.Resp)
+	assert.Nil(t, detail.Body)
+}
+
+func TestTraceQueryApplyEscapesLike(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+
+	q := &traceQuery{Optionname: `/api/100%_off\`, Operator: "u1"}
+	stmt := q.apply(db.Model(&FullRequestDetails{})).Find(&[]FullRequestDetails{}).Statement
+	assert.Contains(t, stmt.SQL.String(), "optionname LIKE ? ESCAPE ?")
+	assert.Contains(t, stmt.Vars, `/api/100\%\_off\\%`)
+	assert.Contains(t, stmt.Vars, `\`)
+}
+
+func TestTraceQueryExcludedFromTracing(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sr := &monitor.TracingRequestService{Excluded: []string{"/healthz"}}
+	s := &TraceQueryService{
+		Logger:  zap.NewNop(),
+		Config:  TraceQueryConfig{Enabled: true, BasePath: "/monitor/traces", Tokens: []string{"secret"}},
+		Tracing: sr,
+	}
+	assert.NoError(t, s.OnEngineInited(gin.New()))
+	assert.Equal(t, []string{"/healthz", "/monitor/traces", "/monitor/traces/:id"}, sr.Excluded)
+	assert.False(t, sr.ShouldLogReq(context.Background(), "/monitor/traces/:id"))
+
+	traced := &monitor.TracingRequestService{}
+	s.Tracing = traced
+	s.Config.Traced = true
+	assert.NoError(t, s.OnEngineInited(gin.New()))
+	assert.Empty(t, traced.Excluded)
+}
@@ -0,0 +1,229 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// RetentionRule 请求明细的保留规则，所有条件均为空时匹配全部记录。
+// MinLevel/MaxLevel 为 verbosity_level 闭区间，MaxLevel 为 nil 时不设上限。
+// StatusClasses 形如 2xx/4xx/5xx；Tenants/Apps 为精确匹配。
+// 规则按顺序生效：已被前面规则匹配的记录，不会再被后面的规则删除。
+type RetentionRule struct {
+	Name          string
+	MinLevel      int
+	MaxLevel      *int
+	StatusClasses []string
+	Tenants       []string
+	Apps          []string
+	RetentionDays int
+}
+
+// CleanupConfig 清理任务配置，对应 tracing.db.cleanup。
+type CleanupConfig struct {
+	Schedule           string
+	DryRun             bool
+	BatchSize          int
+	BatchPause         time.Duration
+	Rules              []RetentionRule
+	JobRetentionDays   int
+	ErrorRetentionDays int
+}
+
+func intPtr(v int) *int {
+	return &v
+}
+
+// DefaultRetentionRules 与早期版本一致：0-10 保留 6 个月，11-50 保留 14 天，50 以上保留 3 天。
+func DefaultRetentionRules() []RetentionRule {
+	return []RetentionRule{
+		{Name: "important", MinLevel: 0, MaxLevel: intPtr(10), RetentionDays: 180},
+		{Name: "write", MinLevel: 11, MaxLevel: intPtr(50), RetentionDays: 14},
+		{Name: "read", MinLevel: 51, RetentionDays: 3},
+	}
+}
+
+func defaultCleanupConfig() CleanupConfig {
+	return CleanupConfig{
+		Schedule:           "11 2 * * 0",
+		BatchSize:          1000,
+		BatchPause:         200 * time.Millisecond,
+		JobRetentionDays:   30,
+		ErrorRetentionDays: 90,
+	}
+}
+
+// parseStatusClass 将 5xx 或 5 解析为 [500, 600)。
+func parseStatusClass(class string) (int, int, error) {
+	class = strings.ToLower(strings.TrimSpace(class))
+	class = strings.TrimSuffix(class, "xx")
+	n, err := strconv.Atoi(class)
+	if err != nil || n < 1 || n > 5 {
+		return 0, 0, fmt.Errorf("invalid status class %q", class)
+	}
+	return n * 100, (n + 1) * 100, nil
+}
+
+// condition 生成规则的 SQL 条件（不含时间条件）。
+// 返回值：条件语句与参数；条件为空时返回 "1 = 1"。
+func (r RetentionRule) condition() (string, []any, error) {
+	parts := []string{}
+	args := []any{}
+	if r.MinLevel > 0 {
+		parts = append(parts, "verbosity_level >= ?")
+		args = append(args, r.MinLevel)
+	}
+	if r.MaxLevel != nil {
+		parts = append(parts, "verbosity_level <= ?")
+		args = append(args, *r.MaxLevel)
+	}
+	if len(r.StatusClasses) > 0 {
+		classes := make([]string, 0, len(r.StatusClasses))
+		for _, class := range r.StatusClasses {
+			lower, upper, err := parseStatusClass(class)
+			if err != nil {
+				return "", nil, err
+			}
+			classes = append(classes, "(status >= ? AND status < ?)")
+			args = append(args, lower, upper)
+		}
+		parts = append(parts, "("+strings.Join(classes, " OR ")+")")
+	}
+	if len(r.Tenants) > 0 {
+		parts = append(parts, "tenant IN ?")
+		args = append(args, r.Tenants)
+	}
+	if len(r.Apps) > 0 {
+		parts = append(parts, "app_name IN ?")
+		args = append(args, r.Apps)
+	}
+	if len(parts) == 0 {
+		return "1 = 1", args, nil
+	}
+	return strings.Join(parts, " AND "), args, nil
+}
+
+// ruleQuery 生成第 index 条规则实际删除范围：命中本规则、未命中之前任何规则且早于保留期限。
+func ruleQuery(rules []RetentionRule, index int, now time.Time) (string, []any, error) {
+	rule := rules[index]
+	cond, args, err := rule.condition()
+	if err != nil {
+		return "", nil, err
+	}
+	query := "created_at <= ? AND (" + cond + ")"
+	args = append([]any{now.AddDate(0, 0, -rule.RetentionDays)}, args...)
+	for _, prev := range rules[:index] {
+		prevCond, prevArgs, err := prev.condition()
+		if err != nil {
+			return "", nil, err
+		}
+		query += " AND NOT (" + prevCond + ")"
+		args = append(args, prevArgs...)
+	}
+	return query, args, nil
+}
+
+// retentionCleaner 按规则分批删除过期数据。
+type retentionCleaner struct {
+	db     *gorm.DB
+	logger *zap.Logger
+	conf   CleanupConfig
+}
+
+// purge 分批删除满足条件的记录，每批之间暂停 BatchPause，避免长时间锁表。
+// model: GORM 实体。
+// name: 规则名称，仅用于日志。
+// query/args: 删除条件。
+// 返回值：删除（dry-run 时为将要删除）的行数。
+func (c *retentionCleaner) purge(model any, name string, query string, args []any) (int64, error) {
+	if c.conf.DryRun {
+		var count int64
+		err := c.db.Unscoped().Model(model).Where(query, args...).Count(&count).Error
+		if err == nil {
+			c.logger.Info("[dry-run] cleanup would delete rows",
+				zap.String("rule", name),
+				zap.String("table", fmt.Sprintf("%T", model)),
+				zap.Int64("rows", count),
+			)
+		}
+		return count, err
+	}
+
+	var total int64
+	for {
+		ids := []uint{}
+		err := c.db.Unscoped().Model(model).Where(query, args...).
+			Order("id").Limit(c.conf.BatchSize).Pluck("id", &ids).Error
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			return total, nil
+		}
+		result := c.db.Unscoped().Where("id IN ?", ids).Delete(model)
+		if result.Error != nil {
+			return total, result.Error
+		}
+		total += result.RowsAffected
+		if len(ids) < c.conf.BatchSize {
+			return total, nil
+		}
+		if c.conf.BatchPause > 0 {
+			time.Sleep(c.conf.BatchPause)
+		}
+	}
+}
+
+// run 依次执行请求明细规则，以及任务记录与错误上报的保留期限。
+func (c *retentionCleaner) run(now time.Time) {
+	started := time.Now()
+	var total int64
+	for i, rule := range c.conf.Rules {
+		if rule.RetentionDays <= 0 {
+			continue
+		}
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i+1)
+		}
+		query, args, err := ruleQuery(c.conf.Rules, i, now)
+		if err != nil {
+			c.logger.Error("invalid retention rule, skipped", zap.String("rule", name), zap.Error(err))
+			continue
+		}
+		rows, err := c.purge(&FullRequestDetails{}, name, query, args)
+		total += rows
+		if err != nil {
+			c.logger.Error("delete data failed", zap.String("rule", name), zap.Int64("rows", rows), zap.Error(err))
+			continue
+		}
+		c.logger.Info("cleanup rule done", zap.String("rule", name), zap.Int("retentionDays", rule.RetentionDays), zap.Int64("rows", rows))
+	}
+
+	// 保留天数 <= 0 表示不清理。
+	if c.conf.JobRetentionDays > 0 {
+		rows, err := c.purge(&JobHistoryDetails{}, "job", "created_at <= ?", []any{now.AddDate(0, 0, -c.conf.JobRetentionDays)})
+		total += rows
+		if err != nil {
+			c.logger.Error("delete job history failed", zap.Int("retentionDays", c.conf.JobRetentionDays), zap.Error(err))
+		}
+	}
+	if c.conf.ErrorRetentionDays > 0 {
+		rows, err := c.purge(&ErrorReportDetails{}, "error", "created_at <= ?", []any{now.AddDate(0, 0, -c.conf.ErrorRetentionDays)})
+		total += rows
+		if err != nil {
+			c.logger.Error("delete error reports failed", zap.Int("retentionDays", c.conf.ErrorRetentionDays), zap.Error(err))
+		}
+	}
+
+	c.logger.Info("monitor db cleanup finished",
+		zap.Bool("dryRun", c.conf.DryRun),
+		zap.Int64("rows", total),
+		zap.Duration("elapsed", time.Since(started)),
+	)
+}
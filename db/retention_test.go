@@ -0,0 +1,49 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionRuleCondition(t *testing.T) {
+	rule := RetentionRule{
+		MinLevel:      11,
+		MaxLevel:      intPtr(50),
+		StatusClasses: []string{"4xx", "5"},
+		Tenants:       []string{"t1"},
+		Apps:          []string{"app"},
+	}
+	cond, args, err := rule.condition()
+	assert.NoError(t, err)
+	assert.Equal(t, "verbosity_level >= ? AND verbosity_level <= ? AND ((status >= ? AND status < ?) OR (status >= ? AND status < ?)) AND tenant IN ? AND app_name IN ?", cond)
+	assert.Equal(t, []any{11, 50, 400, 500, 500, 600, []string{"t1"}, []string{"app"}}, args)
+
+	cond, args, err = RetentionRule{}.condition()
+	assert.NoError(t, err)
+	assert.Equal(t, "1 = 1", cond)
+	assert.Empty(t, args)
+
+	_, _, err = RetentionRule{StatusClasses: []string{"9xx"}}.condition()
+	assert.Error(t, err)
+}
+
+func TestRuleQueryExcludesEarlierRules(t *testing.T) {
+	now := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	rules := []RetentionRule{
+		{Name: "vip", Tenants: []string{"vip"}, RetentionDays: 365},
+		{Name: "errors", StatusClasses: []string{"5xx"}, RetentionDays: 30},
+		{Name: "rest", RetentionDays: 3},
+	}
+
+	query, args, err := ruleQuery(rules, 2, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "created_at <= ? AND (1 = 1) AND NOT (tenant IN ?) AND NOT (((status >= ? AND status < ?)))", query)
+	assert.Equal(t, []any{now.AddDate(0, 0, -3), []string{"vip"}, 500, 600}, args)
+
+	query, args, err = ruleQuery(rules, 0, now)
+	assert.NoError(t, err)
+	assert.Equal(t, "created_at <= ? AND (tenant IN ?)", query)
+	assert.Equal(t, []any{now.AddDate(0, 0, -365), []string{"vip"}}, args)
+}
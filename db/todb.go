@@ -6,7 +6,9 @@ import (
 	"github.com/samber/lo"
 	"github.com/spf13/viper"
 	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/ginshared"
 	"github.com/techquest-tech/gin-shared/pkg/orm"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
 	"github.com/techquest-tech/monitor"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -14,11 +16,11 @@ import (
 
 type FullRequestDetails struct {
 	gorm.Model
-	Optionname     string                        `gorm:"size:256"`
+	Optionname     string                        `gorm:"size:256;index:idx_frd_option_started,priority:1"`
 	AppName        string                        `gorm:"size:64"`
 	AppVersion     string                        `gorm:"size:64"`
-	Operator       string                        `gorm:"size:64"`
-	Tenant         string                        `gorm:"size:64"`
+	Operator       string                        `gorm:"size:64;index:idx_frd_operator_started,priority:1"`
+	Tenant         string                        `gorm:"size:64;index:idx_frd_tenant_started,priority:1"`
 	Uri            string                        `gorm:"size:256"`
 	Method         string                        `gorm:"size:16"`
 	VerbosityLevel monitor.TracingVerbosityLevel `gorm:"default:99"`
@@ -26,14 +28,20 @@ type FullRequestDetails struct {
 	BodyText       string `gorm:"type:longtext"`
 	BodyEnc        string `gorm:"size:16"`
 	Durtion        time.Duration
-	Status         int
+	Status         int `gorm:"index"`
 	TargetID       uint
 	Resp           []byte
 	RespText       string `gorm:"type:longtext"`
 	RespEnc        string `gorm:"size:16"`
-	ClientIP       string `gorm:"size:64"`
+	ClientIP       string `gorm:"size:64;index:idx_frd_client_ip_started,priority:1"`
 	UserAgent      string `gorm:"size:256"`
-	Device         string `gorm:"size:64"`
+	Device         string `gorm:"size:64;index:idx_frd_device_started,priority:1"`
+	TraceID        string `gorm:"size:32;index"`
+	SpanID         string `gorm:"size:16"`
+	ParentSpanID   string `gorm:"size:16"`
+	SampleRate     float64
+	SampledBy      string    `gorm:"size:16"`
+	StartedAt      time.Time `gorm:"index;index:idx_frd_tenant_started,priority:2;index:idx_frd_option_started,priority:2;index:idx_frd_operator_started,priority:2;index:idx_frd_client_ip_started,priority:2;index:idx_frd_device_started,priority:2"`
 }
 
 type TracingRequestServiceDBImpl struct {
@@ -97,11 +105,24 @@ func (tr *TracingRequestServiceDBImpl) buildRequestModel(req monitor.TracingDeta
 		ClientIP:       req.ClientIP,
 		UserAgent:      req.UserAgent,
 		Device:         req.Device,
+		TraceID:        req.TraceID,
+		SpanID:         req.SpanID,
+		ParentSpanID:   req.ParentSpanID,
+		SampleRate:     req.SampleRate,
+		SampledBy:      req.SampledBy,
+		StartedAt:      req.StartedAt,
 	}
 	return model, true
 }
 
-func (tr *TracingRequestServiceDBImpl) startBatchWriter(ch chan monitor.TracingDetails) {
+// batchSettings 批量写入配置，tracing/任务/错误共用 tracing.db.batch。
+type batchSettings struct {
+	size          int
+	flushInterval time.Duration
+	queueSize     int
+}
+
+func loadBatchSettings() batchSettings {
 	batchSize := 100
 	if viper.IsSet("tracing.db.batch.size") {
 		batchSize = viper.GetInt("tracing.db.batch.size")
@@ -133,13 +154,24 @@ func (tr *TracingRequestServiceDBImpl) startBatchWriter(ch chan monitor.TracingD
 	if queueSize <= 0 {
 		queueSize = 10000
 	}
+	return batchSettings{size: batchSize, flushInterval: flushInterval, queueSize: queueSize}
+}
 
-	queue := make(chan monitor.TracingDetails, queueSize)
-
-	tr.Logger.Info("db tracing batch writer enabled",
-		zap.Int("batchSize", batchSize),
-		zap.Duration("flushInterval", flushInterval),
-		zap.Int("queueSize", queueSize),
+// startBatchWriter 消费订阅通道，按 tracing.db.batch 配置批量入库。
+// tr: DB 服务。
+// source: 数据来源，仅用于日志。
+// ch: 订阅得到的通道。
+// build: 将事件转换为 GORM 实体，返回 false 表示忽略。
+// 返回值：无。
+func startBatchWriter[T any, M any](tr *TracingRequestServiceDBImpl, source string, ch chan T, build func(T) (*M, bool)) {
+	settings := loadBatchSettings()
+	queue := make(chan T, settings.queueSize)
+
+	tr.Logger.Info("db batch writer enabled",
+		zap.String("source", source),
+		zap.Int("batchSize", settings.size),
+		zap.Duration("flushInterval", settings.flushInterval),
+		zap.Int("queueSize", settings.queueSize),
 	)
 
 	go func() {
@@ -151,14 +183,14 @@ func (tr *TracingRequestServiceDBImpl) startBatchWriter(ch chan monitor.TracingD
 
 	go func() {
 		for {
-			items, length, _, ok := lo.BufferWithTimeout(queue, batchSize, flushInterval)
+			items, length, _, ok := lo.BufferWithTimeout(queue, settings.size, settings.flushInterval)
 			if length == 0 && ok {
 				continue
 			}
 
-			models := make([]FullRequestDetails, 0, length)
+			models := make([]M, 0, length)
 			for _, item := range items {
-				model, keep := tr.buildRequestModel(item)
+				model, keep := build(item)
 				if !keep {
 					continue
 				}
@@ -166,11 +198,11 @@ func (tr *TracingRequestServiceDBImpl) startBatchWriter(ch chan monitor.TracingD
 			}
 
 			if len(models) > 0 {
-				err := tr.DB.CreateInBatches(models, batchSize).Error
+				err := tr.DB.CreateInBatches(models, settings.size).Error
 				if err != nil {
-					tr.Logger.Error("batch insert request details failed", zap.Error(err), zap.Int("count", len(models)))
+					tr.Logger.Error("batch insert failed", zap.String("source", source), zap.Error(err), zap.Int("count", len(models)))
 				} else {
-					tr.Logger.Info("batch insert request details done", zap.Int("count", len(models)))
+					tr.Logger.Info("batch insert done", zap.String("source", source), zap.Int("count", len(models)))
 				}
 			}
 
@@ -197,13 +229,23 @@ func (tr *TracingRequestServiceDBImpl) startBatchWriter(ch chan monitor.TracingD
 
 func EnableDBMonitor() {
 	orm.AppendEntity(&FullRequestDetails{})
+	orm.AppendEntity(&JobHistoryDetails{})
+	orm.AppendEntity(&ErrorReportDetails{})
 	core.Provide(NewTracingRequestService)
 	core.ProvideStartup(func(dbm *TracingRequestServiceDBImpl) core.Startup {
-		ch := monitor.TracingAdaptor.Sub("db")
-		if ch != nil {
-			dbm.startBatchWriter(ch)
+		if ch := monitor.TracingAdaptor.Sub("db"); ch != nil {
+			startBatchWriter(dbm, "tracing", ch, dbm.buildRequestModel)
+		}
+		if ch := schedule.JobHistoryAdaptor.Sub("db"); ch != nil {
+			startBatchWriter(dbm, "schedule", ch, dbm.buildJobModel)
+		}
+		if ch := core.ErrorAdaptor.Sub("db"); ch != nil {
+			startBatchWriter(dbm, "error", ch, dbm.buildErrorModel)
 		}
 		return nil
 	})
+	ginshared.Provide(func(dbm *TracingRequestServiceDBImpl, sr *monitor.TracingRequestService, logger *zap.Logger) ginshared.Component {
+		return NewTraceQueryService(dbm, sr, logger)
+	}, ginshared.ComponentsOptions)
 	// enableDBCleanup()
 }
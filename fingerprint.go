@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// fingerprintFrames 参与指纹计算的调用栈帧数。
+const fingerprintFrames = 5
+
+var (
+	// fingerprintVolatile 错误信息中随请求变化的片段：uuid、十六进制 id/地址、4 位及以上的独立数字。
+	// 3 位以内的数字（HTTP/gRPC 状态码等）与 oauth2、sha256 这类标识符中的数字保持原样。
+	fingerprintVolatile = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|\b0x[0-9a-fA-F]+\b|\b[0-9a-fA-F]{16,}\b|\b\d{4,}\b`)
+	// frameArgs 栈帧函数名后的参数列表，如 main.handler(0xc000123, 0x10)。
+	frameArgs = regexp.MustCompile(`\([^()]*\)$`)
+)
+
+// ErrorFingerprint 计算错误指纹，用于在各后端中对同类错误计数与分组。
+// 错误信息中的长数字、uuid、十六进制 id 等易变内容会被归一化，调用栈只取函数名（忽略行号、地址与运行时/恐慌处理帧）。
+// message: 错误信息。
+// stack: 调用栈文本，可为空或任意文本（如下游响应体），非 Go 调用栈时只使用错误信息。
+// 返回值：16 位十六进制指纹；message 与 stack 均为空时返回空字符串。
+func ErrorFingerprint(message string, stack []byte) string {
+	normalized := strings.TrimSpace(fingerprintVolatile.ReplaceAllString(message, "#"))
+	frames := stackFunctions(stack, fingerprintFrames)
+	if normalized == "" && len(frames) == 0 {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(normalized + "\n" + strings.Join(frames, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// stackFunctions 从 Go 调用栈（runtime/debug.Stack 格式）中提取前 limit 个业务函数名。
+func stackFunctions(stack []byte, limit int) []string {
+	if len(stack) == 0 || !bytes.HasPrefix(stack, []byte("goroutine ")) {
+		return nil
+	}
+	out := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(stack))
+	for scanner.Scan() && len(out) < limit {
+		line := scanner.Text()
+		// 函数名行顶格，文件行以 tab 开头。
+		if line == "" || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "goroutine ") {
+			continue
+		}
+		fn := frameArgs.ReplaceAllString(line, "")
+		if strings.HasPrefix(fn, "runtime.") || strings.HasPrefix(fn, "runtime/debug.") || fn == "panic" || strings.HasPrefix(fn, "created by ") {
+			continue
+		}
+		out = append(out, fn)
+	}
+	return out
+}
@@ -0,0 +1,27 @@
+package monitor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorFingerprint(t *testing.T) {
+	stackA := []byte("goroutine 12 [running]:\nruntime/debug.Stack()\n\t/go/src/runtime/debug/stack.go:24 +0x5e\npanic({0x1034, 0x10})\n\t/go/src/runtime/panic.go:770 +0x132\nmain.(*Orders).Create(0xc000123)\n\t/app/orders.go:42 +0x1a\nmain.handler()\n\t/app/main.go:10 +0x1\n")
+	stackB := []byte("goroutine 99 [running]:\nruntime/debug.Stack()\n\t/go/src/runtime/debug/stack.go:24 +0x5e\npanic({0x2000, 0x20})\n\t/go/src/runtime/panic.go:770 +0x132\nmain.(*Orders).Create(0xc000999)\n\t/app/orders.go:43 +0x1b\nmain.handler()\n\t/app/main.go:11 +0x1\n")
+
+	a := ErrorFingerprint("order 10042 not found (trace 4bf92f3577b34da6a3ce929d0e0e4736, ptr 0xc000123)", stackA)
+	b := ErrorFingerprint("order 20007 not found (trace 00f067aa0ba902b7a3ce929d0e0e4736, ptr 0xc000999)", stackB)
+	assert.Len(t, a, 16)
+	assert.Equal(t, a, b, "volatile ids, addresses and line numbers are ignored")
+
+	assert.NotEqual(t, a, ErrorFingerprint("order 10042 not found", []byte("goroutine 1 [running]:\nmain.other()\n\t/app/x.go:1\n")))
+	assert.NotEqual(t, a, ErrorFingerprint("payment failed", stackA))
+	assert.Equal(t, ErrorFingerprint("status 502", []byte("<html>bad gateway 1</html>")), ErrorFingerprint("status 502", nil), "non-Go stacks are ignored")
+	assert.NotEqual(t, ErrorFingerprint("status 502", nil), ErrorFingerprint("status 503", nil), "status codes stay distinct")
+	assert.NotEqual(t, ErrorFingerprint("status 404", nil), ErrorFingerprint("status 502", nil))
+	assert.NotEqual(t, ErrorFingerprint("oauth2 token expired", nil), ErrorFingerprint("oauth1 token expired", nil))
+	assert.NotEqual(t, ErrorFingerprint("sha256 mismatch", nil), ErrorFingerprint("sha512 mismatch", nil))
+	assert.Empty(t, ErrorFingerprint("", nil))
+	assert.Equal(t, []string{"main.(*Orders).Create", "main.handler"}, stackFunctions(stackA, 5))
+}
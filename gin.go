@@ -1,8 +1,7 @@
 package monitor
 
 import (
-	"bytes"
-	"io"
+	"net/http"
 	"net/url"
 	"reflect"
 	"strings"
@@ -68,6 +67,26 @@ func extractTracingUser(c *gin.Context) (tenant string, operator string) {
 	return c.GetString("owner"), c.GetString("user")
 }
 
+// startTrace 读取或创建 W3C traceparent，并写入请求 context 与响应头。
+// c: 当前请求上下文。
+// 返回值：当前请求所属的 span；上游携带合法 traceparent 时作为其子 span。
+func (tr *GinTracingService) startTrace(c *gin.Context) TraceContext {
+	tc := NewTraceContext()
+	if parent, ok := ParseTraceparent(c.GetHeader(HeaderTraceparent), c.GetHeader(HeaderTracestate)); ok {
+		tc = parent.Child()
+	}
+	c.Request = c.Request.WithContext(ContextWithTrace(c.Request.Context(), tc))
+	c.Set(KeyTraceContext, tc)
+
+	requestID := c.GetHeader(HeaderRequestID)
+	if requestID == "" {
+		requestID = tc.TraceID
+	}
+	c.Header(HeaderRequestID, requestID)
+	c.Header(HeaderTraceparent, tc.Traceparent())
+	return tc
+}
+
 // LogfullRequestDetails 记录 gin 请求与响应的 tracing 详情。
 // c: 当前请求上下文。
 // 返回值：无。
@@ -82,6 +101,8 @@ func (tr *GinTracingService) LogfullRequestDetails(c *gin.Context) {
 	start := time.Now()
 	reqcache := make([]byte, 0)
 
+	tc := tr.startTrace(c)
+
 	uri := c.Request.RequestURI
 	method := c.Request.Method
 
@@ -101,24 +122,23 @@ func (tr *GinTracingService) LogfullRequestDetails(c *gin.Context) {
 		}
 	}
 
-	if tr.Service.Request && matched {
-		if c.Request.Body != nil { //TODO: check content-length, if too large, should skip
-			reqcache, _ = io.ReadAll(c.Request.Body)
-			c.Request.Body = io.NopCloser(bytes.NewBuffer(reqcache))
-			ct := c.Request.Header.Get("Content-Type")
-			if ct == "application/x-www-form-urlencoded" {
-				reqboy, err := url.QueryUnescape(string(reqcache))
-				if err == nil {
-					reqcache = []byte(reqboy)
-				}
-			}
+	// 请求体在业务读取时旁路采集，最多保留 MaxRequestBytes，避免大文件上传被整体缓存。
+	var reqTee *teeReadCloser
+	reqContentType := c.Request.Header.Get("Content-Type")
+	reqMode := tr.Service.CaptureModeFor(reqContentType)
+	if tr.Service.Request && matched && c.Request.Body != nil && c.Request.Body != http.NoBody {
+		reqTee = &teeReadCloser{
+			ReadCloser: c.Request.Body,
+			capture:    newPolicyCapture(reqMode, resolveCaptureLimit(tr.Service.MaxRequestBytes)),
 		}
+		c.Request.Body = reqTee
 	}
 
 	// respcache := make([]byte, 0)
 	writer := &RespLogging{
-		cache:          bytes.NewBuffer([]byte{}),
 		ResponseWriter: c.Writer,
+		service:        tr.Service,
+		limit:          resolveCaptureLimit(tr.Service.MaxResponseBytes),
 	}
 
 	if tr.Service.Resp && matched {
@@ -132,7 +152,33 @@ func (tr *GinTracingService) LogfullRequestDetails(c *gin.Context) {
 	status := c.Writer.Status()
 	rawID := c.GetUint(KeyTracingID)
 
-	respcache := writer.cache.Bytes()
+	var bodySize int64
+	bodyTruncated := false
+	if reqTee != nil {
+		reqTee.fill()
+		reqcache = summarizeCapture(reqMode, reqContentType, reqTee.capture, c.Request.MultipartForm)
+		bodySize = reqTee.capture.Size()
+		bodyTruncated = reqTee.capture.Truncated()
+		if c.Request.ContentLength > bodySize {
+			bodySize = c.Request.ContentLength
+			bodyTruncated = bodyTruncated || (reqMode == CaptureModeFull && int64(len(reqcache)) < bodySize)
+		}
+		if reqMode == CaptureModeFull && reqContentType == "application/x-www-form-urlencoded" && !bodyTruncated {
+			reqboy, err := url.QueryUnescape(string(reqcache))
+			if err == nil {
+				reqcache = []byte(reqboy)
+			}
+		}
+	}
+
+	var respcache []byte
+	var respSize int64
+	respTruncated := false
+	if writer.cache != nil {
+		respcache = summarizeCapture(writer.mode, writer.contentType, writer.cache, nil)
+		respSize = writer.cache.Size()
+		respTruncated = writer.cache.Truncated()
+	}
 
 	if index := strings.IndexRune(matchedUrl, '?'); index > 0 {
 		matchedUrl = matchedUrl[:index]
@@ -156,7 +202,12 @@ func (tr *GinTracingService) LogfullRequestDetails(c *gin.Context) {
 		UserAgent:      c.Request.UserAgent(),
 		Device:         c.GetHeader("deviceID"),
 		StartedAt:      startAt,
+		BodySize:       bodySize,
+		BodyTruncated:  bodyTruncated,
+		RespSize:       respSize,
+		RespTruncated:  respTruncated,
 	}
+	fullLogging.ApplyTrace(tc)
 
 	tenant, operator := extractTracingUser(c)
 	if tenant != "" {
@@ -166,5 +217,5 @@ func (tr *GinTracingService) LogfullRequestDetails(c *gin.Context) {
 		fullLogging.Operator = operator
 	}
 
-	TracingAdaptor.Push(fullLogging)
+	pushTracing(tr.Service, &fullLogging, c.Request.Header)
 }
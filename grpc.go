@@ -0,0 +1,405 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	MethodGRPC = "GRPC"
+)
+
+var (
+	grpcTenantKeys   = []string{"tenant", "x-tenant", "owner"}
+	grpcOperatorKeys = []string{"operator", "x-operator", "user"}
+	grpcDeviceKeys   = []string{"deviceid", "x-device-id"}
+)
+
+// GrpcTracingService 提供 gRPC 服务端与客户端拦截器，产出与 Gin 中间件一致的 TracingDetails。
+type GrpcTracingService struct {
+	Service *TracingRequestService
+	// Push 采样、脱敏后的推送目标，为 nil 时推送给 TracingAdaptor。
+	Push func(TracingDetails)
+}
+
+func NewGrpcTracingService(sr *TracingRequestService) *GrpcTracingService {
+	return &GrpcTracingService{Service: sr}
+}
+
+// GRPCStatusToHTTP 将 gRPC 状态码映射为 HTTP 状态码，便于与 HTTP 流量统一统计。
+func GRPCStatusToHTTP(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.Unknown:
+		return http.StatusInternalServerError
+	case codes.InvalidArgument, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Internal, codes.DataLoss:
+		return http.StatusInternalServerError
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// marshalGrpcMessage 将 gRPC 消息序列化为 JSON，proto 消息使用 protojson。
+func marshalGrpcMessage(msg any) []byte {
+	if msg == nil {
+		return nil
+	}
+	if pm, ok := msg.(proto.Message); ok {
+		b, err := protojson.Marshal(pm)
+		if err == nil {
+			return b
+		}
+	}
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return []byte(fmt.Sprintf("%v", msg))
+	}
+	return b
+}
+
+func firstMetadata(md metadata.MD, keys []string) string {
+	for _, key := range keys {
+		if values := md.Get(key); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	addr := p.Addr.String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+func (gs *GrpcTracingService) shouldLog(ctx context.Context, fullMethod string) bool {
+	return gs.Service != nil && gs.Service.ShouldLogReq(ctx, fullMethod)
+}
+
+func (gs *GrpcTracingService) captureRequest() bool {
+	return gs.Service == nil || gs.Service.Request
+}
+
+func (gs *GrpcTracingService) captureResponse() bool {
+	return gs.Service == nil || gs.Service.Resp
+}
+
+// startServerCall 从入站 metadata 中解析链路与用户信息，生成 tracing 详情。
+// ctx: 服务端调用上下文。
+// fullMethod: 完整方法名，如 /pkg.Service/Method。
+// 返回值：写入链路标识后的 context 与待补全的 tracing 详情。
+func (gs *GrpcTracingService) startServerCall(ctx context.Context, fullMethod string) (context.Context, *TracingDetails) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	tc := NewTraceContext()
+	if parent, ok := ParseTraceparent(firstMetadata(md, []string{HeaderTraceparent}), firstMetadata(md, []string{HeaderTracestate})); ok {
+		tc = parent.Child()
+	}
+	ctx = ContextWithTrace(ctx, tc)
+
+	details := &TracingDetails{
+		Optionname:     fullMethod,
+		Uri:            fullMethod,
+		Method:         MethodGRPC,
+		AppName:        core.AppName,
+		AppVersion:     core.Version,
+		VerbosityLevel: gs.Service.ResolveVerbosityLevel(fullMethod, VerbosityLevelByGRPCMethod(fullMethod)),
+		ClientIP:       peerIP(ctx),
+		UserAgent:      firstMetadata(md, []string{"user-agent"}),
+		Device:         firstMetadata(md, grpcDeviceKeys),
+		Tenant:         firstMetadata(md, grpcTenantKeys),
+		Operator:       firstMetadata(md, grpcOperatorKeys),
+		StartedAt:      time.Now(),
+	}
+	details.ApplyTrace(tc)
+	return ctx, details
+}
+
+// finishCall 补全耗时与状态码，经采样、脱敏后推送 tracing 详情。
+// md: 调用 metadata，用于按名称脱敏敏感头部。
+func (gs *GrpcTracingService) finishCall(details *TracingDetails, md metadata.MD, err error) {
+	details.Durtion = time.Since(details.StartedAt)
+	st := status.Convert(err)
+	details.Status = GRPCStatusToHTTP(st.Code())
+	if err != nil {
+		details.Resp = []byte(fmt.Sprintf("code=%s message=%s", st.Code(), st.Message()))
+	}
+	details.BodyEnc = DetectPayloadEncoding(details.Body)
+	details.RespEnc = DetectPayloadEncoding(details.Resp)
+	if gs.Push != nil {
+		pushTracingTo(gs.Service, details, md, gs.Push)
+		return
+	}
+	pushTracing(gs.Service, details, md)
+}
+
+// UnaryServerInterceptor 记录一元调用的请求、响应、状态与耗时。
+func (gs *GrpcTracingService) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !gs.shouldLog(ctx, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx, details := gs.startServerCall(ctx, info.FullMethod)
+		resp, err := handler(ctx, req)
+		if gs.captureRequest() {
+			details.Body = marshalGrpcMessage(req)
+		}
+		if gs.captureResponse() && err == nil {
+			details.Resp = marshalGrpcMessage(resp)
+		}
+		gs.finishCall(details, md, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor 记录流式调用的消息数量与总耗时；仅保留首条请求与最后一条响应。
+func (gs *GrpcTracingService) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !gs.shouldLog(ss.Context(), info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx, details := gs.startServerCall(ss.Context(), info.FullMethod)
+		wrapped := &tracingServerStream{ServerStream: ss, ctx: ctx, gs: gs, details: details}
+		err := handler(srv, wrapped)
+		wrapped.mu.Lock()
+		defer wrapped.mu.Unlock()
+		md, _ := metadata.FromIncomingContext(ss.Context())
+		gs.finishCall(details, md, err)
+		return err
+	}
+}
+
+type tracingServerStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	gs      *GrpcTracingService
+	details *TracingDetails
+	mu      sync.Mutex
+}
+
+func (s *tracingServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *tracingServerStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.mu.Lock()
+		s.details.ReqMessages++
+		if s.gs.captureRequest() && s.details.ReqMessages == 1 {
+			s.details.Body = marshalGrpcMessage(m)
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *tracingServerStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.mu.Lock()
+		s.details.RespMessages++
+		if s.gs.captureResponse() {
+			s.details.Resp = marshalGrpcMessage(m)
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// startClientCall 为出站调用生成子 span，并将 traceparent 写入 outgoing metadata。
+func (gs *GrpcTracingService) startClientCall(ctx context.Context, target string, fullMethod string) (context.Context, *TracingDetails) {
+	tc := NewTraceContext()
+	if parent, ok := TraceFromContext(ctx); ok {
+		tc = parent.Child()
+	}
+	ctx = metadata.AppendToOutgoingContext(ctx, HeaderTraceparent, tc.Traceparent())
+	if tc.TraceState != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, HeaderTracestate, tc.TraceState)
+	}
+
+	details := &TracingDetails{
+		Optionname:     fullMethod,
+		Uri:            "grpc://" + trimGrpcTarget(target) + fullMethod,
+		Method:         MethodGRPC,
+		AppName:        core.AppName,
+		AppVersion:     core.Version,
+		VerbosityLevel: TracingVerbosityLevelThirdParty,
+		StartedAt:      time.Now(),
+	}
+	details.ApplyTrace(tc)
+	return ctx, details
+}
+
+// finishClientCall 推送出站调用详情，失败时同时上报 ErrorReport；调用方主动取消不视为错误。
+func (gs *GrpcTracingService) finishClientCall(details *TracingDetails, md metadata.MD, err error) {
+	if err != nil && status.Code(err) != codes.Canceled {
+		core.ErrorAdaptor.Push(core.ErrorReport{
+			Error:     fmt.Errorf("grpc call to %s, resp err %v", details.Uri, err),
+			Uri:       details.Uri,
+			HappendAT: time.Now(),
+		})
+		zap.L().Error("outbound grpc call error", zap.String("Optionname", details.Optionname), zap.Error(err))
+	}
+	gs.finishCall(details, md, err)
+}
+
+// UnaryClientInterceptor 记录出站一元调用。
+func (gs *GrpcTracingService) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !gs.shouldLog(ctx, method) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		ctx, details := gs.startClientCall(ctx, cc.Target(), method)
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if gs.captureRequest() {
+			details.Body = marshalGrpcMessage(req)
+		}
+		if err == nil && gs.captureResponse() {
+			details.Resp = marshalGrpcMessage(reply)
+		}
+		md, _ := metadata.FromOutgoingContext(ctx)
+		gs.finishClientCall(details, md, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor 记录出站流式调用。
+// 推送时机：服务端非流式（一元响应、客户端流）在收到首个响应后；其余在流结束（EOF 或错误）时；
+// 调用方取消 ctx 或放弃流时以 ctx 的错误结束。
+func (gs *GrpcTracingService) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if !gs.shouldLog(ctx, method) {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		ctx, details := gs.startClientCall(ctx, cc.Target(), method)
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		md, _ := metadata.FromOutgoingContext(ctx)
+		if err != nil {
+			gs.finishClientCall(details, md, err)
+			return nil, err
+		}
+		s := &tracingClientStream{ClientStream: cs, gs: gs, desc: desc, details: details, md: md, done: make(chan struct{})}
+		go func() {
+			select {
+			case <-ctx.Done():
+				s.finish(status.FromContextError(ctx.Err()).Err())
+			case <-s.done:
+			}
+		}()
+		return s, nil
+	}
+}
+
+type tracingClientStream struct {
+	grpc.ClientStream
+	gs      *GrpcTracingService
+	desc    *grpc.StreamDesc
+	details *TracingDetails
+	md      metadata.MD
+	mu      sync.Mutex
+	once    sync.Once
+	done    chan struct{}
+}
+
+func (s *tracingClientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err == nil {
+		s.mu.Lock()
+		s.details.ReqMessages++
+		if s.gs.captureRequest() && s.details.ReqMessages == 1 {
+			s.details.Body = marshalGrpcMessage(m)
+		}
+		s.mu.Unlock()
+	}
+	return err
+}
+
+func (s *tracingClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.mu.Lock()
+		s.details.RespMessages++
+		if s.gs.captureResponse() {
+			s.details.Resp = marshalGrpcMessage(m)
+		}
+		s.mu.Unlock()
+		if !s.desc.ServerStreams {
+			// 客户端流（CloseAndRecv）只有一条响应，调用方通常不会再读到 EOF。
+			s.finish(nil)
+		}
+		return nil
+	}
+	if errors.Is(err, io.EOF) {
+		s.finish(nil)
+	} else {
+		s.finish(err)
+	}
+	return err
+}
+
+// finish 推送流式调用详情，只执行一次。
+func (s *tracingClientStream) finish(err error) {
+	s.once.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.gs.finishClientCall(s.details, s.md, err)
+	})
+}
+
+// trimGrpcTarget 去除 dns:/// 等 scheme，便于在 Uri 中展示。
+func trimGrpcTarget(target string) string {
+	if idx := strings.Index(target, ":///"); idx >= 0 {
+		return target[idx+4:]
+	}
+	return target
+}
@@ -0,0 +1,247 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	echoUnary    = "/test.Echo/Unary"
+	echoCollect  = "/test.Echo/Collect"
+	echoWatch    = "/test.Echo/Watch"
+	echoExcluded = "/test.Echo/Excluded"
+)
+
+// echoServiceDesc 手写的测试服务：一元、客户端流与服务端流各一个方法。
+var echoServiceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Unary", Handler: echoUnaryHandler},
+		{MethodName: "Excluded", Handler: echoUnaryHandler},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "Collect", Handler: echoCollectHandler, ClientStreams: true},
+		{StreamName: "Watch", Handler: echoWatchHandler, ServerStreams: true},
+	},
+}
+
+func echoUnaryHandler(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+	in := &wrapperspb.StringValue{}
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		value := req.(*wrapperspb.StringValue).GetValue()
+		if value == "fail" {
+			return nil, status.Error(codes.NotFound, "missing")
+		}
+		return wrapperspb.String("echo:" + value), nil
+	}
+	if interceptor == nil {
+		return handler(ctx, in)
+	}
+	method, _ := grpc.Method(ctx)
+	return interceptor(ctx, in, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+}
+
+func echoCollectHandler(srv any, stream grpc.ServerStream) error {
+	values := []string{}
+	for {
+		in := &wrapperspb.StringValue{}
+		err := stream.RecvMsg(in)
+		if err == io.EOF {
+			return stream.SendMsg(wrapperspb.String(strings.Join(values, ",")))
+		}
+		if err != nil {
+			return err
+		}
+		values = append(values, in.GetValue())
+	}
+}
+
+func echoWatchHandler(srv any, stream grpc.ServerStream) error {
+	in := &wrapperspb.StringValue{}
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		if err := stream.SendMsg(wrapperspb.String(in.GetValue())); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// traceRecorder 按服务端/客户端分别记录拦截器产出的 tracing 详情。
+type traceRecorder struct {
+	mu     sync.Mutex
+	server []TracingDetails
+	client []TracingDetails
+}
+
+func (r *traceRecorder) record(details TracingDetails) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if strings.HasPrefix(details.Uri, "grpc://") {
+		r.client = append(r.client, details)
+	} else {
+		r.server = append(r.server, details)
+	}
+}
+
+func (r *traceRecorder) clientTraces() []TracingDetails {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]TracingDetails{}, r.client...)
+}
+
+func (r *traceRecorder) serverTraces() []TracingDetails {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]TracingDetails{}, r.server...)
+}
+
+// startEchoServer 通过 bufconn 启动挂载了四个拦截器的服务端与客户端。
+func startEchoServer(t *testing.T) (*grpc.ClientConn, *traceRecorder) {
+	recorder := &traceRecorder{}
+	gs := NewGrpcTracingService(&TracingRequestService{
+		Request:  true,
+		Resp:     true,
+		Excluded: []string{echoExcluded},
+	})
+	gs.Push = recorder.record
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(gs.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(gs.StreamServerInterceptor()),
+	)
+	srv.RegisterService(&echoServiceDesc, struct{}{})
+	go srv.Serve(lis)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(gs.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(gs.StreamClientInterceptor()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		conn.Close()
+		srv.Stop()
+	})
+	return conn, recorder
+}
+
+func TestGrpcUnaryInterceptors(t *testing.T) {
+	conn, recorder := startEchoServer(t)
+	ctx := context.Background()
+
+	reply := &wrapperspb.StringValue{}
+	require.NoError(t, conn.Invoke(ctx, echoUnary, wrapperspb.String("hi"), reply))
+	assert.Equal(t, "echo:hi", reply.GetValue())
+	err := conn.Invoke(ctx, echoUnary, wrapperspb.String("fail"), reply)
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	clients := recorder.clientTraces()
+	servers := recorder.serverTraces()
+	require.Len(t, clients, 2)
+	require.Len(t, servers, 2)
+
+	assert.Equal(t, "grpc://bufnet"+echoUnary, clients[0].Uri)
+	assert.Equal(t, 200, clients[0].Status)
+	assert.Equal(t, `"echo:hi"`, string(clients[0].Resp))
+	assert.Equal(t, TracingVerbosityLevelThirdParty, clients[0].VerbosityLevel)
+	assert.Equal(t, 404, clients[1].Status)
+
+	assert.Equal(t, echoUnary, servers[0].Uri)
+	assert.Equal(t, `"hi"`, string(servers[0].Body))
+	assert.Equal(t, 404, servers[1].Status)
+	// 服务端 span 以客户端 span 为父节点。
+	assert.Equal(t, clients[0].TraceID, servers[0].TraceID)
+	assert.Equal(t, clients[0].SpanID, servers[0].ParentSpanID)
+}
+
+func TestGrpcInterceptorsHonourExcluded(t *testing.T) {
+	conn, recorder := startEchoServer(t)
+
+	reply := &wrapperspb.StringValue{}
+	require.NoError(t, conn.Invoke(context.Background(), echoExcluded, wrapperspb.String("hi"), reply))
+	assert.Equal(t, "echo:hi", reply.GetValue())
+	assert.Empty(t, recorder.clientTraces())
+	assert.Empty(t, recorder.serverTraces())
+}
+
+func TestGrpcClientStreamFinishesOnSingleResponse(t *testing.T) {
+	conn, recorder := startEchoServer(t)
+
+	cs, err := conn.NewStream(context.Background(), &echoServiceDesc.Streams[0], echoCollect)
+	require.NoError(t, err)
+	require.NoError(t, cs.SendMsg(wrapperspb.String("a")))
+	require.NoError(t, cs.SendMsg(wrapperspb.String("b")))
+	require.NoError(t, cs.CloseSend())
+	reply := &wrapperspb.StringValue{}
+	require.NoError(t, cs.RecvMsg(reply))
+	assert.Equal(t, "a,b", reply.GetValue())
+
+	// 与生成代码的 CloseAndRecv 一致，不再读取 EOF。
+	clients := recorder.clientTraces()
+	require.Len(t, clients, 1)
+	assert.Equal(t, 200, clients[0].Status)
+	assert.Equal(t, 2, clients[0].ReqMessages)
+	assert.Equal(t, 1, clients[0].RespMessages)
+	assert.Equal(t, `"a"`, string(clients[0].Body))
+	assert.Equal(t, `"a,b"`, string(clients[0].Resp))
+
+	assert.Eventually(t, func() bool { return len(recorder.serverTraces()) == 1 }, time.Second, 10*time.Millisecond)
+	server := recorder.serverTraces()[0]
+	assert.Equal(t, 2, server.ReqMessages)
+	assert.Equal(t, 1, server.RespMessages)
+}
+
+func TestGrpcServerStreamFinishesOnCancel(t *testing.T) {
+	conn, recorder := startEchoServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cs, err := conn.NewStream(ctx, &echoServiceDesc.Streams[1], echoWatch)
+	require.NoError(t, err)
+	require.NoError(t, cs.SendMsg(wrapperspb.String("tick")))
+	require.NoError(t, cs.CloseSend())
+	reply := &wrapperspb.StringValue{}
+	require.NoError(t, cs.RecvMsg(reply))
+	require.NoError(t, cs.RecvMsg(reply))
+	assert.Empty(t, recorder.clientTraces())
+
+	// 调用方不再读取并取消 ctx，客户端 trace 仍需推送。
+	cancel()
+	assert.Eventually(t, func() bool { return len(recorder.clientTraces()) == 1 }, time.Second, 10*time.Millisecond)
+	client := recorder.clientTraces()[0]
+	assert.Equal(t, 499, client.Status)
+	assert.GreaterOrEqual(t, client.RespMessages, 2)
+
+	assert.Eventually(t, func() bool { return len(recorder.serverTraces()) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, recorder.serverTraces()[0].ReqMessages)
+
+	// 取消后继续读取只返回错误，不会重复推送。
+	assert.Error(t, cs.RecvMsg(reply))
+	assert.Len(t, recorder.clientTraces(), 1)
+}
@@ -0,0 +1,62 @@
+package insights
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// EnvConnectionString Azure 标准的连接字符串环境变量。
+	EnvConnectionString = "APPLICATIONINSIGHTS_CONNECTION_STRING"
+	// EnvInstrumentationKey 旧版 instrumentation key 环境变量。
+	EnvInstrumentationKey = "APPINSIGHTS_INSTRUMENTATIONKEY"
+
+	defaultIngestionEndpoint = "https://dc.services.visualstudio.com/"
+	trackPath                = "v2/track"
+)
+
+// ConnectionString 解析后的 Application Insights 连接字符串。
+// InstrumentationKey: 资源的 instrumentation key。
+// IngestionEndpoint: 数据接收地址，未配置时为公有云默认地址。
+type ConnectionString struct {
+	InstrumentationKey string
+	IngestionEndpoint  string
+}
+
+// TrackURL 返回 telemetry 提交地址（IngestionEndpoint + v2/track）。
+func (cs ConnectionString) TrackURL() string {
+	return strings.TrimSuffix(cs.IngestionEndpoint, "/") + "/" + trackPath
+}
+
+// ParseConnectionString 解析形如 "InstrumentationKey=xxx;IngestionEndpoint=https://xxx/" 的连接字符串。
+// 未提供 IngestionEndpoint 时，按 EndpointSuffix 推导（https://dc.<suffix>/），两者都没有时使用公有云默认地址。
+// 返回值：缺少 InstrumentationKey 或格式错误时返回错误。
+func ParseConnectionString(value string) (ConnectionString, error) {
+	fields := map[string]string{}
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return ConnectionString{}, fmt.Errorf("invalid connection string segment %q", part)
+		}
+		fields[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(val)
+	}
+	cs := ConnectionString{
+		InstrumentationKey: fields["instrumentationkey"],
+		IngestionEndpoint:  fields["ingestionendpoint"],
+	}
+	if cs.InstrumentationKey == "" {
+		return ConnectionString{}, fmt.Errorf("connection string without InstrumentationKey")
+	}
+	if cs.IngestionEndpoint == "" {
+		if suffix := strings.Trim(fields["endpointsuffix"], "./"); suffix != "" {
+			cs.IngestionEndpoint = "https://dc." + suffix + "/"
+		} else {
+			cs.IngestionEndpoint = defaultIngestionEndpoint
+		}
+	}
+	return cs, nil
+}
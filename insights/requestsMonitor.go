@@ -1,7 +1,7 @@
 package insights
 
 import (
-	"fmt"
+	"errors"
 	"os"
 	"sync"
 	"time"
@@ -14,143 +14,182 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	defaultMaxBatchSize     = 1024
+	defaultMaxBatchInterval = 10 * time.Second
+	defaultShutdownTimeout  = 5 * time.Second
+)
+
+// AppInsightsSettings tracing.azure 配置。
+// ConnectionString: 连接字符串，优先于 Key，可通过 IngestionEndpoint 指定数据接收地址。
+// Endpoint: 直接指定 telemetry 提交地址（完整 URL），优先于连接字符串中的地址，可用于本地代理或测试。
+// MaxBatchSize/MaxBatchInterval: 缓冲条数达到上限或间隔到期时提交一批。
+// ShutdownTimeout: 停机时等待缓冲数据提交的最长时间。
 type AppInsightsSettings struct {
-	Key     string
-	Role    string
-	Version string
-	Details bool
+	Key              string
+	ConnectionString string
+	Endpoint         string
+	Role             string
+	Version          string
+	Details          bool
+	MaxBatchSize     int
+	MaxBatchInterval time.Duration
+	ShutdownTimeout  time.Duration
 }
 
 type ResquestMonitor struct {
 	AppInsightsSettings
 	logger *zap.Logger
 	client appinsights.TelemetryClient
-	Locker *sync.Mutex
+	mu     sync.RWMutex
+	closed bool
 }
 
+// NewRequestMonitor 按配置创建 Application Insights 客户端。
+// settings: 连接与批量配置，Key/ConnectionString 至少提供一个。
+// 返回值：连接字符串格式错误或缺少 key 时返回错误。
+func NewRequestMonitor(settings AppInsightsSettings, logger *zap.Logger) (*ResquestMonitor, error) {
+	endpoint := ""
+	if settings.ConnectionString != "" {
+		cs, err := ParseConnectionString(settings.ConnectionString)
+		if err != nil {
+			return nil, err
+		}
+		settings.Key = cs.InstrumentationKey
+		endpoint = cs.TrackURL()
+	}
+	if settings.Key == "" {
+		return nil, errors.New("no application insights key or connection string provided")
+	}
+	if settings.Endpoint != "" {
+		endpoint = settings.Endpoint
+	}
+	if settings.MaxBatchSize <= 0 {
+		settings.MaxBatchSize = defaultMaxBatchSize
+	}
+	if settings.MaxBatchInterval <= 0 {
+		settings.MaxBatchInterval = defaultMaxBatchInterval
+	}
+	if settings.ShutdownTimeout <= 0 {
+		settings.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	config := appinsights.NewTelemetryConfiguration(settings.Key)
+	if endpoint != "" {
+		config.EndpointUrl = endpoint
+	}
+	config.MaxBatchSize = settings.MaxBatchSize
+	config.MaxBatchInterval = settings.MaxBatchInterval
+	client := appinsights.NewTelemetryClientFromConfig(config)
+	if settings.Role != "" {
+		client.Context().Tags.Cloud().SetRole(settings.Role)
+	}
+	if settings.Version != "" {
+		client.Context().Tags.Application().SetVer(settings.Version)
+	}
+	settings.Endpoint = config.EndpointUrl
+
+	return &ResquestMonitor{
+		AppInsightsSettings: settings,
+		logger:              logger,
+		client:              client,
+	}, nil
+}
+
+// InitRequestMonitor 从 tracing.azure 与环境变量读取配置并创建客户端，停机时提交缓冲数据。
+// 环境变量 APPLICATIONINSIGHTS_CONNECTION_STRING 优先于 APPINSIGHTS_INSTRUMENTATIONKEY，两者均优先于配置文件。
+// 返回值：未配置 key 或配置错误时返回 nil，不启用。
 func InitRequestMonitor(logger *zap.Logger) *ResquestMonitor {
 	azureSetting := AppInsightsSettings{
 		Role:    core.AppName,
 		Version: core.Version,
 	}
-	rm := &ResquestMonitor{
-		logger: logger,
-		Locker: &sync.Mutex{},
-	}
 	settings := viper.Sub("tracing.azure")
 	if settings != nil {
 		settings.Unmarshal(&azureSetting)
 	}
-	rm.AppInsightsSettings = azureSetting
-	if keyFromenv := os.Getenv("APPINSIGHTS_INSTRUMENTATIONKEY"); keyFromenv != "" {
-		rm.Key = keyFromenv
+	if connFromEnv := os.Getenv(EnvConnectionString); connFromEnv != "" {
+		azureSetting.ConnectionString = connFromEnv
+		logger.Info("read application insights connection string from ENV")
+	} else if keyFromenv := os.Getenv(EnvInstrumentationKey); keyFromenv != "" {
+		azureSetting.ConnectionString = ""
+		azureSetting.Key = keyFromenv
 		logger.Info("read application insights key from ENV")
 	}
 
-	if rm.Key == "" {
+	if azureSetting.Key == "" && azureSetting.ConnectionString == "" {
 		logger.Warn("no application insights key provided, tracing function disabled.")
 		return nil
 	}
-
-	// bus.SubscribeAsync(event.EventError, client.ReportError, false)
-	// bus.SubscribeAsync(event.EventTracing, client.ReportTracing, false)
-	// bus.SubscribeAsync(cronext.EventJobFinished, client.ReportScheduleJob, false)
-	// logger.Info("event subscribed for application insights", zap.Bool("details", client.Details))
-	rm.client = rm.getClient()
-	logger.Info("enabled applicationInsights client cache.")
+	rm, err := NewRequestMonitor(azureSetting, logger)
+	if err != nil {
+		logger.Error("application insights config error, tracing function disabled.", zap.Error(err))
+		return nil
+	}
+	core.OnServiceStopping(rm.Shutdown)
+	logger.Info("enabled applicationInsights client.",
+		zap.String("endpoint", rm.Endpoint),
+		zap.Int("maxBatchSize", rm.MaxBatchSize),
+		zap.Duration("maxBatchInterval", rm.MaxBatchInterval),
+		zap.Bool("details", rm.Details),
+	)
 	return rm
 }
 
-func (appins *ResquestMonitor) ReportScheduleJob(req schedule.JobHistory) error {
-	status := 200
-	if !req.Succeed {
-		status = 500
-	}
-
-	details := monitor.TracingDetails{
-		Uri:            req.Job,
-		Method:         "Cron",
-		AppName:        req.App,
-		AppVersion:     req.AppVersion,
-		VerbosityLevel: monitor.TracingVerbosityLevelRead,
-		Durtion:        req.Duration,
-		Status:         status,
-		StartedAt:      time.Now(),
-	}
-	appins.ReportTracing(details)
-	return nil
+// Shutdown 停止接收新数据并提交缓冲中的 telemetry，最多等待 ShutdownTimeout。
+func (appins *ResquestMonitor) Shutdown() {
+	appins.mu.Lock()
+	if appins.closed {
+		appins.mu.Unlock()
+		return
+	}
+	appins.closed = true
+	appins.mu.Unlock()
+
+	select {
+	case <-appins.client.Channel().Close(appins.ShutdownTimeout):
+		appins.logger.Info("[insights] pending telemetry flushed")
+	case <-time.After(appins.ShutdownTimeout):
+		appins.logger.Warn("[insights] flush timeout reached, stop waiting")
+	}
 }
 
-func (appins *ResquestMonitor) getClient() appinsights.TelemetryClient {
-	if appins.client == nil {
-		client := appinsights.NewTelemetryClient(appins.Key)
-		if appins.Role != "" {
-			client.Context().Tags.Cloud().SetRole(appins.Role)
-		}
-		if appins.Version != "" {
-			client.Context().Tags.Application().SetVer(appins.Version)
-		}
-		appins.client = client
-		return client
+// track 提交 telemetry，停机后调用时丢弃。
+func (appins *ResquestMonitor) track(items ...appinsights.Telemetry) {
+	appins.mu.RLock()
+	defer appins.mu.RUnlock()
+	if appins.closed {
+		appins.logger.Debug("[insights] monitor is closed, telemetry dropped")
+		return
+	}
+	for _, item := range items {
+		appins.client.Track(item)
 	}
-	return appins.client
 }
 
-func (appins *ResquestMonitor) ReportError(rr core.ErrorReport) error {
-	appins.Locker.Lock()
-	defer appins.Locker.Unlock()
+// ReportScheduleJob 定时任务上报为一条 RequestTelemetry 与一条 job.finished 自定义事件，两者共享同一 operation id。
+func (appins *ResquestMonitor) ReportScheduleJob(req schedule.JobHistory) error {
+	request, event := NewJobTelemetry(req)
+	appins.track(request, event)
+	appins.logger.Debug("submit job telemetry done.", zap.String("job", req.Job))
+	return nil
+}
 
-	client := appins.getClient()
-	trace := appinsights.NewTraceTelemetry(rr.Error.Error(), appinsights.Error)
-	client.Track(trace)
+// ReportError 错误上报为 ExceptionTelemetry，Go 调用栈解析为栈帧。
+func (appins *ResquestMonitor) ReportError(rr core.ErrorReport) error {
+	appins.track(NewExceptionTelemetry(rr))
 	appins.logger.Debug("tracing error done", zap.Error(rr.Error))
 	return nil
 }
 
+// ReportTracing 对外调用上报为 RemoteDependencyTelemetry，其余上报为 RequestTelemetry。
+// 操作名与链路 id 设置在每条 telemetry 上，不修改客户端共享的 context。
 func (appins *ResquestMonitor) ReportTracing(tr monitor.TracingDetails) error {
-	appins.Locker.Lock()
-	defer appins.Locker.Unlock()
-
-	client := appins.getClient()
-
-	client.Context().Tags.Operation().SetName(fmt.Sprintf("%s %s", tr.Method, tr.Optionname))
-
-	t := appinsights.NewRequestTelemetry(
-		tr.Method, tr.Uri, tr.Durtion, fmt.Sprintf("%d", tr.Status),
-	)
-
-	t.Source = tr.ClientIP
-	t.Properties["app"] = tr.AppName
-	t.Properties["version"] = tr.AppVersion
-	t.Properties["user-agent"] = tr.UserAgent
-	t.Properties["device"] = tr.Device
-	// if tr.Tenant != "" {
-	t.Properties["owner"] = tr.Tenant
-	// }
-	t.Properties["operator"] = tr.Operator
-	t.Properties["verbosityLevel"] = fmt.Sprintf("%d", tr.VerbosityLevel)
-
-	// req := monitor.ToByte(tr.Body)
-	// resp := monitor.ToByte(tr.Resp)
-
-	if len(tr.Body) > 0 {
-		bodyText, bodyEncoding := monitor.EncodePayloadForText(tr.Body)
-		if appins.Details {
-			t.Properties["req"] = bodyText
-		}
-		t.Properties["req-encoding"] = bodyEncoding
-		t.Measurements["body-size"] = float64(len(tr.Body))
+	if isDependency(tr) {
+		appins.track(NewDependencyTelemetry(tr, appins.Details))
+	} else {
+		appins.track(NewRequestTelemetry(tr, appins.Details))
 	}
-	if len(tr.Resp) > 0 {
-		respText, respEncoding := monitor.EncodePayloadForText(tr.Resp)
-		if appins.Details {
-			t.Properties["resp"] = respText
-		}
-		t.Properties["resp-encoding"] = respEncoding
-		t.Measurements["resp-size"] = float64(len(tr.Resp))
-	}
-
-	client.Track(t)
 	appins.logger.Debug("submit tracing done.")
 	return nil
 }
@@ -0,0 +1,123 @@
+package insights
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+)
+
+// fakeIngestion 模拟 Application Insights 接收端，记录收到的 envelope。
+type fakeIngestion struct {
+	mu        sync.Mutex
+	envelopes []map[string]any
+	requests  int
+}
+
+func (f *fakeIngestion) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reader, err := gzip.NewReader(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	received := 0
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	f.mu.Lock()
+	f.requests++
+	for scanner.Scan() {
+		envelope := map[string]any{}
+		if json.Unmarshal(scanner.Bytes(), &envelope) == nil {
+			f.envelopes = append(f.envelopes, envelope)
+			received++
+		}
+	}
+	f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"itemsReceived": received, "itemsAccepted": received, "errors": []any{}})
+}
+
+func (f *fakeIngestion) names() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := []string{}
+	for _, envelope := range f.envelopes {
+		data := envelope["data"].(map[string]any)
+		names = append(names, data["baseType"].(string))
+	}
+	return names
+}
+
+func TestParseConnectionString(t *testing.T) {
+	cs, err := ParseConnectionString("InstrumentationKey=abc;IngestionEndpoint=https://westeurope-5.in.applicationinsights.azure.com/;LiveEndpoint=https://live/")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", cs.InstrumentationKey)
+	assert.Equal(t, "https://westeurope-5.in.applicationinsights.azure.com/v2/track", cs.TrackURL())
+
+	cs, err = ParseConnectionString("instrumentationkey=abc; EndpointSuffix=applicationinsights.azure.cn")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dc.applicationinsights.azure.cn/v2/track", cs.TrackURL())
+
+	cs, err = ParseConnectionString("InstrumentationKey=abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://dc.services.visualstudio.com/v2/track", cs.TrackURL())
+
+	_, err = ParseConnectionString("IngestionEndpoint=https://x/")
+	assert.Error(t, err)
+	_, err = ParseConnectionString("InstrumentationKey")
+	assert.Error(t, err)
+}
+
+func TestShutdownFlushesToIngestionEndpoint(t *testing.T) {
+	ingestion := &fakeIngestion{}
+	server := httptest.NewServer(ingestion)
+	defer server.Close()
+
+	rm, err := NewRequestMonitor(AppInsightsSettings{
+		ConnectionString: "InstrumentationKey=test-key;IngestionEndpoint=" + server.URL + "/",
+		Role:             "demo",
+		MaxBatchInterval: time.Hour,
+	}, zap.NewNop())
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+"/v2/track", rm.Endpoint)
+
+	assert.NoError(t, rm.ReportTracing(monitor.TracingDetails{Method: "GET", Uri: "/v1/orders", Status: 200, StartedAt: time.Now()}))
+	assert.NoError(t, rm.ReportTracing(monitor.TracingDetails{Method: "GET", Uri: "https://api.example.com/x", Status: 200, VerbosityLevel: monitor.TracingVerbosityLevelThirdParty}))
+	assert.NoError(t, rm.ReportScheduleJob(schedule.JobHistory{Job: "sync", Succeed: true}))
+	assert.Empty(t, ingestion.names(), "batch interval not reached")
+
+	rm.Shutdown()
+	assert.ElementsMatch(t, []string{"RequestData", "RemoteDependencyData", "RequestData", "EventData"}, ingestion.names())
+	for _, envelope := range ingestion.envelopes {
+		assert.Equal(t, "test-key", envelope["iKey"])
+	}
+
+	// 停机后的上报被丢弃，重复 Shutdown 无副作用。
+	assert.NoError(t, rm.ReportTracing(monitor.TracingDetails{Method: "GET", Uri: "/late", Status: 200}))
+	rm.Shutdown()
+	assert.Len(t, ingestion.names(), 4)
+}
+
+func TestEndpointOverridesConnectionString(t *testing.T) {
+	rm, err := NewRequestMonitor(AppInsightsSettings{
+		ConnectionString: "InstrumentationKey=k;IngestionEndpoint=https://example.invalid/",
+		Endpoint:         "http://127.0.0.1:1/v2/track",
+		ShutdownTimeout:  10 * time.Millisecond,
+	}, zap.NewNop())
+	assert.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:1/v2/track", rm.Endpoint)
+	assert.Equal(t, defaultMaxBatchSize, rm.MaxBatchSize)
+	rm.Shutdown()
+
+	_, err = NewRequestMonitor(AppInsightsSettings{}, zap.NewNop())
+	assert.Error(t, err)
+}
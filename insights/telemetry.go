@@ -0,0 +1,264 @@
+package insights
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights"
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+)
+
+// maxPropertyLength Application Insights 单个自定义属性值的长度上限。
+const maxPropertyLength = 8192
+
+// operationName 计算 tracing 的操作名：优先使用 Optionname（路由模板），否则为 Method + Uri。
+func operationName(tr monitor.TracingDetails) string {
+	if tr.Optionname != "" {
+		return fmt.Sprintf("%s %s", tr.Method, tr.Optionname)
+	}
+	return fmt.Sprintf("%s %s", tr.Method, tr.Uri)
+}
+
+// setOperation 在单条 telemetry 上设置链路信息，不修改客户端共享的 context。
+// tags: telemetry 自身的 tags。
+// traceID/parentID: W3C trace id 与父 span id，为空时不设置。
+// name: 操作名，为空时不设置。
+func setOperation(tags contracts.ContextTags, traceID string, parentID string, name string) {
+	if traceID != "" {
+		tags.Operation().SetId(traceID)
+	}
+	if parentID != "" {
+		tags.Operation().SetParentId(parentID)
+	}
+	if name != "" {
+		tags.Operation().SetName(name)
+	}
+}
+
+// isDependency 判断 tracing 是否为本应用发起的对外调用。
+func isDependency(tr monitor.TracingDetails) bool {
+	return tr.VerbosityLevel == monitor.TracingVerbosityLevelThirdParty
+}
+
+// methodMQTT 与 mqtt.MethodMQTT 一致，insights 不依赖 mqtt 包。
+const methodMQTT = "MQTT"
+
+// dependencyTarget 从 Uri 中取出目标主机，无法解析时返回原始 Uri。
+func dependencyTarget(uri string) string {
+	if parsed, err := url.Parse(uri); err == nil && parsed.Host != "" {
+		return parsed.Host
+	}
+	return uri
+}
+
+// addTracingProperties 写入 tracing 的通用属性与度量。
+// details: 是否附带请求体/响应体。
+func addTracingProperties(props map[string]string, measurements map[string]float64, tr monitor.TracingDetails, details bool) {
+	props["app"] = tr.AppName
+	props["version"] = tr.AppVersion
+	props["user-agent"] = tr.UserAgent
+	props["device"] = tr.Device
+	props["owner"] = tr.Tenant
+	props["operator"] = tr.Operator
+	props["verbosityLevel"] = fmt.Sprintf("%d", tr.VerbosityLevel)
+
+	if len(tr.Body) > 0 {
+		bodyText, bodyEncoding := monitor.EncodePayloadForText(tr.Body)
+		if details {
+			props["req"] = truncateProperty(bodyText)
+		}
+		props["req-encoding"] = bodyEncoding
+		measurements["body-size"] = float64(len(tr.Body))
+	}
+	if len(tr.Resp) > 0 {
+		respText, respEncoding := monitor.EncodePayloadForText(tr.Resp)
+		if details {
+			props["resp"] = truncateProperty(respText)
+		}
+		props["resp-encoding"] = respEncoding
+		measurements["resp-size"] = float64(len(tr.Resp))
+	}
+}
+
+func truncateProperty(value string) string {
+	if len(value) <= maxPropertyLength {
+		return value
+	}
+	return value[:maxPropertyLength]
+}
+
+// tracingTimestamp 返回请求开始时间，缺省时按当前时间减去耗时推算。
+func tracingTimestamp(tr monitor.TracingDetails) time.Time {
+	if !tr.StartedAt.IsZero() {
+		return tr.StartedAt
+	}
+	return time.Now().Add(-tr.Durtion)
+}
+
+// NewRequestTelemetry 将入站请求（HTTP、gRPC 服务端、MQTT 消费等）转换为 RequestTelemetry。
+// tr: tracing 详情。
+// details: 是否附带请求体/响应体。
+func NewRequestTelemetry(tr monitor.TracingDetails, details bool) *appinsights.RequestTelemetry {
+	t := appinsights.NewRequestTelemetry(tr.Method, tr.Uri, tr.Durtion, strconv.Itoa(tr.Status))
+	t.Timestamp = tracingTimestamp(tr)
+	t.Source = tr.ClientIP
+	if tr.SpanID != "" {
+		t.Id = tr.SpanID
+	}
+	setOperation(t.Tags, tr.TraceID, tr.ParentSpanID, operationName(tr))
+	addTracingProperties(t.Properties, t.Measurements, tr, details)
+	return t
+}
+
+// NewDependencyTelemetry 将对外调用（TracingVerbosityLevelThirdParty）转换为 RemoteDependencyTelemetry。
+// 依赖的 Id 为本次调用的 span id，父级为发起调用的入站请求，从而在 Application Insights 中挂到对应请求下。
+func NewDependencyTelemetry(tr monitor.TracingDetails, details bool) *appinsights.RemoteDependencyTelemetry {
+	dependencyType, target := "HTTP", dependencyTarget(tr.Uri)
+	switch tr.Method {
+	case monitor.MethodGRPC:
+		dependencyType = "GRPC"
+	case methodMQTT:
+		// mqtt://<topic> 的 host 只是 topic 的第一级，目标取完整 topic。
+		dependencyType, target = "MQTT", tr.Optionname
+	}
+	success := tr.Status > 0 && tr.Status < 400
+	t := appinsights.NewRemoteDependencyTelemetry(operationName(tr), dependencyType, target, success)
+	t.Timestamp = tracingTimestamp(tr)
+	t.Id = tr.SpanID
+	t.Duration = tr.Durtion
+	t.Data = tr.Uri
+	if tr.Status > 0 {
+		t.ResultCode = strconv.Itoa(tr.Status)
+	}
+	setOperation(t.Tags, tr.TraceID, tr.ParentSpanID, "")
+	addTracingProperties(t.Properties, t.Measurements, tr, details)
+	return t
+}
+
+// NewExceptionTelemetry 将错误上报转换为 ExceptionTelemetry。
+// FullStack 为 Go 调用栈时解析为结构化栈帧；否则（如下游响应体）作为 details 属性附带。
+func NewExceptionTelemetry(rr core.ErrorReport) *appinsights.ExceptionTelemetry {
+	var err any = rr.Error
+	if rr.Error == nil {
+		err = errors.New("unknown error")
+	}
+	timestamp := rr.HappendAT
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	t := &appinsights.ExceptionTelemetry{
+		Error:         err,
+		Frames:        parseGoStack(rr.FullStack),
+		SeverityLevel: appinsights.Error,
+		BaseTelemetry: appinsights.BaseTelemetry{
+			Timestamp:  timestamp,
+			Tags:       make(contracts.ContextTags),
+			Properties: make(map[string]string),
+		},
+		BaseTelemetryMeasurements: appinsights.BaseTelemetryMeasurements{
+			Measurements: make(map[string]float64),
+		},
+	}
+	message := ""
+	if rr.Error != nil {
+		message = rr.Error.Error()
+	}
+	t.Properties["uri"] = rr.Uri
+	// 大部分上报点不填写应用信息，缺省记为当前应用。
+	appName, appVersion := rr.AppName, rr.AppVersion
+	if appName == "" {
+		appName, appVersion = core.AppName, core.Version
+	}
+	t.Properties["app"] = appName
+	t.Properties["version"] = appVersion
+	t.Properties["fingerprint"] = monitor.ErrorFingerprint(message, rr.FullStack)
+	if len(t.Frames) == 0 && len(rr.FullStack) > 0 {
+		text, enc := monitor.EncodePayloadForText(rr.FullStack)
+		t.Properties["details"] = truncateProperty(text)
+		t.Properties["details-encoding"] = enc
+	}
+	return t
+}
+
+// NewJobTelemetry 将定时任务转换为一条 RequestTelemetry 与一条关联的 job.finished 自定义事件。
+// 每次执行生成新的 operation id，事件挂在该请求下。
+func NewJobTelemetry(job schedule.JobHistory) (*appinsights.RequestTelemetry, *appinsights.EventTelemetry) {
+	status := 200
+	if !job.Succeed {
+		status = 500
+	}
+	tc := monitor.NewTraceContext()
+	name := "Cron " + job.Job
+
+	req := appinsights.NewRequestTelemetry("Cron", job.Job, job.Duration, strconv.Itoa(status))
+	req.Name = name
+	req.Id = tc.SpanID
+	setOperation(req.Tags, tc.TraceID, "", name)
+	req.Properties["app"] = job.App
+	req.Properties["version"] = job.AppVersion
+	req.Properties["job"] = job.Job
+
+	event := appinsights.NewEventTelemetry("job.finished")
+	event.Timestamp = req.Timestamp.Add(job.Duration)
+	setOperation(event.Tags, tc.TraceID, tc.SpanID, name)
+	event.Properties["job"] = job.Job
+	event.Properties["app"] = job.App
+	event.Properties["version"] = job.AppVersion
+	event.Properties["succeed"] = strconv.FormatBool(job.Succeed)
+	event.Measurements["duration-ms"] = float64(job.Duration) / float64(time.Millisecond)
+	return req, event
+}
+
+// parseGoStack 将 runtime/debug.Stack 格式的调用栈解析为栈帧。
+// 返回值：非 Go 调用栈时返回 nil。
+func parseGoStack(stack []byte) []*contracts.StackFrame {
+	if !bytes.HasPrefix(stack, []byte("goroutine ")) {
+		return nil
+	}
+	var frames []*contracts.StackFrame
+	var method string
+	scanner := bufio.NewScanner(bytes.NewReader(stack))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "goroutine "), line == "":
+			continue
+		case strings.HasPrefix(line, "\t"):
+			if method == "" {
+				continue
+			}
+			// \t/path/to/file.go:42 +0x1a
+			location := strings.TrimSpace(line)
+			if i := strings.LastIndex(location, " +0x"); i >= 0 {
+				location = location[:i]
+			}
+			frame := contracts.NewStackFrame()
+			frame.Level = len(frames)
+			frame.Method = method
+			frame.FileName = location
+			if i := strings.LastIndex(location, ":"); i >= 0 {
+				if n, err := strconv.Atoi(location[i+1:]); err == nil {
+					frame.FileName = location[:i]
+					frame.Line = n
+				}
+			}
+			frames = append(frames, frame)
+			method = ""
+		default:
+			method = line
+			if i := strings.LastIndex(method, "("); i > 0 {
+				method = method[:i]
+			}
+		}
+	}
+	return frames
+}
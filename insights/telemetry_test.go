@@ -0,0 +1,121 @@
+package insights
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/microsoft/ApplicationInsights-Go/appinsights/contracts"
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+	testParent  = "a3ce929d0e0e4736"
+)
+
+func TestDependencyTelemetry(t *testing.T) {
+	started := time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)
+	tr := monitor.TracingDetails{
+		Optionname:     "/v1/orders",
+		Uri:            "https://api.example.com/v1/orders?id=1",
+		Method:         "GET",
+		VerbosityLevel: monitor.TracingVerbosityLevelThirdParty,
+		Durtion:        120 * time.Millisecond,
+		Status:         503,
+		StartedAt:      started,
+		TraceID:        testTraceID,
+		SpanID:         testSpanID,
+		ParentSpanID:   testParent,
+		Body:           []byte(`{"id":1}`),
+	}
+	assert.True(t, isDependency(tr))
+	d := NewDependencyTelemetry(tr, false)
+	assert.Equal(t, "HTTP", d.Type)
+	assert.Equal(t, "api.example.com", d.Target)
+	assert.Equal(t, tr.Uri, d.Data)
+	assert.Equal(t, "503", d.ResultCode)
+	assert.False(t, d.Success)
+	assert.Equal(t, started, d.Timestamp)
+	assert.Equal(t, testSpanID, d.Id)
+	assert.Equal(t, testTraceID, d.Tags[contracts.OperationId])
+	assert.Equal(t, testParent, d.Tags[contracts.OperationParentId])
+	assert.NotContains(t, d.Properties, "req")
+	assert.Equal(t, float64(8), d.Measurements["body-size"])
+
+	tr.Method = monitor.MethodGRPC
+	tr.Uri = "/orders.OrderService/Get"
+	tr.Status = 200
+	d = NewDependencyTelemetry(tr, true)
+	assert.Equal(t, "GRPC", d.Type)
+	assert.True(t, d.Success)
+	assert.Equal(t, `{"id":1}`, d.Properties["req"])
+
+	tr.Method = "MQTT"
+	tr.Optionname = "t/acme/d/dev-01/cmd"
+	tr.Uri = "mqtt://t/acme/d/dev-01/cmd?qos=1"
+	d = NewDependencyTelemetry(tr, false)
+	assert.Equal(t, "MQTT", d.Type)
+	assert.Equal(t, "t/acme/d/dev-01/cmd", d.Target)
+	assert.Equal(t, tr.Uri, d.Data)
+}
+
+func TestRequestTelemetryTagsArePerItem(t *testing.T) {
+	a := NewRequestTelemetry(monitor.TracingDetails{Method: "GET", Optionname: "/a", Uri: "/a", Status: 200, TraceID: testTraceID, SpanID: testSpanID}, false)
+	b := NewRequestTelemetry(monitor.TracingDetails{Method: "POST", Uri: "/b", Status: 201}, false)
+	assert.Equal(t, "GET /a", a.Tags[contracts.OperationName])
+	assert.Equal(t, testTraceID, a.Tags[contracts.OperationId])
+	assert.Equal(t, testSpanID, a.Id)
+	assert.Equal(t, "POST /b", b.Tags[contracts.OperationName])
+	assert.NotContains(t, b.Tags, contracts.OperationId)
+}
+
+func TestExceptionTelemetry(t *testing.T) {
+	happened := time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)
+	rr := core.ErrorReport{
+		Error:      errors.New("boom"),
+		Uri:        "/v1/orders",
+		FullStack:  []byte("goroutine 1 [running]:\nmain.handler(0xc000010000, 0x1)\n\t/app/main.go:42 +0x1d\nmain.main()\n\t/app/main.go:10 +0x25\n"),
+		HappendAT:  happened,
+		AppName:    "demo",
+		AppVersion: "1.0",
+	}
+	e := NewExceptionTelemetry(rr)
+	assert.Equal(t, happened, e.Timestamp)
+	assert.Equal(t, monitor.ErrorFingerprint("boom", rr.FullStack), e.Properties["fingerprint"])
+	if assert.Len(t, e.Frames, 2) {
+		assert.Equal(t, "main.handler", e.Frames[0].Method)
+		assert.Equal(t, "/app/main.go", e.Frames[0].FileName)
+		assert.Equal(t, 42, e.Frames[0].Line)
+		assert.Equal(t, 1, e.Frames[1].Level)
+	}
+	assert.NotContains(t, e.Properties, "details")
+	assert.Equal(t, "demo", e.Properties["app"])
+	assert.Equal(t, "1.0", e.Properties["version"])
+
+	appName, version := core.AppName, core.Version
+	core.AppName, core.Version = "svc", "2.0"
+	defer func() { core.AppName, core.Version = appName, version }()
+	e = NewExceptionTelemetry(core.ErrorReport{FullStack: []byte(`{"error":"downstream"}`)})
+	assert.Empty(t, e.Frames)
+	assert.Equal(t, "svc", e.Properties["app"])
+	assert.Equal(t, "2.0", e.Properties["version"])
+	assert.Equal(t, `{"error":"downstream"}`, e.Properties["details"])
+	assert.NotNil(t, e.Error)
+}
+
+func TestJobTelemetryCorrelation(t *testing.T) {
+	req, event := NewJobTelemetry(schedule.JobHistory{Job: "sync", App: "demo", Duration: 2 * time.Second, Succeed: false})
+	assert.Equal(t, "Cron sync", req.Name)
+	assert.Equal(t, "500", req.ResponseCode)
+	assert.NotEmpty(t, req.Tags[contracts.OperationId])
+	assert.Equal(t, req.Tags[contracts.OperationId], event.Tags[contracts.OperationId])
+	assert.Equal(t, req.Id, event.Tags[contracts.OperationParentId])
+	assert.Equal(t, "job.finished", event.Name)
+	assert.Equal(t, "false", event.Properties["succeed"])
+	assert.Equal(t, float64(2000), event.Measurements["duration-ms"])
+}
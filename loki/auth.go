@@ -0,0 +1,147 @@
+package loki
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	HeaderScopeOrgID = "X-Scope-OrgID"
+	// maxTenantIDLength Loki 对租户 ID 的长度限制。
+	maxTenantIDLength = 150
+)
+
+// tlsEnabled 判断是否需要 TLS：https 地址或配置了任一 TLS 选项。
+func tlsEnabled(conf *LokiConfig) bool {
+	return strings.HasPrefix(strings.ToLower(conf.URL), "https://") ||
+		conf.CAFile != "" || conf.CertFile != "" || conf.KeyFile != "" ||
+		conf.ServerName != "" || conf.InsecureSkipVerify
+}
+
+// buildTLSConfig 根据配置构建 TLS 设置。
+// conf: Loki 配置。
+// 返回值：未启用 TLS 时返回 nil；证书文件读取失败时返回错误。
+func buildTLSConfig(conf *LokiConfig) (*tls.Config, error) {
+	if !tlsEnabled(conf) {
+		return nil, nil
+	}
+	tlsConf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         conf.ServerName,
+		InsecureSkipVerify: conf.InsecureSkipVerify,
+	}
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read loki CA file failed: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in loki CA file %s", conf.CAFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+	if conf.CertFile != "" || conf.KeyFile != "" {
+		if conf.CertFile == "" || conf.KeyFile == "" {
+			return nil, errors.New("loki CertFile and KeyFile must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load loki client certificate failed: %w", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConf, nil
+}
+
+// authorizationHeader 计算 REST 请求的 Authorization 头部，BearerToken 优先于 User/Password。
+// 返回值：未配置认证时返回空字符串。
+func authorizationHeader(conf *LokiConfig) string {
+	if conf.BearerToken != "" {
+		return "Bearer " + conf.BearerToken
+	}
+	if conf.User != "" || conf.Password != "" {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(conf.User+":"+conf.Password))
+	}
+	return ""
+}
+
+// newHTTPClient 创建 REST 请求使用的 http.Client，未启用 TLS 时复用 http.DefaultClient。
+func newHTTPClient(conf *LokiConfig) (*http.Client, error) {
+	tlsConf, err := buildTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConf == nil {
+		return http.DefaultClient, nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConf
+	return &http.Client{Transport: transport}, nil
+}
+
+// BearerTokenCreds 以 Bearer Token 方式实现 gRPC PerRPCCredentials。
+type BearerTokenCreds struct {
+	Token string
+	TLS   bool
+}
+
+func (c *BearerTokenCreds) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{
+		"authorization": "Bearer " + c.Token,
+	}, nil
+}
+
+func (c *BearerTokenCreds) RequireTransportSecurity() bool {
+	return c.TLS
+}
+
+// normalizeTenantID 将租户名转换为 Loki 可接受的 ID：仅保留字母、数字与 !-_.*'()，其余替换为 _。
+// 返回值：规范化后的租户 ID；"." 与 ".." 不合法，返回空字符串。
+func normalizeTenantID(tenant string) string {
+	tenant = strings.TrimSpace(tenant)
+	if tenant == "" {
+		return ""
+	}
+	var builder strings.Builder
+	for _, r := range tenant {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			builder.WriteRune(r)
+		case strings.ContainsRune("!-_.*'()", r):
+			builder.WriteRune(r)
+		default:
+			builder.WriteRune('_')
+		}
+	}
+	out := builder.String()
+	if len(out) > maxTenantIDLength {
+		out = out[:maxTenantIDLength]
+	}
+	if out == "." || out == ".." {
+		return ""
+	}
+	return out
+}
+
+// tenantFor 计算写入 Loki 时使用的 X-Scope-OrgID。
+// tenant: 业务租户，仅在 TenantFromTracing 开启时使用。
+// 返回值：租户 ID；为空表示不发送该头部。
+func (lm *LokiSetting) tenantFor(tenant string) string {
+	if lm.Config != nil && lm.Config.TenantFromTracing {
+		if id := normalizeTenantID(tenant); id != "" {
+			return id
+		}
+	}
+	if lm.Config != nil {
+		return normalizeTenantID(lm.Config.TenantID)
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package loki
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	defaultBatchMaxBytes        = 1 << 20
+	defaultBatchMaxEntries      = 1000
+	defaultFlushInterval        = time.Second
+	defaultRateLimitBytesPerSec = 2 << 20
+	defaultRateLimitLinesPerSec = 1000
+)
+
+// LokiEntry 一条待写入的日志。
+// Metadata: Loki structured metadata（不建索引的 labels），可为 nil。
+type LokiEntry struct {
+	Timestamp time.Time
+	Line      string
+	Metadata  map[string]string
+}
+
+// LokiStream 同一组 labels 下的多条日志，对应 Loki push 请求中的一个 stream。
+type LokiStream struct {
+	Labels  map[string]string
+	Entries []LokiEntry
+}
+
+// lokiBatch 同一租户下按 label 集合聚合的一批日志，保持 stream 首次出现的顺序。
+type lokiBatch struct {
+	tenant  string
+	streams map[string]*LokiStream
+	order   []string
+	bytes   int
+	entries int
+	sources map[string]int
+	oldest  time.Time
+}
+
+func newLokiBatch(tenant string) *lokiBatch {
+	return &lokiBatch{
+		tenant:  tenant,
+		streams: map[string]*LokiStream{},
+		sources: map[string]int{},
+	}
+}
+
+func (b *lokiBatch) empty() bool {
+	return b.entries == 0
+}
+
+// entrySize 估算一条日志占用的字节数，包含 structured metadata。
+func entrySize(entry LokiEntry) int {
+	size := len(entry.Line)
+	for k, v := range entry.Metadata {
+		size += len(k) + len(v)
+	}
+	return size
+}
+
+// fits 判断追加一条日志后是否仍在批次上限内；空批次总是可以追加，避免单条超限的日志无法发送。
+func (b *lokiBatch) fits(entry LokiEntry, maxBytes int, maxEntries int) bool {
+	if b.empty() {
+		return true
+	}
+	if maxEntries > 0 && b.entries+1 > maxEntries {
+		return false
+	}
+	if maxBytes > 0 && b.bytes+entrySize(entry) > maxBytes {
+		return false
+	}
+	return true
+}
+
+// add 追加一条日志。
+// labels: 日志所属 labels，相同 labels 的日志归入同一个 stream。
+// entry: 日志内容。
+// source: 数据来源，仅用于日志统计。
+// enqueuedAt: 入队时间，用于观测排队耗时。
+func (b *lokiBatch) add(labels map[string]string, entry LokiEntry, source string, enqueuedAt time.Time) {
+	key := formatLabels(labels)
+	stream, ok := b.streams[key]
+	if !ok {
+		stream = &LokiStream{Labels: labels}
+		b.streams[key] = stream
+		b.order = append(b.order, key)
+	}
+	stream.Entries = append(stream.Entries, entry)
+	b.bytes += entrySize(entry)
+	b.entries++
+	b.sources[source]++
+	if b.oldest.IsZero() || enqueuedAt.Before(b.oldest) {
+		b.oldest = enqueuedAt
+	}
+}
+
+// list 按首次出现顺序返回全部 stream。
+func (b *lokiBatch) list() []LokiStream {
+	out := make([]LokiStream, 0, len(b.order))
+	for _, key := range b.order {
+		out = append(out, *b.streams[key])
+	}
+	return out
+}
+
+// newRateLimiter 创建限速器，perSecond <= 0 表示不限速。
+func newRateLimiter(perSecond int, burst int) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+	if burst < perSecond {
+		burst = perSecond
+	}
+	return rate.NewLimiter(rate.Limit(perSecond), burst)
+}
+
+// waitLimiter 等待 n 个令牌；n 超过 burst 时分段等待。
+func waitLimiter(limiter *rate.Limiter, n int) {
+	if limiter == nil || limiter.Limit() == rate.Inf {
+		return
+	}
+	burst := limiter.Burst()
+	for n > 0 {
+		take := min(n, burst)
+		_ = limiter.WaitN(context.Background(), take)
+		n -= take
+	}
+}
+
+// pickLimit 读取限速配置：0 使用默认值，负数表示不限速。
+func pickLimit(value int, fallback int) int {
+	if value == 0 {
+		return fallback
+	}
+	if value < 0 {
+		return 0
+	}
+	return value
+}
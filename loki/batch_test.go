@@ -0,0 +1,186 @@
+package loki
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+)
+
+type fakeLokiClient struct {
+	mu      sync.Mutex
+	pushes  [][]LokiStream
+	tenants []string
+}
+
+func (f *fakeLokiClient) Push(tenant string, streams []LokiStream) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pushes = append(f.pushes, streams)
+	f.tenants = append(f.tenants, tenant)
+	return nil
+}
+
+func (f *fakeLokiClient) Close() error { return nil }
+
+func newTestSetting(client LokiClient, maxEntries int, flushInterval time.Duration) *LokiSetting {
+	lm := &LokiSetting{
+		Logger:               zap.NewNop(),
+		MaxBytes:             240 * 1024,
+		client:               client,
+		queue:                make(chan lokiPushItem, 100),
+		workerDone:           make(chan struct{}),
+		batchMaxBytes:        defaultBatchMaxBytes,
+		batchMaxEntries:      maxEntries,
+		flushInterval:        flushInterval,
+		bytesLimiter:         newRateLimiter(0, 0),
+		linesLimiter:         newRateLimiter(0, 0),
+		retryPause:           time.Millisecond,
+		maxRetryPause:        time.Millisecond,
+		shutdownFlushTimeout: time.Second,
+	}
+	go lm.runWriter()
+	return lm
+}
+
+func TestBatchGroupsByLabels(t *testing.T) {
+	client := &fakeLokiClient{}
+	lm := newTestSetting(client, 100, time.Hour)
+	a := map[string]string{"data_type": "tracing"}
+	b := map[string]string{"data_type": "error"}
+	assert.NoError(t, lm.enqueueLog("tracing", "", a, "a1"))
+	assert.NoError(t, lm.enqueueLog("error", "", b, "b1"))
+	assert.NoError(t, lm.enqueueLog("tracing", "", a, "a2"))
+	lm.shutdownWriter()
+
+	assert.Len(t, client.pushes, 1)
+	streams := client.pushes[0]
+	assert.Len(t, streams, 2)
+	assert.Equal(t, a, streams[0].Labels)
+	assert.Equal(t, []string{"a1", "a2"}, []string{streams[0].Entries[0].Line, streams[0].Entries[1].Line})
+	assert.Equal(t, "b1", streams[1].Entries[0].Line)
+}
+
+func TestBatchFlushOnEntriesAndInterval(t *testing.T) {
+	client := &fakeLokiClient{}
+	lm := newTestSetting(client, 2, 20*time.Millisecond)
+	labels := map[string]string{"data_type": "tracing"}
+	for _, line := range []string{"1", "2", "3"} {
+		assert.NoError(t, lm.enqueueLog("tracing", "", labels, line))
+	}
+	assert.Eventually(t, func() bool {
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return len(client.pushes) == 2
+	}, time.Second, 5*time.Millisecond)
+	lm.shutdownWriter()
+
+	assert.Len(t, client.pushes[0][0].Entries, 2)
+	assert.Len(t, client.pushes[1][0].Entries, 1)
+}
+
+func TestBatchFitsBytes(t *testing.T) {
+	batch := newLokiBatch("")
+	assert.True(t, batch.fits(LokiEntry{Line: strings.Repeat("x", 20)}, 10, 0), "empty batch always accepts")
+	batch.add(map[string]string{"a": "1"}, LokiEntry{Line: strings.Repeat("x", 6)}, "tracing", time.Now())
+	assert.True(t, batch.fits(LokiEntry{Line: "1234"}, 10, 0))
+	assert.False(t, batch.fits(LokiEntry{Line: "12345"}, 10, 0))
+	assert.False(t, batch.fits(LokiEntry{Line: "1", Metadata: map[string]string{"ab": "cd"}}, 10, 0), "metadata counts toward batch bytes")
+}
+
+func TestWaitLimiterSplitsAboveBurst(t *testing.T) {
+	limiter := newRateLimiter(1000, 10)
+	started := time.Now()
+	waitLimiter(limiter, 1500)
+	assert.GreaterOrEqual(t, time.Since(started), 400*time.Millisecond)
+}
+
+func TestBatchSeparatesTenants(t *testing.T) {
+	client := &fakeLokiClient{}
+	lm := newTestSetting(client, 100, time.Hour)
+	lm.Config = &LokiConfig{TenantID: "shared", TenantFromTracing: true}
+	labels := map[string]string{"data_type": "tracing"}
+	assert.NoError(t, lm.enqueueLog("tracing", lm.tenantFor("acme corp"), labels, "a"))
+	assert.NoError(t, lm.enqueueLog("tracing", lm.tenantFor(""), labels, "b"))
+	assert.NoError(t, lm.enqueueLog("tracing", lm.tenantFor("acme corp"), labels, "c"))
+	lm.shutdownWriter()
+
+	assert.ElementsMatch(t, []string{"acme_corp", "shared"}, client.tenants)
+	for i, tenant := range client.tenants {
+		if tenant == "acme_corp" {
+			assert.Len(t, client.pushes[i][0].Entries, 2)
+		} else {
+			assert.Len(t, client.pushes[i][0].Entries, 1)
+		}
+	}
+}
+
+func TestNormalizeTenantID(t *testing.T) {
+	assert.Equal(t, "tenant-1", normalizeTenantID(" tenant-1 "))
+	assert.Equal(t, "a_b_c", normalizeTenantID("a/b c"))
+	assert.Equal(t, "", normalizeTenantID(".."))
+	assert.Len(t, normalizeTenantID(strings.Repeat("x", 200)), maxTenantIDLength)
+}
+
+func TestStructuredMetadata(t *testing.T) {
+	fields, unknown := resolveMetadataFields([]string{"TraceID", "operator", "client-ip", "trace_id", "nope"})
+	assert.Equal(t, []string{"trace_id", "operator", "client_ip"}, fields)
+	assert.Equal(t, []string{"nope"}, unknown)
+
+	client := &fakeLokiClient{}
+	lm := newTestSetting(client, 100, time.Hour)
+	lm.MaxBytes = 1024
+	lm.metadataFields = fields
+	lm.FixedHeaders = map[string]string{}
+	tr := monitor.TracingDetails{TraceID: "t-1", Operator: "alice", Uri: "/v1/orders", Body: []byte(strings.Repeat("x", 2048))}
+	assert.NoError(t, lm.ReportTracing(tr))
+	lm.shutdownWriter()
+
+	if assert.Len(t, client.pushes, 1) {
+		entries := client.pushes[0][0].Entries
+		assert.Greater(t, len(entries), 1, "large line is split")
+		for _, entry := range entries {
+			assert.Equal(t, map[string]string{"trace_id": "t-1", "operator": "alice"}, entry.Metadata)
+		}
+		assert.NotContains(t, client.pushes[0][0].Labels, "trace_id")
+	}
+}
+
+func TestEventTimestampsAndOrdering(t *testing.T) {
+	client := &fakeLokiClient{}
+	lm := newTestSetting(client, 100, time.Hour)
+	lm.MaxBytes = 64
+	labels := map[string]string{"data_type": "tracing"}
+	started := time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, lm.enqueueEntry("tracing", "", labels, nil, started, strings.Repeat("x", 100)))
+	// 更早发生但更晚入队的日志会顺延到上一条之后，保持 stream 内递增。
+	assert.NoError(t, lm.enqueueEntry("tracing", "", labels, nil, started.Add(-time.Second), "late"))
+	assert.NoError(t, lm.enqueueEntry("tracing", "", labels, nil, started.Add(time.Second), "next"))
+	lm.shutdownWriter()
+
+	if !assert.Len(t, client.pushes, 1) {
+		return
+	}
+	entries := client.pushes[0][0].Entries
+	assert.Len(t, entries, 4)
+	assert.Equal(t, started, entries[0].Timestamp)
+	assert.Equal(t, started.Add(time.Nanosecond), entries[1].Timestamp, "split parts get ns offsets")
+	assert.Equal(t, started.Add(2*time.Nanosecond), entries[2].Timestamp)
+	assert.Equal(t, "late", entries[2].Line)
+	assert.Equal(t, started.Add(time.Second), entries[3].Timestamp)
+}
+
+func TestStreamClockPrune(t *testing.T) {
+	clock := newStreamClock()
+	now := time.Now()
+	clock.next("a", now.Add(-2*streamClockRetention))
+	clock.next("b", now)
+	clock.prune(now)
+	assert.NotContains(t, clock.last, "a")
+	assert.Contains(t, clock.last, "b")
+}
@@ -0,0 +1,105 @@
+package loki
+
+import (
+	"strings"
+	"sync"
+)
+
+// labelGuard 限制每个 label 的不同取值数量，防止模板引入高基数字段导致 stream 数量失控。
+// 取值在进程生命周期内累计；超出上限的新取值按 overflow 归入 bucket 或直接丢弃该 label。
+// nil 表示不限制。
+type labelGuard struct {
+	mu           sync.Mutex
+	defaultLimit int
+	limits       map[string]int
+	overflow     string
+	bucket       string
+	seen         map[string]map[string]struct{}
+	rejected     map[string]int
+}
+
+// newLabelGuard 创建 label 基数限制。
+// defaultLimit: 每个 label 的默认取值上限，<= 0 表示不限制。
+// limits: 按 label 名覆盖上限，<= 0 表示该 label 不限制。
+// overflow: 超限处理方式 bucket/drop，默认 bucket。
+// bucket: bucket 模式下超限取值替换成的值，默认 _other。
+// 返回值：未配置任何上限时返回 nil。
+func newLabelGuard(defaultLimit int, limits map[string]int, overflow string, bucket string) *labelGuard {
+	normalized := map[string]int{}
+	hasLimit := defaultLimit > 0
+	for name, limit := range limits {
+		normalized[normalizeLokiLabelName(name)] = limit
+		hasLimit = hasLimit || limit > 0
+	}
+	if !hasLimit {
+		return nil
+	}
+	overflow = strings.ToLower(strings.TrimSpace(overflow))
+	if overflow != LabelOverflowDrop {
+		overflow = LabelOverflowBucket
+	}
+	if bucket == "" {
+		bucket = defaultOverflowBucket
+	}
+	return &labelGuard{
+		defaultLimit: defaultLimit,
+		limits:       normalized,
+		overflow:     overflow,
+		bucket:       bucket,
+		seen:         map[string]map[string]struct{}{},
+		rejected:     map[string]int{},
+	}
+}
+
+// admit 检查 label 取值是否在上限内。
+// 返回值：实际写入的取值，以及是否保留该 label。
+func (g *labelGuard) admit(label string, value string) (string, bool) {
+	if g == nil {
+		return value, true
+	}
+	limit, ok := g.limits[label]
+	if !ok {
+		limit = g.defaultLimit
+	}
+	if limit <= 0 {
+		return value, true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	values := g.seen[label]
+	if values == nil {
+		values = map[string]struct{}{}
+		g.seen[label] = values
+	}
+	if _, ok := values[value]; ok {
+		return value, true
+	}
+	if len(values) < limit {
+		values[value] = struct{}{}
+		return value, true
+	}
+	g.rejected[label]++
+	if g.overflow == LabelOverflowDrop {
+		return "", false
+	}
+	return g.bucket, true
+}
+
+// stats 返回各 label 当前的取值数量与被归并/丢弃的次数，用于日志观测。
+func (g *labelGuard) stats() (map[string]int, map[string]int) {
+	if g == nil {
+		return nil, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	distinct := make(map[string]int, len(g.seen))
+	for label, values := range g.seen {
+		distinct[label] = len(values)
+	}
+	rejected := make(map[string]int, len(g.rejected))
+	for label, count := range g.rejected {
+		rejected[label] = count
+	}
+	return distinct, rejected
+}
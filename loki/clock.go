@@ -0,0 +1,43 @@
+package loki
+
+import "time"
+
+// streamClockRetention 超过该时长未写入的 stream 不再跟踪，与 Loki 默认的乱序接收窗口（max_chunk_age/2）一致。
+const streamClockRetention = time.Hour
+
+// streamClock 记录每个 stream（租户 + labels）最近一次写入的时间戳，保证同一 stream 内的时间戳严格递增。
+// 仅由 writer 协程使用，无需加锁。
+type streamClock struct {
+	last map[string]time.Time
+}
+
+func newStreamClock() *streamClock {
+	return &streamClock{last: map[string]time.Time{}}
+}
+
+// next 计算一条日志实际写入的时间戳。
+// key: stream 标识。
+// ts: 事件时间；早于或等于该 stream 上一条日志时顺延到上一条之后 1ns，避免 Loki 以 out of order 拒绝。
+// 返回值：写入使用的时间戳。
+func (c *streamClock) next(key string, ts time.Time) time.Time {
+	if last, ok := c.last[key]; ok && !ts.After(last) {
+		ts = last.Add(time.Nanosecond)
+	}
+	c.last[key] = ts
+	return ts
+}
+
+// prune 清理长时间没有新日志的 stream。
+// now: 当前时间。
+func (c *streamClock) prune(now time.Time) {
+	for key, last := range c.last {
+		if now.Sub(last) > streamClockRetention {
+			delete(c.last, key)
+		}
+	}
+}
+
+// streamKey 生成 stream 标识，X-Scope-OrgID 不同的 stream 相互独立。
+func streamKey(tenant string, labels map[string]string) string {
+	return tenant + "\x00" + formatLabels(labels)
+}
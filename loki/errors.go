@@ -0,0 +1,149 @@
+package loki
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultMaxPushAttempts = 10
+	// maxRetryAfter Retry-After 超过该值时按该值等待，避免异常响应阻塞 writer 过久。
+	maxRetryAfter = 5 * time.Minute
+)
+
+// PushError Loki 写入失败的详细信息。
+// Status: REST 响应状态码；请求未得到响应（网络错误、超时）或使用 gRPC 时为 0。
+// Code: gRPC 状态码；REST 请求时为 codes.OK。
+// RetryAfter: 服务端要求的等待时间，未返回时为 0。
+// Body: REST 响应体或 gRPC 错误信息。
+// Err: 底层错误。
+type PushError struct {
+	Status     int
+	Code       codes.Code
+	RetryAfter time.Duration
+	Body       string
+	Err        error
+}
+
+func (e *PushError) Error() string {
+	var parts []string
+	if e.Status != 0 {
+		parts = append(parts, fmt.Sprintf("status=%d", e.Status))
+	}
+	if e.Code != codes.OK {
+		parts = append(parts, "code="+e.Code.String())
+	}
+	if e.RetryAfter > 0 {
+		parts = append(parts, "retryAfter="+e.RetryAfter.String())
+	}
+	if e.Body != "" {
+		parts = append(parts, "body="+e.Body)
+	} else if e.Err != nil {
+		parts = append(parts, e.Err.Error())
+	}
+	return strings.Join(parts, " ")
+}
+
+func (e *PushError) Unwrap() error { return e.Err }
+
+// retryAction 写入失败后的处理方式。
+type retryAction int
+
+const (
+	// actionDrop 请求本身有问题（乱序、超长、认证失败等），重试不会成功，直接丢弃。
+	actionDrop retryAction = iota
+	// actionRetry 限流或服务端暂时不可用，退避后重试。
+	actionRetry
+)
+
+// rejectedReasons Loki 以 400 / InvalidArgument 拒绝的典型原因（响应体关键字 => 分类），仅用于日志统计。
+var rejectedReasons = []struct{ keyword, reason string }{
+	{"out of order", "out_of_order"},
+	{"too far behind", "out_of_order"},
+	{"too old", "too_old"},
+	{"max entry size", "too_large"},
+	{"line too long", "too_large"},
+	{"too large", "too_large"},
+	{"exceed", "limit_exceeded"},
+	{"invalid", "invalid"},
+}
+
+// classifyPushError 根据错误类型决定重试策略。
+// 返回值：处理方式与用于日志的原因。
+func classifyPushError(err error) (retryAction, string) {
+	var pushErr *PushError
+	if !errors.As(err, &pushErr) {
+		// 非 PushError 来自本地编码等失败，重试不会改变结果。
+		return actionDrop, "local"
+	}
+	switch {
+	case pushErr.Status == http.StatusTooManyRequests:
+		return actionRetry, "rate_limited"
+	case pushErr.Status == http.StatusRequestTimeout || pushErr.Status >= 500:
+		return actionRetry, "server_error"
+	case pushErr.Status != 0:
+		return actionDrop, rejectedReason(pushErr)
+	}
+	switch pushErr.Code {
+	case codes.ResourceExhausted:
+		return actionRetry, "rate_limited"
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.Internal, codes.Unknown, codes.Canceled:
+		return actionRetry, "server_error"
+	case codes.OK:
+		// 未收到响应：连接失败、超时等网络错误。
+		return actionRetry, "network"
+	default:
+		return actionDrop, rejectedReason(pushErr)
+	}
+}
+
+func rejectedReason(pushErr *PushError) string {
+	body := strings.ToLower(pushErr.Body)
+	for _, item := range rejectedReasons {
+		if strings.Contains(body, item.keyword) {
+			return item.reason
+		}
+	}
+	return "rejected"
+}
+
+// parseRetryAfter 解析 Retry-After，支持秒数与 HTTP 日期两种格式。
+// 返回值：等待时间；无法解析或已过期时返回 0。
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		wait = at.Sub(now)
+	}
+	if wait <= 0 {
+		return 0
+	}
+	return min(wait, maxRetryAfter)
+}
+
+// newGrpcPushError 将 gRPC 调用错误转换为 PushError。
+// trailer: 响应 trailer，可能携带 retry-after。
+func newGrpcPushError(err error, trailer metadata.MD) *PushError {
+	st, ok := status.FromError(err)
+	if !ok {
+		return &PushError{Code: codes.Unknown, Err: err}
+	}
+	pushErr := &PushError{Code: st.Code(), Body: st.Message(), Err: err}
+	if values := trailer.Get("retry-after"); len(values) > 0 {
+		pushErr.RetryAfter = parseRetryAfter(values[0], time.Now())
+	}
+	return pushErr
+}
@@ -0,0 +1,112 @@
+package loki
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestClassifyPushError(t *testing.T) {
+	cases := []struct {
+		err    error
+		action retryAction
+		reason string
+	}{
+		{&PushError{Status: http.StatusBadRequest, Body: "entry with timestamp 2024 ignored, reason: 'entry out of order'"}, actionDrop, "out_of_order"},
+		{&PushError{Status: http.StatusBadRequest, Body: "Max entry size '262144' bytes exceeded"}, actionDrop, "too_large"},
+		// 4xx 响应体中出现 eof 也不应重试。
+		{&PushError{Status: http.StatusUnauthorized, Body: "unexpected EOF in token"}, actionDrop, "rejected"},
+		{&PushError{Status: http.StatusTooManyRequests}, actionRetry, "rate_limited"},
+		{&PushError{Status: http.StatusBadGateway, Body: "bad gateway"}, actionRetry, "server_error"},
+		{fmt.Errorf("wrapped: %w", &PushError{Err: errors.New("dial tcp: connection refused")}), actionRetry, "network"},
+		{&PushError{Code: codes.ResourceExhausted}, actionRetry, "rate_limited"},
+		{&PushError{Code: codes.Unavailable}, actionRetry, "server_error"},
+		{&PushError{Code: codes.InvalidArgument, Body: "entry too far behind"}, actionDrop, "out_of_order"},
+		{errors.New("marshal failed"), actionDrop, "local"},
+	}
+	for _, c := range cases {
+		action, reason := classifyPushError(c.err)
+		assert.Equal(t, c.action, action, c.err.Error())
+		assert.Equal(t, c.reason, reason, c.err.Error())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	assert.Equal(t, 10*time.Second, parseRetryAfter(now.Add(10*time.Second).Format(http.TimeFormat), now))
+	assert.Equal(t, maxRetryAfter, parseRetryAfter("86400", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+	assert.Zero(t, parseRetryAfter("-1", now))
+}
+
+func TestGrpcPushError(t *testing.T) {
+	err := newGrpcPushError(status.Error(codes.ResourceExhausted, "ingestion rate limit exceeded"), metadata.Pairs("retry-after", "2"))
+	assert.Equal(t, codes.ResourceExhausted, err.Code)
+	assert.Equal(t, 2*time.Second, err.RetryAfter)
+	assert.Contains(t, err.Error(), "code=ResourceExhausted")
+}
+
+// scriptedLokiClient 按顺序返回预设的错误。
+type scriptedLokiClient struct {
+	mu       sync.Mutex
+	errs     []error
+	attempts int
+}
+
+func (s *scriptedLokiClient) Push(tenant string, streams []LokiStream) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if len(s.errs) == 0 {
+		return nil
+	}
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func (s *scriptedLokiClient) Close() error { return nil }
+
+func TestPushWithRetryPolicies(t *testing.T) {
+	newBatch := func() *lokiBatch {
+		batch := newLokiBatch("")
+		batch.add(map[string]string{"a": "b"}, LokiEntry{Timestamp: time.Now(), Line: "x"}, "tracing", time.Now())
+		return batch
+	}
+
+	drop := &scriptedLokiClient{errs: []error{&PushError{Status: http.StatusBadRequest, Body: "entry out of order"}}}
+	lm := newTestSetting(drop, 100, time.Hour)
+	assert.True(t, lm.pushWithRetry(newBatch()))
+	assert.Equal(t, 1, drop.attempts, "out of order is dropped without retry")
+
+	recovered := &scriptedLokiClient{errs: []error{&PushError{Status: http.StatusServiceUnavailable}, &PushError{Status: http.StatusTooManyRequests}}}
+	lm.client = recovered
+	assert.True(t, lm.pushWithRetry(newBatch()))
+	assert.Equal(t, 3, recovered.attempts)
+
+	exhausted := &scriptedLokiClient{}
+	for i := 0; i < 10; i++ {
+		exhausted.errs = append(exhausted.errs, &PushError{Status: http.StatusInternalServerError})
+	}
+	lm.client = exhausted
+	lm.maxPushAttempts = 4
+	assert.True(t, lm.pushWithRetry(newBatch()))
+	assert.Equal(t, 4, exhausted.attempts)
+
+	honour := &scriptedLokiClient{errs: []error{&PushError{Status: http.StatusTooManyRequests, RetryAfter: 50 * time.Millisecond}}}
+	lm.client = honour
+	started := time.Now()
+	assert.True(t, lm.pushWithRetry(newBatch()))
+	assert.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond, "Retry-After overrides shorter backoff")
+	lm.client = &fakeLokiClient{}
+	lm.shutdownWriter()
+}
@@ -10,7 +10,9 @@ import (
 
 	"github.com/grafana/loki/pkg/push"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 type GrpcClient struct {
@@ -43,15 +45,28 @@ func NewGrpcClient(conf *LokiConfig) (*GrpcClient, error) {
 	address = strings.TrimPrefix(address, "http://")
 	address = strings.TrimPrefix(address, "https://")
 
+	tlsConf, err := buildTLSConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	transportCreds := insecure.NewCredentials()
+	if tlsConf != nil {
+		transportCreds = credentials.NewTLS(tlsConf)
+	}
 	opts := []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(transportCreds),
 	}
 
-	if conf.User != "" || conf.Password != "" {
+	if conf.BearerToken != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(&BearerTokenCreds{
+			Token: conf.BearerToken,
+			TLS:   tlsConf != nil,
+		}))
+	} else if conf.User != "" || conf.Password != "" {
 		opts = append(opts, grpc.WithPerRPCCredentials(&BasicAuthCreds{
 			User:     conf.User,
 			Password: conf.Password,
-			TLS:      false, // Assume insecure for now as per previous config
+			TLS:      tlsConf != nil,
 		}))
 	}
 
@@ -72,36 +87,38 @@ func (c *GrpcClient) Close() error {
 	return c.conn.Close()
 }
 
-func (c *GrpcClient) Push(labels map[string]string, line string) error {
-	labelString := formatLabels(labels)
-
-	req := &push.PushRequest{
-		Streams: []push.Stream{
-			{
-				Labels: labelString,
-				Entries: []push.Entry{
-					{
-						Timestamp: time.Now(),
-						Line:      line,
-					},
-				},
-			},
-		},
+// toPushRequest 将 stream 转换为 Loki 原生 PushRequest，gRPC 与 REST protobuf 编码共用。
+func toPushRequest(streams []LokiStream) *push.PushRequest {
+	req := &push.PushRequest{Streams: make([]push.Stream, 0, len(streams))}
+	for _, stream := range streams {
+		entries := make([]push.Entry, 0, len(stream.Entries))
+		for _, entry := range stream.Entries {
+			entries = append(entries, push.Entry{
+				Timestamp:          entry.Timestamp,
+				Line:               entry.Line,
+				StructuredMetadata: toLabelsAdapter(entry.Metadata),
+			})
+		}
+		req.Streams = append(req.Streams, push.Stream{Labels: formatLabels(stream.Labels), Entries: entries})
 	}
+	return req
+}
 
-	var err error
-	backoff := 100 * time.Millisecond
-	for attempt := 0; attempt < 3; attempt++ {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		_, err = c.client.Push(ctx, req)
-		cancel()
-		if err == nil {
-			return nil
-		}
-		time.Sleep(backoff)
-		backoff *= 2
+func (c *GrpcClient) Push(tenant string, streams []LokiStream) error {
+	req := toPushRequest(streams)
+	parent := context.Background()
+	if tenant != "" {
+		parent = metadata.AppendToOutgoingContext(parent, HeaderScopeOrgID, tenant)
+	}
+
+	// 重试由 LokiSetting.pushWithRetry 按错误类型统一处理，这里只发送一次。
+	ctx, cancel := context.WithTimeout(parent, 5*time.Second)
+	defer cancel()
+	var trailer metadata.MD
+	if _, err := c.client.Push(ctx, req, grpc.Trailer(&trailer)); err != nil {
+		return fmt.Errorf("loki gRPC push failed: %w", newGrpcPushError(err, trailer))
 	}
-	return err
+	return nil
 }
 
 func formatLabels(labels map[string]string) string {
@@ -2,9 +2,9 @@ package loki
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -16,24 +16,58 @@ import (
 	"github.com/techquest-tech/gin-shared/pkg/schedule"
 	"github.com/techquest-tech/monitor"
 	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 )
 
 type LokiConfig struct {
-	URL                         string
-	User                        string
-	Password                    string
-	Protocol                    string
-	MaxBytes                    int
-	Included                    []string
-	Excluded                    []string
-	IncludedIPs                 []string
-	ExcludedIPs                 []string
-	QueueSize                   int
-	WritePauseMS                int
-	StartupPauseMS              int
-	StartupSlowStartSeconds     int
-	RetryPauseMS                int
-	MaxRetryPauseMS             int
+	URL      string
+	User     string
+	Password string
+	Protocol string
+	// Encoding REST 模式下的请求体编码：json（默认）、json+gzip、protobuf+snappy。
+	Encoding string
+	// BearerToken 配置后优先于 User/Password 使用 Bearer 认证。
+	BearerToken        string
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+	// TenantID 静态 X-Scope-OrgID；TenantFromTracing 为 true 时优先使用 TracingDetails.Tenant。
+	TenantID          string
+	TenantFromTracing bool
+	// StructuredMetadata 以 structured metadata 发送的 TracingDetails 字段，如 trace_id、operator、client_ip、device、uri。
+	StructuredMetadata []string
+	// Labels 各数据类型的 label 模板映射，未配置的类型沿用内置 labels；FixedLabels 为额外的固定 labels，启动时渲染一次。
+	Labels      LokiLabelTemplates
+	FixedLabels map[string]string
+	// LabelValueLimit 每个 label 的不同取值上限，LabelValueLimits 按 label 覆盖；超限后按 LabelOverflow（bucket/drop）处理。
+	LabelValueLimit  int
+	LabelValueLimits map[string]int
+	LabelOverflow    string
+	LabelBucket      string
+	// LineFormat 正文格式：json（默认）、logfmt、template；template 模式使用 LineTemplates。
+	LineFormat              string
+	LineTemplates           LokiLineTemplates
+	MaxBytes                int
+	Included                []string
+	Excluded                []string
+	IncludedIPs             []string
+	ExcludedIPs             []string
+	QueueSize               int
+	BatchMaxBytes           int
+	BatchMaxEntries         int
+	FlushIntervalMS         int
+	RateLimitBytesPerSecond int
+	RateLimitLinesPerSecond int
+	// WritePauseMS/StartupPauseMS/StartupSlowStartSeconds 已由 RateLimit* 取代，保留仅为兼容旧配置。
+	WritePauseMS            int
+	StartupPauseMS          int
+	StartupSlowStartSeconds int
+	RetryPauseMS            int
+	MaxRetryPauseMS         int
+	// MaxPushAttempts 单个批次最多尝试写入的次数（含首次），默认 10，超过后丢弃。
+	MaxPushAttempts             int
 	ShutdownFlushTimeoutSeconds int
 }
 
@@ -41,16 +75,22 @@ type LokiConfig struct {
 // labels: 本条日志的 Loki labels。
 // line: 待写入的正文内容。
 // source: 数据来源，用于定位是哪类日志触发了写入。
+// tenant: 写入 Loki 时使用的 X-Scope-OrgID，为空表示不发送。
+// metadata: structured metadata，拆分后的每个分片都会携带。
+// timestamp: 事件发生时间，作为 Loki 日志时间戳；拆分后的分片依次递增 1ns。
 // enqueuedAt: 入队时间，用于观测排队耗时。
 type lokiPushItem struct {
 	labels     map[string]string
+	tenant     string
+	metadata   map[string]string
+	timestamp  time.Time
 	line       string
 	source     string
 	enqueuedAt time.Time
 }
 
 // LokiSetting 管理 Loki 写入配置、缓存队列与后台消费协程。
-// 该类型负责把业务线程的同步直推改为“先缓存、再限速写入”。
+// 该类型负责把业务线程的同步直推改为“先缓存、按 labels 聚合成批、再限速写入”。
 type LokiSetting struct {
 	monitor.BaseFilter
 	// monitor.AppSettings
@@ -63,20 +103,25 @@ type LokiSetting struct {
 	workerDone           chan struct{}
 	queueMu              sync.RWMutex
 	queueClosed          bool
-	writePause           time.Duration
-	startupPause         time.Duration
-	startupSlowWindow    time.Duration
+	batchMaxBytes        int
+	batchMaxEntries      int
+	flushInterval        time.Duration
+	bytesLimiter         *rate.Limiter
+	linesLimiter         *rate.Limiter
 	retryPause           time.Duration
 	maxRetryPause        time.Duration
 	shutdownFlushTimeout time.Duration
-	startedAt            time.Time
+	maxPushAttempts      int
+	metadataFields       []string
+	templates            *lokiTemplates
+	labelGuard           *labelGuard
 }
 
 // LokiClient 抽象出 REST/gRPC 两种 Loki 客户端。
-// Push: 按 labels 与正文写入一条日志。
+// Push: 在一次请求中写入同一租户的多个 stream，tenant 为空时不发送 X-Scope-OrgID。
 // Close: 释放底层连接资源。
 type LokiClient interface {
-	Push(labels map[string]string, line string) error
+	Push(tenant string, streams []LokiStream) error
 	Close() error
 }
 
@@ -151,23 +196,6 @@ func pickDurationBySeconds(valueSeconds int, fallback time.Duration) time.Durati
 	return time.Duration(valueSeconds) * time.Second
 }
 
-// isRetryableLokiError 判断错误是否适合做退避重试。
-// err: Loki 推送返回的错误。
-// 返回值：true 表示可重试，false 表示应直接丢弃并记录错误。
-func isRetryableLokiError(err error) bool {
-	if err == nil {
-		return false
-	}
-	msg := strings.ToLower(err.Error())
-	return strings.Contains(msg, "429") ||
-		strings.Contains(msg, "too many requests") ||
-		strings.Contains(msg, "timeout") ||
-		strings.Contains(msg, "temporarily unavailable") ||
-		strings.Contains(msg, "connection reset") ||
-		strings.Contains(msg, "broken pipe") ||
-		strings.Contains(msg, "eof")
-}
-
 // cloneLabels 复制一份 labels，避免入队后被后续逻辑修改。
 // labels: 原始 label 集合。
 // 返回值：新的 label 副本。
@@ -216,13 +244,41 @@ func InitLokiMonitor(logger *zap.Logger) (*LokiSetting, error) {
 	}
 	loki.queue = make(chan lokiPushItem, queueSize)
 	loki.workerDone = make(chan struct{})
-	loki.writePause = pickDurationByMillis(conf.WritePauseMS, 80*time.Millisecond)
-	loki.startupPause = pickDurationByMillis(conf.StartupPauseMS, 250*time.Millisecond)
-	loki.startupSlowWindow = pickDurationBySeconds(conf.StartupSlowStartSeconds, 120*time.Second)
+	loki.batchMaxBytes = conf.BatchMaxBytes
+	if loki.batchMaxBytes <= 0 {
+		loki.batchMaxBytes = defaultBatchMaxBytes
+	}
+	loki.batchMaxEntries = conf.BatchMaxEntries
+	if loki.batchMaxEntries <= 0 {
+		loki.batchMaxEntries = defaultBatchMaxEntries
+	}
+	loki.flushInterval = pickDurationByMillis(conf.FlushIntervalMS, defaultFlushInterval)
+	bytesPerSecond := pickLimit(conf.RateLimitBytesPerSecond, defaultRateLimitBytesPerSec)
+	linesPerSecond := pickLimit(conf.RateLimitLinesPerSecond, defaultRateLimitLinesPerSec)
+	loki.bytesLimiter = newRateLimiter(bytesPerSecond, loki.batchMaxBytes)
+	loki.linesLimiter = newRateLimiter(linesPerSecond, loki.batchMaxEntries)
+	if conf.WritePauseMS > 0 || conf.StartupPauseMS > 0 || conf.StartupSlowStartSeconds > 0 {
+		logger.Warn("loki WritePauseMS/StartupPauseMS/StartupSlowStartSeconds are deprecated, use RateLimitBytesPerSecond/RateLimitLinesPerSecond instead")
+	}
 	loki.retryPause = pickDurationByMillis(conf.RetryPauseMS, 1500*time.Millisecond)
 	loki.maxRetryPause = pickDurationByMillis(conf.MaxRetryPauseMS, 15*time.Second)
+	loki.maxPushAttempts = conf.MaxPushAttempts
+	if loki.maxPushAttempts <= 0 {
+		loki.maxPushAttempts = defaultMaxPushAttempts
+	}
 	loki.shutdownFlushTimeout = pickDurationBySeconds(conf.ShutdownFlushTimeoutSeconds, 4*time.Second)
-	loki.startedAt = time.Now()
+	fields, unknown := resolveMetadataFields(conf.StructuredMetadata)
+	if len(unknown) > 0 {
+		logger.Warn("unknown loki structured metadata fields ignored", zap.Strings("fields", unknown))
+	}
+	loki.metadataFields = fields
+	templates, err := compileLokiTemplates(conf.Labels, conf.LineFormat, conf.LineTemplates)
+	if err != nil {
+		logger.Error("invalid loki label/line templates", zap.Error(err))
+		return nil, err
+	}
+	loki.templates = templates
+	loki.labelGuard = newLabelGuard(conf.LabelValueLimit, conf.LabelValueLimits, conf.LabelOverflow, conf.LabelBucket)
 	loki.BaseFilter = monitor.BaseFilter{
 		Included: conf.Included,
 		Excluded: conf.Excluded,
@@ -265,17 +321,27 @@ func InitLokiMonitor(logger *zap.Logger) (*LokiSetting, error) {
 	}
 	logger.Info("connect to loki",
 		zap.String("protocol", used),
+		zap.String("encoding", normalizeEncoding(conf.Encoding)),
 		zap.String("url", conf.URL),
 		zap.String("user", conf.User),
-		zap.Bool("hasAuth", conf.User != "" || conf.Password != ""),
+		zap.Bool("hasAuth", conf.User != "" || conf.Password != "" || conf.BearerToken != ""),
+		zap.Bool("tls", tlsEnabled(conf)),
+		zap.String("tenantID", conf.TenantID),
+		zap.Bool("tenantFromTracing", conf.TenantFromTracing),
+		zap.Strings("structuredMetadata", loki.metadataFields),
+		zap.String("lineFormat", templates.lineFormat),
+		zap.Int("labelValueLimit", conf.LabelValueLimit),
 		zap.Strings("included", conf.Included),
 		zap.Strings("excluded", conf.Excluded),
 		zap.Int("queueSize", queueSize),
-		zap.Duration("writePause", loki.writePause),
-		zap.Duration("startupPause", loki.startupPause),
-		zap.Duration("startupSlowWindow", loki.startupSlowWindow),
+		zap.Int("batchMaxBytes", loki.batchMaxBytes),
+		zap.Int("batchMaxEntries", loki.batchMaxEntries),
+		zap.Duration("flushInterval", loki.flushInterval),
+		zap.Int("rateLimitBytesPerSecond", bytesPerSecond),
+		zap.Int("rateLimitLinesPerSecond", linesPerSecond),
 		zap.Duration("retryPause", loki.retryPause),
 		zap.Duration("maxRetryPause", loki.maxRetryPause),
+		zap.Int("maxPushAttempts", loki.maxPushAttempts),
 		zap.Duration("shutdownFlushTimeout", loki.shutdownFlushTimeout),
 	)
 
@@ -297,6 +363,11 @@ func InitLokiMonitor(logger *zap.Logger) (*LokiSetting, error) {
 		envfile = "default"
 	}
 	setLokiLabel(loki.FixedHeaders, "env", envfile)
+	fixed := fixedLabelData{AppName: core.AppName, Version: core.Version, Hostname: hostname, Env: envfile}
+	if err := renderFixedLabels(conf.FixedLabels, fixed, loki.FixedHeaders); err != nil {
+		logger.Error("invalid loki fixed labels", zap.Error(err))
+		return nil, err
+	}
 
 	go loki.runWriter()
 	logger.Info("Loki monitor service is ready.")
@@ -307,28 +378,62 @@ func InitLokiMonitor(logger *zap.Logger) (*LokiSetting, error) {
 // req: 定时任务执行记录。
 // 返回值：仅在序列化失败时返回错误；入队异常由内部日志处理，不影响主流程。
 func (lm *LokiSetting) ReportScheduleJob(req schedule.JobHistory) error {
+	// JobHistory 不带时间字段，任务结束时即上报，以收到记录的时间作为结束时间，不受排队与重试影响。
+	finishedAt := time.Now()
 	header := lm.cloneFixedHeader()
 	setLokiLabel(header, "data_type", "cron_job")
-	setLokiLabel(header, "app", req.App)
-	setLokiLabel(header, "succeed", strconv.FormatBool(req.Succeed))
-	setLokiLabel(header, "job", req.Job)
+	lm.applyLabels(header, lm.lokiTemplates().schedule, req)
 
-	body, _ := json.Marshal(req)
-	return lm.enqueueLog("schedule", header, string(body))
+	line, err := lm.formatLine("schedule", req, func() (string, error) {
+		body, err := json.Marshal(req)
+		return string(body), err
+	})
+	if err != nil {
+		lm.Logger.Error("marshal job history failed.", zap.Error(err))
+		return err
+	}
+	return lm.enqueueEntry("schedule", lm.tenantFor(""), header, nil, finishedAt, line)
 }
 
 // ReportError 将错误日志写入本地缓存队列。
+// 正文为包含错误信息、Uri、调用栈、应用与发生时间的 JSON，并以 fingerprint label 标识同类错误。
 // rr: 错误上报对象。
 // 返回值：仅在正文编码失败等不可恢复场景下返回错误。
 func (lm *LokiSetting) ReportError(rr core.ErrorReport) error {
 	header := lm.cloneFixedHeader()
 	setLokiLabel(header, "data_type", "error")
-	setLokiLabel(header, "app", rr.AppName)
-	setLokiLabel(header, "version", rr.AppVersion)
 
-	bodyText, bodyEnc := monitor.EncodePayloadForText(rr.FullStack)
-	setLokiLabel(header, "stack_enc", bodyEnc)
-	return lm.enqueueLog("error", header, bodyText)
+	data := lokiErrorLine{
+		Uri:        rr.Uri,
+		AppName:    rr.AppName,
+		AppVersion: rr.AppVersion,
+		HappendAT:  rr.HappendAT,
+	}
+	if rr.Error != nil {
+		data.Message = rr.Error.Error()
+	}
+	if data.AppName == "" {
+		data.AppName = core.AppName
+	}
+	if data.AppVersion == "" {
+		data.AppVersion = core.Version
+	}
+	if data.HappendAT.IsZero() {
+		data.HappendAT = time.Now()
+	}
+	data.Stack, data.StackEnc = monitor.EncodePayloadForText(rr.FullStack)
+	data.Fingerprint = monitor.ErrorFingerprint(data.Message, rr.FullStack)
+
+	lm.applyLabels(header, lm.lokiTemplates().errors, data)
+	line, err := lm.formatLine("error", data, func() (string, error) {
+		body, err := json.Marshal(data)
+		return string(body), err
+	})
+	if err != nil {
+		lm.Logger.Error("marshal error report failed.", zap.Error(err))
+		return err
+	}
+	return lm.enqueueEntry("error", lm.tenantFor(""), header, nil, data.HappendAT, line)
 }
 
 // cloneFixedHeader 复制基础 labels，避免多个并发请求共用同一份 map。
@@ -347,44 +452,37 @@ func (lm *LokiSetting) cloneFixedHeader() map[string]string {
 func (lm *LokiSetting) ReportTracing(tr monitor.TracingDetails) error {
 	header := lm.cloneFixedHeader()
 	setLokiLabel(header, "data_type", "tracing")
-	// optionname 属于业务侧强诉求的查询维度，保留在 label 中便于按功能点聚合检索。
-	setLokiLabel(header, "optionname", tr.Optionname)
-	setLokiLabel(header, "method", tr.Method)
-	setLokiLabel(header, "status", fmt.Sprintf("%d", tr.Status))
-	setLokiLabel(header, "verbosity_level", fmt.Sprintf("%d", tr.VerbosityLevel))
-	app := tr.AppName
-	if app == "" {
-		app = core.AppName
-	}
-	version := tr.AppVersion
-	if version == "" {
-		version = core.Version
-	}
-	setLokiLabel(header, "app", app)
-	setLokiLabel(header, "version", version)
-	setLokiLabel(header, "tenant", tr.Tenant)
 	bodyText, _ := monitor.EncodePayloadForText(tr.Body)
 	respText, _ := monitor.EncodePayloadForText(tr.Resp)
 	// reqEnc/respEnc 不再作为 label 发送，避免 label 数量过多或引入额外维度导致写入被拒绝。
 	// 编码信息仍会保留在正文（TracingDetails.BodyEnc/RespEnc）中，便于后续解析与排查。
 
-	lokiTr := struct {
-		monitor.TracingDetails
-		Body string
-		Resp string
-	}{
+	lokiTr := lokiTracingLine{
 		TracingDetails: tr,
 		Body:           bodyText,
 		Resp:           respText,
 	}
+	// label 中的 app/version 缺省时回退到当前应用；正文保持原始上报值。
+	labelData := lokiTr
+	if labelData.AppName == "" {
+		labelData.AppName = core.AppName
+	}
+	if labelData.AppVersion == "" {
+		labelData.AppVersion = core.Version
+	}
+	// 默认映射中的 optionname 属于业务侧强诉求的查询维度，保留在 label 中便于按功能点聚合检索。
+	lm.applyLabels(header, lm.lokiTemplates().tracing, labelData)
 
-	body, err := json.Marshal(lokiTr)
+	line, err := lm.formatLine("tracing", lokiTr, func() (string, error) {
+		body, err := json.Marshal(lokiTr)
+		return string(body), err
+	})
 	if err != nil {
 		lm.Logger.Error("marshal details failed.", zap.Error(err))
 		return err
 	}
 
-	return lm.enqueueLog("tracing", header, string(body))
+	return lm.enqueueEntry("tracing", lm.tenantFor(tr.Tenant), header, lm.structuredMetadata(&tr), tr.StartedAt, line)
 }
 
 // splitUTF8ByBytes 按字节数拆分字符串，并尽量保证 UTF-8 边界完整。
@@ -455,15 +553,30 @@ func splitWithPrefix(s string, max int) []string {
 
 // enqueueLog 将日志正文先写入本地缓存队列，避免业务线程直接阻塞在 Loki。
 // source: 数据来源类型，如 tracing/error/schedule。
+// tenant: X-Scope-OrgID，为空表示不发送。
 // labels: Loki labels。
 // line: 待写入的正文。
 // 返回值：队列写入失败时也返回 nil，仅通过内部日志告警，避免监控链路反向影响业务。
-func (lm *LokiSetting) enqueueLog(source string, labels map[string]string, line string) error {
+func (lm *LokiSetting) enqueueLog(source string, tenant string, labels map[string]string, line string) error {
+	return lm.enqueueEntry(source, tenant, labels, nil, time.Time{}, line)
+}
+
+// enqueueEntry 与 enqueueLog 相同，额外携带 structured metadata 与事件时间。
+// metadata: structured metadata，为 nil 表示不发送。
+// timestamp: 事件发生时间，零值表示使用入队时间。
+func (lm *LokiSetting) enqueueEntry(source string, tenant string, labels map[string]string, metadata map[string]string, timestamp time.Time, line string) error {
+	now := time.Now()
+	if timestamp.IsZero() {
+		timestamp = now
+	}
 	item := lokiPushItem{
 		labels:     cloneLabels(labels),
+		tenant:     tenant,
+		metadata:   metadata,
+		timestamp:  timestamp,
 		line:       line,
 		source:     source,
-		enqueuedAt: time.Now(),
+		enqueuedAt: now,
 	}
 
 	lm.queueMu.RLock()
@@ -498,70 +611,122 @@ func (lm *LokiSetting) enqueueLog(source string, labels map[string]string, line
 	}
 }
 
-// runWriter 持续消费缓存队列，并按限速策略写入 Loki。
+// runWriter 持续消费缓存队列，按 labels 聚合成批，达到字节/条数上限或到达 flushInterval 时写入 Loki。
 // 返回值：无。
 func (lm *LokiSetting) runWriter() {
 	defer close(lm.workerDone)
 	lm.Logger.Info("[loki-buffer] writer started",
 		zap.Int("capacity", cap(lm.queue)),
-		zap.Duration("writePause", lm.writePause),
-		zap.Duration("startupPause", lm.startupPause),
+		zap.Int("batchMaxBytes", lm.batchMaxBytes),
+		zap.Int("batchMaxEntries", lm.batchMaxEntries),
+		zap.Duration("flushInterval", lm.flushInterval),
 	)
-	for item := range lm.queue {
-		lm.flushBufferedItem(item)
+	ticker := time.NewTicker(lm.flushInterval)
+	defer ticker.Stop()
+
+	// X-Scope-OrgID 是请求级头部，不同租户的日志必须分开发送。
+	batches := map[string]*lokiBatch{}
+	// 日志使用事件时间而非发送时间，排队与重试不会改变时间戳；clock 保证同一 stream 内严格递增。
+	clock := newStreamClock()
+	for {
+		select {
+		case item, ok := <-lm.queue:
+			if !ok {
+				for _, batch := range batches {
+					lm.flushBatch(batch)
+				}
+				lm.Logger.Info("[loki-buffer] writer stopped")
+				return
+			}
+			batch, exists := batches[item.tenant]
+			if !exists {
+				batch = newLokiBatch(item.tenant)
+				batches[item.tenant] = batch
+			}
+			key := streamKey(item.tenant, item.labels)
+			for i, part := range splitWithPrefix(item.line, lm.MaxBytes) {
+				ts := clock.next(key, item.timestamp.Add(time.Duration(i)))
+				entry := LokiEntry{Timestamp: ts, Line: part, Metadata: item.metadata}
+				if !batch.fits(entry, lm.batchMaxBytes, lm.batchMaxEntries) {
+					lm.flushBatch(batch)
+					batch = newLokiBatch(item.tenant)
+					batches[item.tenant] = batch
+				}
+				batch.add(item.labels, entry, item.source, item.enqueuedAt)
+			}
+		case now := <-ticker.C:
+			for tenant, batch := range batches {
+				lm.flushBatch(batch)
+				delete(batches, tenant)
+			}
+			clock.prune(now)
+		}
 	}
-	lm.Logger.Info("[loki-buffer] writer stopped")
 }
 
-// flushBufferedItem 将单条缓存消息拆分、重试并最终写入 Loki。
-// item: 待落库的缓存消息。
+// flushBatch 限速后将一批日志写入 Loki。
+// batch: 待写入的批次。
 // 返回值：无，内部负责记录完整日志。
-func (lm *LokiSetting) flushBufferedItem(item lokiPushItem) {
-	parts := splitWithPrefix(item.line, lm.MaxBytes)
-	for idx, part := range parts {
-		if !lm.pushWithRetry(item, part, idx+1, len(parts)) {
-			return
-		}
-		lm.sleepBetweenWrites()
+func (lm *LokiSetting) flushBatch(batch *lokiBatch) {
+	if batch.empty() {
+		return
+	}
+	if !lm.isQueueClosed() {
+		waitLimiter(lm.linesLimiter, batch.entries)
+		waitLimiter(lm.bytesLimiter, batch.bytes)
+	}
+	if !lm.pushWithRetry(batch) {
+		return
 	}
 
-	queueDelay := time.Since(item.enqueuedAt)
+	queueDelay := time.Since(batch.oldest)
 	if queueDelay >= 3*time.Second {
-		lm.Logger.Info("[loki-buffer] buffered message flushed",
-			zap.String("source", item.source),
+		lm.Logger.Info("[loki-buffer] buffered batch flushed",
+			zap.Any("sources", batch.sources),
+			zap.Int("entries", batch.entries),
+			zap.Int("bytes", batch.bytes),
 			zap.Duration("queueDelay", queueDelay),
 			zap.Int("pending", len(lm.queue)),
 		)
 	}
 }
 
-// pushWithRetry 写入单个分片，并在 429/超时等可恢复错误上执行退避重试。
-// item: 当前处理的缓存消息。
-// line: 当前分片正文。
-// partIndex: 当前分片序号，从 1 开始。
-// totalParts: 当前消息的总分片数。
-// 返回值：true 表示可以继续处理；false 表示停机阶段应尽快结束当前消息。
-func (lm *LokiSetting) pushWithRetry(item lokiPushItem, line string, partIndex int, totalParts int) bool {
+// pushWithRetry 写入一个批次，按错误类型决定丢弃或退避重试。
+// 乱序、超长、认证失败等请求错误直接丢弃；429、5xx 与网络错误退避重试并遵循 Retry-After，最多尝试 maxPushAttempts 次。
+// batch: 当前处理的批次。
+// 返回值：true 表示已写入或已丢弃；false 表示停机阶段放弃重试。
+func (lm *LokiSetting) pushWithRetry(batch *lokiBatch) bool {
+	streams := batch.list()
 	backoff := lm.retryPause
+	maxAttempts := lm.maxPushAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxPushAttempts
+	}
 	for attempt := 1; ; attempt++ {
-		err := lm.client.Push(item.labels, line)
+		err := lm.client.Push(batch.tenant, streams)
 		if err == nil {
 			if attempt > 1 {
 				lm.Logger.Info("[loki-buffer] push recovered",
-					zap.String("source", item.source),
 					zap.Int("attempt", attempt),
-					zap.Int("partIndex", partIndex),
-					zap.Int("totalParts", totalParts),
+					zap.Int("entries", batch.entries),
 				)
 			}
 			return true
 		}
 
-		if !isRetryableLokiError(err) {
-			lm.Logger.Error("[loki-buffer] non-retryable push failed, drop message",
-				zap.String("source", item.source),
-				zap.Int("partIndex", partIndex),
-				zap.Int("totalParts", totalParts),
+		action, reason := classifyPushError(err)
+		if action == actionDrop || attempt >= maxAttempts {
+			msg := "[loki-buffer] non-retryable push failed, drop batch"
+			if action == actionRetry {
+				msg = "[loki-buffer] push attempts exhausted, drop batch"
+			}
+			lm.Logger.Error(msg,
+				zap.String("tenant", batch.tenant),
+				zap.String("reason", reason),
+				zap.Int("attempt", attempt),
+				zap.Any("sources", batch.sources),
+				zap.Int("streams", len(streams)),
+				zap.Int("entries", batch.entries),
 				zap.Error(err),
 			)
 			return true
@@ -569,8 +734,8 @@ func (lm *LokiSetting) pushWithRetry(item lokiPushItem, line string, partIndex i
 
 		if lm.isQueueClosed() && attempt >= 2 {
 			lm.Logger.Warn("[loki-buffer] stop retry because service is shutting down",
-				zap.String("source", item.source),
 				zap.Int("attempt", attempt),
+				zap.Int("entries", batch.entries),
 				zap.Error(err),
 			)
 			return false
@@ -579,36 +744,26 @@ func (lm *LokiSetting) pushWithRetry(item lokiPushItem, line string, partIndex i
 		if backoff > lm.maxRetryPause {
 			backoff = lm.maxRetryPause
 		}
+		wait := backoff
+		var pushErr *PushError
+		if errors.As(err, &pushErr) && pushErr.RetryAfter > wait {
+			wait = pushErr.RetryAfter
+		}
 		lm.Logger.Warn("[loki-buffer] retry push after backoff",
-			zap.String("source", item.source),
 			zap.Int("attempt", attempt),
-			zap.Duration("backoff", backoff),
+			zap.String("reason", reason),
+			zap.Duration("backoff", wait),
+			zap.Int("entries", batch.entries),
 			zap.Int("pending", len(lm.queue)),
 			zap.Error(err),
 		)
-		time.Sleep(backoff)
+		time.Sleep(wait)
 		if backoff < lm.maxRetryPause {
 			backoff *= 2
 		}
 	}
 }
 
-// sleepBetweenWrites 在每次实际写入 Loki 后主动暂停，平滑重启后的突发流量。
-// 返回值：无。
-func (lm *LokiSetting) sleepBetweenWrites() {
-	if lm.isQueueClosed() {
-		return
-	}
-	pause := lm.writePause
-	if time.Since(lm.startedAt) <= lm.startupSlowWindow && lm.startupPause > pause {
-		pause = lm.startupPause
-	}
-	if pause <= 0 {
-		return
-	}
-	time.Sleep(pause)
-}
-
 // isQueueClosed 判断 writer 是否已经进入停机排空阶段。
 // 返回值：true 表示队列已关闭。
 func (lm *LokiSetting) isQueueClosed() bool {
@@ -651,6 +806,13 @@ func (lm *LokiSetting) shutdownWriter() {
 		)
 	}
 
+	if distinct, rejected := lm.labelGuard.stats(); len(rejected) > 0 {
+		lm.Logger.Warn("[loki-buffer] label values exceeded cardinality limit",
+			zap.Any("distinct", distinct),
+			zap.Any("rejected", rejected),
+		)
+	}
+
 	if err := lm.client.Close(); err != nil {
 		lm.Logger.Warn("[loki-buffer] close client failed", zap.Error(err))
 	}
@@ -661,7 +823,7 @@ func (lm *LokiSetting) shutdownWriter() {
 // line: 待写入正文。
 // 返回值：当前实现通常返回 nil。
 func (lm *LokiSetting) pushSplit(labels map[string]string, line string) error {
-	return lm.enqueueLog("legacy", labels, line)
+	return lm.enqueueLog("legacy", lm.tenantFor(""), labels, line)
 }
 
 // EnableLokiMonitor 向容器注册 Loki 监控服务，并在启动时订阅监控事件。
@@ -0,0 +1,90 @@
+package loki
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/loki/pkg/push"
+	"github.com/techquest-tech/monitor"
+)
+
+// metadataFields 支持以 structured metadata 发送的 TracingDetails 字段。
+// 这些字段基数高，放入 labels 会导致 stream 数量爆炸，但作为 structured metadata 可在 LogQL 中直接过滤。
+var metadataFields = map[string]func(tr *monitor.TracingDetails) string{
+	"trace_id":       func(tr *monitor.TracingDetails) string { return tr.TraceID },
+	"span_id":        func(tr *monitor.TracingDetails) string { return tr.SpanID },
+	"parent_span_id": func(tr *monitor.TracingDetails) string { return tr.ParentSpanID },
+	"operator":       func(tr *monitor.TracingDetails) string { return tr.Operator },
+	"client_ip":      func(tr *monitor.TracingDetails) string { return tr.ClientIP },
+	"device":         func(tr *monitor.TracingDetails) string { return tr.Device },
+	"uri":            func(tr *monitor.TracingDetails) string { return tr.Uri },
+	"user_agent":     func(tr *monitor.TracingDetails) string { return tr.UserAgent },
+	"tenant":         func(tr *monitor.TracingDetails) string { return tr.Tenant },
+	"target_id": func(tr *monitor.TracingDetails) string {
+		if tr.TargetID == 0 {
+			return ""
+		}
+		return strconv.FormatUint(uint64(tr.TargetID), 10)
+	},
+}
+
+// resolveMetadataFields 将配置中的字段名解析为 metadataFields 中的名称。
+// 字段名大小写与下划线均不敏感，如 TraceID、traceId、trace_id 等价。
+// names: 配置的字段名列表。
+// 返回值：去重后的有效字段名与无法识别的字段名。
+func resolveMetadataFields(names []string) ([]string, []string) {
+	lookup := make(map[string]string, len(metadataFields))
+	for name := range metadataFields {
+		lookup[strings.ReplaceAll(name, "_", "")] = name
+	}
+	var fields, unknown []string
+	seen := map[string]bool{}
+	for _, raw := range names {
+		key := strings.ReplaceAll(normalizeLokiLabelName(raw), "_", "")
+		name, ok := lookup[key]
+		if !ok {
+			if strings.TrimSpace(raw) != "" {
+				unknown = append(unknown, raw)
+			}
+			continue
+		}
+		if !seen[name] {
+			seen[name] = true
+			fields = append(fields, name)
+		}
+	}
+	return fields, unknown
+}
+
+// structuredMetadata 提取本条 tracing 需要发送的 structured metadata。
+// tr: tracing 详情。
+// 返回值：字段名到值的映射，空值字段不发送；未配置任何字段时返回 nil。
+func (lm *LokiSetting) structuredMetadata(tr *monitor.TracingDetails) map[string]string {
+	if len(lm.metadataFields) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(lm.metadataFields))
+	for _, name := range lm.metadataFields {
+		if value := strings.TrimSpace(metadataFields[name](tr)); value != "" {
+			out[name] = value
+		}
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// toLabelsAdapter 将 metadata 转换为 push.LabelsAdapter，按名称排序保证输出稳定。
+func toLabelsAdapter(metadata map[string]string) push.LabelsAdapter {
+	if len(metadata) == 0 {
+		return nil
+	}
+	out := make(push.LabelsAdapter, 0, len(metadata))
+	for name, value := range metadata {
+		out = append(out, push.LabelAdapter{Name: name, Value: value})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
@@ -0,0 +1,503 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/carlmjohnson/requests"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+)
+
+const (
+	DirectionForward  = "forward"
+	DirectionBackward = "backward"
+
+	// defaultQueryPageSize 单次 query_range 请求的条数，低于 Loki 默认的 max_entries_limit_per_query(5000)。
+	defaultQueryPageSize = 1000
+)
+
+// partPrefix 匹配 splitWithPrefix 写入的分片前缀。
+var partPrefix = regexp.MustCompile(`^\[part (\d+)/(\d+)\] `)
+
+// QueryClient 基于 REST query_range 查询 Loki 中的监控日志，自动翻页并复原拆分写入的大报文。
+type QueryClient struct {
+	endpoint string
+	auth     string
+	tenant   string
+	pageSize int
+	client   *http.Client
+}
+
+// NewQueryClient 使用与写入相同的 Loki 配置（地址、认证、TLS、TenantID）创建查询客户端。
+// conf: Loki 配置。
+// 返回值：TLS 证书读取失败时返回错误。
+func NewQueryClient(conf *LokiConfig) (*QueryClient, error) {
+	if conf.URL == "" {
+		return nil, errors.New("loki URL is required")
+	}
+	client, err := newHTTPClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &QueryClient{
+		endpoint: strings.TrimRight(conf.URL, "/") + "/loki/api/v1/query_range",
+		auth:     authorizationHeader(conf),
+		tenant:   normalizeTenantID(conf.TenantID),
+		pageSize: defaultQueryPageSize,
+		client:   client,
+	}, nil
+}
+
+// QueryRangeRequest 一次范围查询。
+// Query: LogQL 日志查询，如 {data_type="tracing"} |= "trace-id"。
+// Start/End: 时间范围，End 为零值时取当前时间。
+// Limit: 最多返回的条数（复原前），0 表示不限制。
+// Direction: forward（默认）或 backward。
+// Tenant: 覆盖配置中的 TenantID，多租户可用 a|b。
+type QueryRangeRequest struct {
+	Query     string
+	Start     time.Time
+	End       time.Time
+	Limit     int
+	Direction string
+	Tenant    string
+}
+
+// QueryEntry 查询到的一条日志。
+// Incomplete: 分片未能全部找到时为 true，Line 保留带 [part i/n] 前缀的原始分片。
+type QueryEntry struct {
+	Labels     map[string]string
+	Timestamp  time.Time
+	Line       string
+	Metadata   map[string]string
+	Incomplete bool
+}
+
+type queryRangeResponse struct {
+	Status string `json:"status"`
+	Data   struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Stream map[string]string   `json:"stream"`
+			Values [][]json.RawMessage `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// QueryRange 分页执行 query_range，返回按时间排序的原始日志（未复原分片）。
+// 同一纳秒的日志可能跨页，边界处按 stream + 时间戳 + 正文去重。
+func (c *QueryClient) QueryRange(ctx context.Context, req QueryRangeRequest) ([]QueryEntry, error) {
+	if strings.TrimSpace(req.Query) == "" {
+		return nil, errors.New("loki query is required")
+	}
+	end := req.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	backward := strings.EqualFold(req.Direction, DirectionBackward)
+	start := req.Start
+
+	out := []QueryEntry{}
+	boundary := map[string]bool{}
+	var boundaryAt time.Time
+	for {
+		pageSize := c.pageSize
+		if req.Limit > 0 {
+			pageSize = min(pageSize, req.Limit-len(out))
+		}
+		page, err := c.queryPage(ctx, req, start, end, pageSize, backward)
+		if err != nil {
+			return nil, err
+		}
+
+		added := 0
+		for _, entry := range page {
+			key := entryKey(entry)
+			if boundary[key] {
+				continue
+			}
+			out = append(out, entry)
+			added++
+		}
+		if len(page) < pageSize || (req.Limit > 0 && len(out) >= req.Limit) {
+			return out, nil
+		}
+
+		// 下一页从本页最后一条的时间戳开始（Loki 的 start 包含、end 不包含），记录该时间戳上已返回的日志用于去重。
+		// 同一纳秒的日志超过 pageSize 时 Loki 无法继续翻页，只能跳过该纳秒。
+		last := page[len(page)-1].Timestamp
+		if !last.Equal(boundaryAt) {
+			boundary = map[string]bool{}
+			boundaryAt = last
+		}
+		for _, entry := range page {
+			if entry.Timestamp.Equal(last) {
+				boundary[entryKey(entry)] = true
+			}
+		}
+		if backward {
+			end = last.Add(time.Nanosecond)
+			if added == 0 {
+				end = last
+			}
+		} else {
+			start = last
+			if added == 0 {
+				start = last.Add(time.Nanosecond)
+			}
+		}
+		if !start.Before(end) {
+			return out, nil
+		}
+	}
+}
+
+// queryPage 执行一次 query_range 请求，返回按方向排序的日志。
+func (c *QueryClient) queryPage(ctx context.Context, req QueryRangeRequest, start, end time.Time, limit int, backward bool) ([]QueryEntry, error) {
+	direction := DirectionForward
+	if backward {
+		direction = DirectionBackward
+	}
+	params := url.Values{}
+	params.Set("query", req.Query)
+	params.Set("start", strconv.FormatInt(start.UnixNano(), 10))
+	params.Set("end", strconv.FormatInt(end.UnixNano(), 10))
+	params.Set("limit", strconv.Itoa(limit))
+	params.Set("direction", direction)
+
+	// categorize-labels 使 structured metadata 不再混入 stream labels，返回的 stream 可直接用作 selector。
+	builder := requests.URL(c.endpoint+"?"+params.Encode()).
+		Client(c.client).
+		Header("X-Loki-Response-Encoding-Flags", "categorize-labels")
+	if c.auth != "" {
+		builder = builder.Header("Authorization", c.auth)
+	}
+	tenant := c.tenant
+	if req.Tenant != "" {
+		tenant = req.Tenant
+	}
+	if tenant != "" {
+		builder = builder.Header(HeaderScopeOrgID, tenant)
+	}
+
+	resp := queryRangeResponse{}
+	err := builder.AddValidator(nil).Handle(func(r *http.Response) error {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		if r.StatusCode/100 != 2 {
+			return fmt.Errorf("status=%d body=%s", r.StatusCode, strings.TrimSpace(string(body)))
+		}
+		return json.Unmarshal(body, &resp)
+	}).Fetch(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("loki query_range failed: %w", err)
+	}
+	if resp.Data.ResultType != "streams" {
+		return nil, fmt.Errorf("loki query_range returned %q, a log query is required", resp.Data.ResultType)
+	}
+
+	out := []QueryEntry{}
+	for _, stream := range resp.Data.Result {
+		for _, value := range stream.Values {
+			entry, err := decodeQueryValue(stream.Stream, value)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, entry)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if backward {
+			return out[i].Timestamp.After(out[j].Timestamp)
+		}
+		return out[i].Timestamp.Before(out[j].Timestamp)
+	})
+	return out, nil
+}
+
+// decodeQueryValue 解析 values 中的一项：[ts, line] 或带 structured metadata 的 [ts, line, {...}]。
+func decodeQueryValue(labels map[string]string, value []json.RawMessage) (QueryEntry, error) {
+	if len(value) < 2 {
+		return QueryEntry{}, fmt.Errorf("unexpected loki value with %d items", len(value))
+	}
+	var tsText, line string
+	if err := json.Unmarshal(value[0], &tsText); err != nil {
+		return QueryEntry{}, fmt.Errorf("decode loki timestamp failed: %w", err)
+	}
+	if err := json.Unmarshal(value[1], &line); err != nil {
+		return QueryEntry{}, fmt.Errorf("decode loki line failed: %w", err)
+	}
+	ns, err := strconv.ParseInt(tsText, 10, 64)
+	if err != nil {
+		return QueryEntry{}, fmt.Errorf("decode loki timestamp failed: %w", err)
+	}
+	entry := QueryEntry{Labels: labels, Timestamp: time.Unix(0, ns), Line: line}
+	if len(value) > 2 {
+		// categorize-labels 编码下第三项为 {"structuredMetadata": {...}, "parsed": {...}}。
+		extra := struct {
+			StructuredMetadata map[string]string `json:"structuredMetadata"`
+		}{}
+		if err := json.Unmarshal(value[2], &extra); err == nil {
+			entry.Metadata = extra.StructuredMetadata
+		}
+	}
+	return entry, nil
+}
+
+func entryKey(entry QueryEntry) string {
+	return formatLabels(entry.Labels) + "\x00" + strconv.FormatInt(entry.Timestamp.UnixNano(), 10) + "\x00" + entry.Line
+}
+
+// parsePart 解析分片前缀。
+// 返回值：分片序号、总数与去掉前缀的正文；不是分片时 ok 为 false。
+func parsePart(line string) (index int, total int, body string, ok bool) {
+	match := partPrefix.FindStringSubmatch(line)
+	if match == nil {
+		return 0, 0, line, false
+	}
+	index, _ = strconv.Atoi(match[1])
+	total, _ = strconv.Atoi(match[2])
+	if index < 1 || total < 2 || index > total {
+		return 0, 0, line, false
+	}
+	return index, total, line[len(match[0]):], true
+}
+
+// Reassemble 将 splitWithPrefix 写入的 [part i/n] 分片按 stream 复原为完整日志。
+// 同一条日志的分片写入同一 stream 且时间戳连续；缺失分片时原样返回各分片并标记 Incomplete。
+// entries: QueryRange 返回的日志，任意方向。
+// 返回值：按时间正序排列的日志，复原后的时间戳取第一片的时间戳。
+func Reassemble(entries []QueryEntry) []QueryEntry {
+	sorted := make([]QueryEntry, len(entries))
+	copy(sorted, entries)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Timestamp.Before(sorted[j].Timestamp) })
+
+	type pending struct {
+		parts []QueryEntry
+		total int
+		body  strings.Builder
+	}
+	out := make([]QueryEntry, 0, len(sorted))
+	pendingByStream := map[string]*pending{}
+	flushIncomplete := func(p *pending) {
+		for _, part := range p.parts {
+			part.Incomplete = true
+			out = append(out, part)
+		}
+	}
+
+	for _, entry := range sorted {
+		index, total, body, ok := parsePart(entry.Line)
+		if !ok {
+			out = append(out, entry)
+			continue
+		}
+		key := formatLabels(entry.Labels)
+		p := pendingByStream[key]
+		if p != nil && (index != len(p.parts)+1 || total != p.total) {
+			flushIncomplete(p)
+			delete(pendingByStream, key)
+			p = nil
+		}
+		if p == nil {
+			if index != 1 {
+				entry.Incomplete = true
+				out = append(out, entry)
+				continue
+			}
+			p = &pending{total: total}
+			pendingByStream[key] = p
+		}
+		p.parts = append(p.parts, entry)
+		p.body.WriteString(body)
+		if len(p.parts) == p.total {
+			first := p.parts[0]
+			first.Line = p.body.String()
+			out = append(out, first)
+			delete(pendingByStream, key)
+		}
+	}
+	for _, p := range pendingByStream {
+		flushIncomplete(p)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Timestamp.Before(out[j].Timestamp) })
+	return out
+}
+
+// queryComplete 查询并复原分片，跳过不完整的日志。
+func (c *QueryClient) queryComplete(ctx context.Context, req QueryRangeRequest) ([]QueryEntry, error) {
+	entries, err := c.QueryRange(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := []QueryEntry{}
+	for _, entry := range Reassemble(entries) {
+		if !entry.Incomplete {
+			out = append(out, entry)
+		}
+	}
+	return out, nil
+}
+
+// DecodeTracing 将 tracing 日志（json 正文格式）还原为 TracingDetails，Body/Resp 按 BodyEnc/RespEnc 解码。
+func DecodeTracing(entry QueryEntry) (monitor.TracingDetails, error) {
+	line := lokiTracingLine{}
+	if err := json.Unmarshal([]byte(entry.Line), &line); err != nil {
+		return monitor.TracingDetails{}, fmt.Errorf("decode loki tracing line failed: %w", err)
+	}
+	tr := line.TracingDetails
+	var err error
+	if tr.Body, err = monitor.DecodePayloadText(line.Body, tr.BodyEnc); err != nil {
+		return tr, fmt.Errorf("decode tracing body failed: %w", err)
+	}
+	if tr.Resp, err = monitor.DecodePayloadText(line.Resp, tr.RespEnc); err != nil {
+		return tr, fmt.Errorf("decode tracing resp failed: %w", err)
+	}
+	return tr, nil
+}
+
+// DecodeError 将 error 日志还原为 ErrorReport，Error 字段以错误信息重建。
+// 兼容旧版正文仅为调用栈文本、编码与应用信息放在 labels 中的格式。
+func DecodeError(entry QueryEntry) (core.ErrorReport, error) {
+	line := lokiErrorLine{}
+	if strings.HasPrefix(entry.Line, "{") && json.Unmarshal([]byte(entry.Line), &line) == nil {
+		stack, err := monitor.DecodePayloadText(line.Stack, line.StackEnc)
+		if err != nil {
+			return core.ErrorReport{}, fmt.Errorf("decode error stack failed: %w", err)
+		}
+		report := core.ErrorReport{
+			Uri:        line.Uri,
+			FullStack:  stack,
+			HappendAT:  line.HappendAT,
+			AppName:    line.AppName,
+			AppVersion: line.AppVersion,
+		}
+		if line.Message != "" {
+			report.Error = errors.New(line.Message)
+		}
+		return report, nil
+	}
+
+	stack, err := monitor.DecodePayloadText(entry.Line, entry.Labels["stack_enc"])
+	if err != nil {
+		return core.ErrorReport{}, fmt.Errorf("decode error stack failed: %w", err)
+	}
+	return core.ErrorReport{
+		FullStack:  stack,
+		HappendAT:  entry.Timestamp,
+		AppName:    entry.Labels["app"],
+		AppVersion: entry.Labels["version"],
+	}, nil
+}
+
+// DecodeJob 将 cron job 日志还原为 JobHistory。
+func DecodeJob(entry QueryEntry) (schedule.JobHistory, error) {
+	job := schedule.JobHistory{}
+	if err := json.Unmarshal([]byte(entry.Line), &job); err != nil {
+		return job, fmt.Errorf("decode loki job line failed: %w", err)
+	}
+	return job, nil
+}
+
+// decodeAll 查询、复原并解码，返回第一个解码错误。
+func decodeAll[T any](ctx context.Context, c *QueryClient, req QueryRangeRequest, decode func(QueryEntry) (T, error)) ([]T, error) {
+	entries, err := c.queryComplete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]T, 0, len(entries))
+	for _, entry := range entries {
+		item, err := decode(entry)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+// QueryTracing 查询 tracing 日志并还原为 TracingDetails，req.Query 应选择 data_type="tracing" 的 stream。
+func (c *QueryClient) QueryTracing(ctx context.Context, req QueryRangeRequest) ([]monitor.TracingDetails, error) {
+	return decodeAll(ctx, c, req, DecodeTracing)
+}
+
+// QueryErrors 查询 error 日志并还原为 ErrorReport。
+func (c *QueryClient) QueryErrors(ctx context.Context, req QueryRangeRequest) ([]core.ErrorReport, error) {
+	return decodeAll(ctx, c, req, DecodeError)
+}
+
+// QueryJobs 查询 cron job 日志并还原为 JobHistory。
+func (c *QueryClient) QueryJobs(ctx context.Context, req QueryRangeRequest) ([]schedule.JobHistory, error) {
+	return decodeAll(ctx, c, req, DecodeJob)
+}
+
+// FindTrace 按 TraceID 查询一条链路上的全部请求（含完整请求体/响应体）。
+// traceID: W3C trace id。
+// start/end: 查询时间范围。
+func (c *QueryClient) FindTrace(ctx context.Context, traceID string, start, end time.Time) ([]monitor.TracingDetails, error) {
+	traceID = strings.TrimSpace(traceID)
+	if traceID == "" {
+		return nil, errors.New("trace id is required")
+	}
+	// 大报文拆分后只有其中一片包含 TraceID，因此先定位命中的分片，再按 stream 与时间取回其余分片。
+	query := fmt.Sprintf(`{data_type="tracing"} |= %q`, traceID)
+	hits, err := c.QueryRange(ctx, QueryRangeRequest{Query: query, Start: start, End: end})
+	if err != nil {
+		return nil, err
+	}
+	out := []monitor.TracingDetails{}
+	// 同一条日志的多个分片都可能包含 TraceID（如请求体中也带有 TraceID），复原后按 span 去重。
+	seen := map[string]bool{}
+	for _, hit := range hits {
+		entries := []QueryEntry{hit}
+		if index, total, _, ok := parsePart(hit.Line); ok {
+			// 同一条日志的分片在同一 stream 内时间戳依次递增 1ns。
+			first := hit.Timestamp.Add(-time.Duration(index - 1))
+			parts, err := c.QueryRange(ctx, QueryRangeRequest{
+				Query: formatLabels(hit.Labels),
+				Start: first,
+				End:   first.Add(time.Duration(total)),
+			})
+			if err != nil {
+				return nil, err
+			}
+			entries = parts
+		}
+		for _, entry := range Reassemble(entries) {
+			if entry.Incomplete || !strings.Contains(entry.Line, traceID) {
+				continue
+			}
+			tr, err := DecodeTracing(entry)
+			if err != nil {
+				return out, err
+			}
+			if tr.TraceID != traceID {
+				continue
+			}
+			key := tr.SpanID
+			if key == "" {
+				key = formatLabels(entry.Labels) + "@" + strconv.FormatInt(entry.Timestamp.UnixNano(), 10)
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, tr)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,196 @@
+package loki
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/monitor"
+)
+
+// fakeQueryLoki 按 query_range 语义返回数据：start 包含、end 不包含，仅支持等值 selector 与 |= 过滤。
+func fakeQueryLoki(t *testing.T, stored []QueryEntry, requests *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/loki/api/v1/query_range", r.URL.Path)
+		assert.Equal(t, "acme", r.Header.Get(HeaderScopeOrgID))
+		*requests++
+		q := r.URL.Query()
+		start, _ := strconv.ParseInt(q.Get("start"), 10, 64)
+		end, _ := strconv.ParseInt(q.Get("end"), 10, 64)
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		query := q.Get("query")
+		selector, filter, _ := strings.Cut(query, " |= ")
+		if filter != "" {
+			filter, _ = strconv.Unquote(filter)
+		}
+
+		matched := []QueryEntry{}
+		for _, entry := range stored {
+			ns := entry.Timestamp.UnixNano()
+			if ns < start || ns >= end || !strings.Contains(entry.Line, filter) {
+				continue
+			}
+			if selector != `{data_type="tracing"}` && selector != formatLabels(entry.Labels) {
+				continue
+			}
+			matched = append(matched, entry)
+		}
+		sort.SliceStable(matched, func(i, j int) bool { return matched[i].Timestamp.Before(matched[j].Timestamp) })
+		if len(matched) > limit {
+			matched = matched[:limit]
+		}
+
+		type result struct {
+			Stream map[string]string `json:"stream"`
+			Values [][]any           `json:"values"`
+		}
+		results := []result{}
+		for _, entry := range matched {
+			value := []any{strconv.FormatInt(entry.Timestamp.UnixNano(), 10), entry.Line}
+			if entry.Metadata != nil {
+				value = append(value, map[string]any{"structuredMetadata": entry.Metadata})
+			}
+			results = append(results, result{Stream: entry.Labels, Values: [][]any{value}})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"status": "success",
+			"data":   map[string]any{"resultType": "streams", "result": results},
+		})
+	}))
+}
+
+func TestQueryRangePaging(t *testing.T) {
+	base := time.Unix(1714608000, 0)
+	labels := map[string]string{"data_type": "tracing"}
+	stored := []QueryEntry{}
+	// 同一纳秒的日志会跨页，验证边界去重。
+	for i, offset := range []int{0, 1, 1, 2, 3, 3} {
+		stored = append(stored, QueryEntry{Labels: labels, Timestamp: base.Add(time.Duration(offset)), Line: "l" + strconv.Itoa(i)})
+	}
+	requests := 0
+	server := fakeQueryLoki(t, stored, &requests)
+	defer server.Close()
+
+	client, err := NewQueryClient(&LokiConfig{URL: server.URL, TenantID: "acme"})
+	assert.NoError(t, err)
+	client.pageSize = 2
+	entries, err := client.QueryRange(context.Background(), QueryRangeRequest{Query: `{data_type="tracing"}`, Start: base, End: base.Add(time.Second)})
+	assert.NoError(t, err)
+	lines := []string{}
+	for _, entry := range entries {
+		lines = append(lines, entry.Line)
+	}
+	assert.Equal(t, []string{"l0", "l1", "l2", "l3", "l4", "l5"}, lines)
+	assert.Greater(t, requests, 3)
+
+	entries, err = client.QueryRange(context.Background(), QueryRangeRequest{Query: `{data_type="tracing"}`, Start: base, End: base.Add(time.Second), Limit: 3})
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestReassemble(t *testing.T) {
+	base := time.Unix(1714608000, 0)
+	a := map[string]string{"data_type": "tracing", "app": "a"}
+	b := map[string]string{"data_type": "tracing", "app": "b"}
+	entries := []QueryEntry{
+		{Labels: a, Timestamp: base.Add(2), Line: "[part 3/3] !"},
+		{Labels: a, Timestamp: base, Line: "[part 1/3] hello "},
+		{Labels: b, Timestamp: base.Add(1), Line: "[part 2/2] orphan"},
+		{Labels: a, Timestamp: base.Add(1), Line: "[part 2/3] world"},
+		{Labels: b, Timestamp: base.Add(5), Line: "plain"},
+	}
+	out := Reassemble(entries)
+	if assert.Len(t, out, 3) {
+		assert.Equal(t, "hello world!", out[0].Line)
+		assert.Equal(t, base, out[0].Timestamp)
+		assert.False(t, out[0].Incomplete)
+		assert.True(t, out[1].Incomplete)
+		assert.Equal(t, "plain", out[2].Line)
+	}
+}
+
+func TestFindTraceReassemblesSplitPayload(t *testing.T) {
+	client := &fakeLokiClient{}
+	lm := newTestSetting(client, 100, time.Hour)
+	lm.MaxBytes = 256
+	lm.FixedHeaders = map[string]string{}
+	started := time.Unix(1714608000, 0)
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	// 请求体多处引用 TraceID，使多个分片都命中查询。
+	body := []byte(`{"payload":"` + strings.Repeat(traceID+strings.Repeat("x", 200), 5) + `"}`)
+	tr := monitor.TracingDetails{TraceID: traceID, SpanID: "00f067aa0ba902b7", Uri: "/v1/orders", Status: 200, StartedAt: started, Body: body, BodyEnc: monitor.PayloadEncodingUTF8}
+	assert.NoError(t, lm.ReportTracing(tr))
+	assert.NoError(t, lm.ReportTracing(monitor.TracingDetails{TraceID: "other", StartedAt: started.Add(time.Second)}))
+	lm.shutdownWriter()
+
+	stored := []QueryEntry{}
+	for _, push := range client.pushes {
+		for _, stream := range push {
+			for _, entry := range stream.Entries {
+				stored = append(stored, QueryEntry{Labels: stream.Labels, Timestamp: entry.Timestamp, Line: entry.Line})
+			}
+		}
+	}
+	assert.Greater(t, len(stored), 3, "payload is split")
+
+	requests := 0
+	server := fakeQueryLoki(t, stored, &requests)
+	defer server.Close()
+	qc, err := NewQueryClient(&LokiConfig{URL: server.URL, TenantID: "acme"})
+	assert.NoError(t, err)
+	found, err := qc.FindTrace(context.Background(), tr.TraceID, started.Add(-time.Minute), started.Add(time.Minute))
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, body, found[0].Body)
+		assert.Equal(t, "/v1/orders", found[0].Uri)
+	}
+}
+
+func TestReportErrorRoundTrip(t *testing.T) {
+	client := &fakeLokiClient{}
+	lm := newTestSetting(client, 100, time.Hour)
+	lm.FixedHeaders = map[string]string{}
+	happened := time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)
+	rr := core.ErrorReport{
+		Error:      errors.New("requst to /v1/orders/42, resp err timeout"),
+		Uri:        "/v1/orders/42",
+		FullStack:  []byte("goroutine 1 [running]:\nmain.handler(0x1)\n\t/app/main.go:10 +0x1\n"),
+		HappendAT:  happened,
+		AppName:    "demo",
+		AppVersion: "1.0",
+	}
+	stream := reportOne(t, lm, client, func() error { return lm.ReportError(rr) })
+	assert.Equal(t, happened, stream.Entries[0].Timestamp)
+	assert.Equal(t, monitor.ErrorFingerprint(rr.Error.Error(), rr.FullStack), stream.Labels["fingerprint"])
+	assert.NotContains(t, stream.Labels, "stack_enc")
+
+	decoded, err := DecodeError(QueryEntry{Labels: stream.Labels, Timestamp: stream.Entries[0].Timestamp, Line: stream.Entries[0].Line})
+	assert.NoError(t, err)
+	assert.Equal(t, rr.Error.Error(), decoded.Error.Error())
+	assert.Equal(t, rr.Uri, decoded.Uri)
+	assert.Equal(t, rr.FullStack, decoded.FullStack)
+	assert.Equal(t, happened, decoded.HappendAT.UTC())
+	assert.Equal(t, "demo", decoded.AppName)
+}
+
+func TestDecodeLegacyError(t *testing.T) {
+	entry := QueryEntry{
+		Labels:    map[string]string{"app": "demo", "version": "1.0", "stack_enc": monitor.PayloadEncodingUTF8},
+		Timestamp: time.Unix(1714608000, 0),
+		Line:      "panic: boom",
+	}
+	report, err := DecodeError(entry)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("panic: boom"), report.FullStack)
+	assert.Equal(t, "demo", report.AppName)
+	assert.Equal(t, entry.Timestamp, report.HappendAT)
+}
@@ -1,8 +1,11 @@
 package loki
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
-	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,79 +14,152 @@ import (
 	"time"
 
 	"github.com/carlmjohnson/requests"
+	"github.com/klauspost/compress/snappy"
+)
+
+const (
+	EncodingJSON           = "json"
+	EncodingJSONGzip       = "json+gzip"
+	EncodingProtobufSnappy = "protobuf+snappy"
 )
 
 type RestClient struct {
 	endpoint string
 	auth     string
+	encoding string
+	client   *http.Client
+}
+
+// normalizeEncoding 规范化 REST 编码配置，未知值回退为 json。
+func normalizeEncoding(encoding string) string {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case EncodingJSONGzip, "gzip":
+		return EncodingJSONGzip
+	case EncodingProtobufSnappy, "protobuf", "snappy":
+		return EncodingProtobufSnappy
+	default:
+		return EncodingJSON
+	}
 }
 
 func NewRestClient(conf *LokiConfig) (*RestClient, error) {
 	url := strings.TrimRight(conf.URL, "/") + "/loki/api/v1/push"
-	var auth string
-	if conf.User != "" || conf.Password != "" {
-		cred := base64.StdEncoding.EncodeToString([]byte(conf.User + ":" + conf.Password))
-		auth = "Basic " + cred
+	client, err := newHTTPClient(conf)
+	if err != nil {
+		return nil, err
 	}
 	return &RestClient{
 		endpoint: url,
-		auth:     auth,
+		auth:     authorizationHeader(conf),
+		encoding: normalizeEncoding(conf.Encoding),
+		client:   client,
 	}, nil
 }
 
 func (c *RestClient) Close() error { return nil }
 
+// lokiJSONStream values 中每一项为 [时间戳, 日志] 或带 structured metadata 的 [时间戳, 日志, {metadata}]。
 type lokiJSONStream struct {
 	Stream map[string]string `json:"stream"`
-	Values [][]string        `json:"values"`
+	Values [][]any           `json:"values"`
 }
 type lokiJSONBody struct {
 	Streams []lokiJSONStream `json:"streams"`
 }
 
-func (c *RestClient) Push(labels map[string]string, line string) error {
-	ts := strconv.FormatInt(time.Now().UnixNano(), 10)
-	body := lokiJSONBody{
-		Streams: []lokiJSONStream{
-			{
-				Stream: labels,
-				Values: [][]string{
-					{ts, line},
-				},
-			},
-		},
+func toJSONBody(streams []LokiStream) lokiJSONBody {
+	body := lokiJSONBody{Streams: make([]lokiJSONStream, 0, len(streams))}
+	for _, stream := range streams {
+		values := make([][]any, 0, len(stream.Entries))
+		for _, entry := range stream.Entries {
+			value := []any{strconv.FormatInt(entry.Timestamp.UnixNano(), 10), entry.Line}
+			if len(entry.Metadata) > 0 {
+				value = append(value, entry.Metadata)
+			}
+			values = append(values, value)
+		}
+		body.Streams = append(body.Streams, lokiJSONStream{Stream: stream.Labels, Values: values})
+	}
+	return body
+}
+
+// encode 按配置编码请求体。
+// streams: 待写入的 stream。
+// 返回值：请求体、Content-Type 与 Content-Encoding（无压缩时为空）。
+func (c *RestClient) encode(streams []LokiStream) ([]byte, string, string, error) {
+	switch c.encoding {
+	case EncodingProtobufSnappy:
+		raw, err := toPushRequest(streams).Marshal()
+		if err != nil {
+			return nil, "", "", err
+		}
+		// Loki 要求 snappy block 格式，而非 framed 流格式。
+		return snappy.Encode(nil, raw), "application/x-protobuf", "", nil
+	case EncodingJSONGzip:
+		raw, err := json.Marshal(toJSONBody(streams))
+		if err != nil {
+			return nil, "", "", err
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(raw); err != nil {
+			return nil, "", "", err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, "", "", err
+		}
+		return buf.Bytes(), "application/json", "gzip", nil
+	default:
+		raw, err := json.Marshal(toJSONBody(streams))
+		return raw, "application/json", "", err
+	}
+}
+
+func (c *RestClient) Push(tenant string, streams []LokiStream) error {
+	body, contentType, contentEncoding, err := c.encode(streams)
+	if err != nil {
+		return fmt.Errorf("loki REST encode failed: %w", err)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	var status int
-	var respBody []byte
 	req := requests.
 		URL(c.endpoint).
+		Client(c.client).
 		Method("POST").
-		BodyJSON(body).
-		Header("Content-Type", "application/json")
+		BodyBytes(body).
+		Header("Content-Type", contentType)
+	if contentEncoding != "" {
+		req = req.Header("Content-Encoding", contentEncoding)
+	}
 	if c.auth != "" {
 		req = req.Header("Authorization", c.auth)
 	}
+	if tenant != "" {
+		req = req.Header(HeaderScopeOrgID, tenant)
+	}
 
-	err := req.Handle(func(r *http.Response) error {
-		status = r.StatusCode
-		b, rerr := io.ReadAll(r.Body)
-		if rerr != nil {
-			return rerr
+	// 关闭默认校验，由 Handle 自行检查状态码，以便把 Loki 的响应体与 Retry-After 带回错误信息。
+	err = req.AddValidator(nil).Handle(func(r *http.Response) error {
+		if r.StatusCode/100 == 2 {
+			return nil
 		}
-		respBody = b
-		if status/100 != 2 {
-			msg := strings.TrimSpace(string(respBody))
-			if msg == "" {
-				msg = http.StatusText(status)
-			}
-			return fmt.Errorf("status=%d body=%s", status, msg)
+		b, _ := io.ReadAll(io.LimitReader(r.Body, 4096))
+		msg := strings.TrimSpace(string(b))
+		if msg == "" {
+			msg = http.StatusText(r.StatusCode)
+		}
+		return &PushError{
+			Status:     r.StatusCode,
+			RetryAfter: parseRetryAfter(r.Header.Get("Retry-After"), time.Now()),
+			Body:       msg,
 		}
-		return nil
 	}).Fetch(ctx)
 	if err != nil {
-		return fmt.Errorf("loki REST push failed: %w", err)
+		var pushErr *PushError
+		if !errors.As(err, &pushErr) {
+			pushErr = &PushError{Err: err}
+		}
+		return fmt.Errorf("loki REST push failed: %w", pushErr)
 	}
 	return nil
 }
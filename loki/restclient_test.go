@@ -0,0 +1,163 @@
+package loki
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/grafana/loki/pkg/push"
+	"github.com/klauspost/compress/snappy"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeLoki 按 Loki 的规则解析 push 请求：protobuf 必须 snappy 压缩，JSON 可选 gzip。
+func fakeLoki(t *testing.T, received *[]push.Stream) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/loki/api/v1/push", r.URL.Path)
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if !assert.NoError(t, err) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reader = zr
+		}
+		body, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+
+		switch r.Header.Get("Content-Type") {
+		case "application/x-protobuf":
+			raw, err := snappy.Decode(nil, body)
+			if !assert.NoError(t, err) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			req := push.PushRequest{}
+			assert.NoError(t, req.Unmarshal(raw))
+			*received = append(*received, req.Streams...)
+		case "application/json":
+			req := lokiJSONBody{}
+			if !assert.NoError(t, json.Unmarshal(body, &req)) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for _, stream := range req.Streams {
+				entries := []push.Entry{}
+				for _, v := range stream.Values {
+					ns, _ := strconv.ParseInt(v[0].(string), 10, 64)
+					entry := push.Entry{Timestamp: time.Unix(0, ns), Line: v[1].(string)}
+					if len(v) > 2 {
+						metadata := map[string]string{}
+						for name, value := range v[2].(map[string]any) {
+							metadata[name] = value.(string)
+						}
+						entry.StructuredMetadata = toLabelsAdapter(metadata)
+					}
+					entries = append(entries, entry)
+				}
+				*received = append(*received, push.Stream{Labels: formatLabels(stream.Stream), Entries: entries})
+			}
+		default:
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+}
+
+func TestRestClientEncodings(t *testing.T) {
+	ts := time.Unix(1714608000, 123)
+	streams := []LokiStream{
+		{Labels: map[string]string{"app": "demo", "data_type": "tracing"}, Entries: []LokiEntry{
+			{Timestamp: ts, Line: "l1", Metadata: map[string]string{"trace_id": "abc", "operator": "alice"}},
+			{Timestamp: ts.Add(1), Line: "l2"},
+		}},
+		{Labels: map[string]string{"app": "demo", "data_type": "error"}, Entries: []LokiEntry{{Timestamp: ts, Line: "e1"}}},
+	}
+
+	for _, encoding := range []string{"", EncodingJSONGzip, EncodingProtobufSnappy} {
+		received := []push.Stream{}
+		server := fakeLoki(t, &received)
+		client, err := NewRestClient(&LokiConfig{URL: server.URL, Encoding: encoding})
+		assert.NoError(t, err)
+		assert.NoError(t, client.Push("", streams), encoding)
+		server.Close()
+
+		if assert.Len(t, received, 2, encoding) {
+			assert.Equal(t, `{app="demo",data_type="tracing"}`, received[0].Labels)
+			assert.Len(t, received[0].Entries, 2)
+			assert.Equal(t, "l2", received[0].Entries[1].Line)
+			assert.Equal(t, ts.Add(1).UnixNano(), received[0].Entries[1].Timestamp.UnixNano())
+			assert.Equal(t, push.LabelsAdapter{{Name: "operator", Value: "alice"}, {Name: "trace_id", Value: "abc"}}, received[0].Entries[0].StructuredMetadata, encoding)
+			assert.Empty(t, received[0].Entries[1].StructuredMetadata)
+			assert.Equal(t, "e1", received[1].Entries[0].Line)
+		}
+	}
+}
+
+func TestRestClientErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte("rate limited"))
+	}))
+	defer server.Close()
+
+	client, _ := NewRestClient(&LokiConfig{URL: server.URL, Encoding: EncodingProtobufSnappy})
+	err := client.Push("", []LokiStream{{Labels: map[string]string{"a": "b"}, Entries: []LokiEntry{{Timestamp: time.Now(), Line: "x"}}}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "status=429")
+	var pushErr *PushError
+	if assert.ErrorAs(t, err, &pushErr) {
+		assert.Equal(t, http.StatusTooManyRequests, pushErr.Status)
+		assert.Equal(t, 7*time.Second, pushErr.RetryAfter)
+		assert.Equal(t, "rate limited", pushErr.Body)
+	}
+	action, _ := classifyPushError(err)
+	assert.Equal(t, actionRetry, action)
+
+	server.Close()
+	err = client.Push("", []LokiStream{{Labels: map[string]string{"a": "b"}, Entries: []LokiEntry{{Timestamp: time.Now(), Line: "x"}}}})
+	action, reason := classifyPushError(err)
+	assert.Equal(t, actionRetry, action)
+	assert.Equal(t, "network", reason)
+}
+
+func TestRestClientAuthAndTenant(t *testing.T) {
+	var gotAuth, gotTenant string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		gotTenant = r.Header.Get(HeaderScopeOrgID)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := server.Certificate()
+	assert.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600))
+
+	streams := []LokiStream{{Labels: map[string]string{"a": "b"}, Entries: []LokiEntry{{Timestamp: time.Now(), Line: "x"}}}}
+
+	// 未信任服务端证书时应失败。
+	client, err := NewRestClient(&LokiConfig{URL: server.URL, BearerToken: "token"})
+	assert.NoError(t, err)
+	assert.Error(t, client.Push("acme", streams))
+
+	client, err = NewRestClient(&LokiConfig{URL: server.URL, User: "u", Password: "p", BearerToken: "token", CAFile: caFile})
+	assert.NoError(t, err)
+	assert.NoError(t, client.Push("acme", streams))
+	assert.Equal(t, "Bearer token", gotAuth)
+	assert.Equal(t, "acme", gotTenant)
+
+	_, err = NewRestClient(&LokiConfig{URL: server.URL, CertFile: caFile})
+	assert.Error(t, err)
+}
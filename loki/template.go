@@ -0,0 +1,358 @@
+package loki
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+)
+
+const (
+	LineFormatJSON     = "json"
+	LineFormatLogfmt   = "logfmt"
+	LineFormatTemplate = "template"
+
+	LabelOverflowBucket = "bucket"
+	LabelOverflowDrop   = "drop"
+
+	// defaultOverflowBucket 超出基数上限的 label 值统一归入该取值。
+	defaultOverflowBucket = "_other"
+)
+
+// LokiLabelTemplates 各数据类型的 label 映射，key 为 label 名，value 为 text/template 模板。
+// 某一类型未配置时使用内置默认映射；模板渲染为空时不发送该 label。
+type LokiLabelTemplates struct {
+	Tracing  map[string]string
+	Error    map[string]string
+	Schedule map[string]string
+}
+
+// LokiLineTemplates LineFormat 为 template 时各数据类型的正文模板，未配置的类型回退为 json。
+type LokiLineTemplates struct {
+	Tracing  string
+	Error    string
+	Schedule string
+}
+
+// defaultLabelTemplates 与历史版本硬编码的 labels 保持一致。
+var defaultLabelTemplates = LokiLabelTemplates{
+	Tracing: map[string]string{
+		"optionname":      "{{.Optionname}}",
+		"method":          "{{.Method}}",
+		"status":          "{{.Status}}",
+		"verbosity_level": "{{.VerbosityLevel}}",
+		"app":             "{{.AppName}}",
+		"version":         "{{.AppVersion}}",
+		"tenant":          "{{.Tenant}}",
+	},
+	Error: map[string]string{
+		"app":         "{{.AppName}}",
+		"version":     "{{.AppVersion}}",
+		"fingerprint": "{{.Fingerprint}}",
+	},
+	Schedule: map[string]string{
+		"app":     "{{.App}}",
+		"succeed": "{{.Succeed}}",
+		"job":     "{{.Job}}",
+	},
+}
+
+// lokiTracingLine tracing 日志正文及模板数据，Body/Resp 为按 BodyEnc/RespEnc 编码后的文本。
+type lokiTracingLine struct {
+	monitor.TracingDetails
+	Body string
+	Resp string
+}
+
+// lokiErrorLine error 日志正文及模板数据。
+// Message: rr.Error 的错误信息。
+// Stack/StackEnc: 按 EncodePayloadForText 编码后的 FullStack 与编码方式。
+// Fingerprint: 错误指纹，用于同类错误的计数与分组。
+type lokiErrorLine struct {
+	Message     string
+	Uri         string
+	Stack       string
+	StackEnc    string
+	AppName     string
+	AppVersion  string
+	HappendAT   time.Time
+	Fingerprint string
+}
+
+// fixedLabelData FixedLabels 模板可引用的字段。
+type fixedLabelData struct {
+	AppName  string
+	Version  string
+	Hostname string
+	Env      string
+}
+
+// templateFuncs label 与正文模板可用的函数。
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"env":   os.Getenv,
+	// default 值为空时使用 fallback：{{.Tenant | default "none"}}。
+	"default": func(fallback string, value any) string {
+		text := fmt.Sprint(value)
+		if value == nil || text == "" {
+			return fallback
+		}
+		return text
+	},
+	// trunc 截断为最多 n 个字符。
+	"trunc": func(n int, value string) string {
+		runes := []rune(value)
+		if n >= 0 && len(runes) > n {
+			return string(runes[:n])
+		}
+		return value
+	},
+	// statusClass 将状态码归类为 2xx/4xx/5xx 等。
+	"statusClass": func(status int) string {
+		if status <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("%dxx", status/100)
+	},
+	// pathPrefix 保留 uri 的前 n 段路径：{{pathPrefix 2 .Uri}} => /v1/orders。
+	"pathPrefix": func(n int, uri string) string {
+		if i := strings.IndexAny(uri, "?#"); i >= 0 {
+			uri = uri[:i]
+		}
+		segments := strings.Split(strings.Trim(uri, "/"), "/")
+		if n < len(segments) {
+			segments = segments[:n]
+		}
+		return "/" + strings.Join(segments, "/")
+	},
+}
+
+type labelTemplate struct {
+	name string
+	tpl  *template.Template
+}
+
+// lokiTemplates 编译后的 label 与正文模板。
+type lokiTemplates struct {
+	tracing    []labelTemplate
+	errors     []labelTemplate
+	schedule   []labelTemplate
+	lineFormat string
+	lines      map[string]*template.Template
+}
+
+// compileLabelTemplates 编译一组 label 模板，按 label 名排序保证渲染顺序稳定。
+func compileLabelTemplates(dataType string, mapping map[string]string) ([]labelTemplate, error) {
+	names := make([]string, 0, len(mapping))
+	for name := range mapping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	out := make([]labelTemplate, 0, len(names))
+	for _, name := range names {
+		label := normalizeLokiLabelName(name)
+		if label == "" || label == "data_type" {
+			return nil, fmt.Errorf("invalid loki %s label name %q", dataType, name)
+		}
+		tpl, err := template.New(label).Funcs(templateFuncs).Option("missingkey=zero").Parse(mapping[name])
+		if err != nil {
+			return nil, fmt.Errorf("parse loki %s label %q failed: %w", dataType, name, err)
+		}
+		out = append(out, labelTemplate{name: label, tpl: tpl})
+	}
+	return out, nil
+}
+
+// compileLokiTemplates 编译 label 映射与正文格式配置。
+// labels: 各数据类型的 label 映射，未配置的类型使用默认映射。
+// lineFormat: 正文格式 json/logfmt/template，空值为 json。
+// lines: template 格式下的正文模板。
+// 返回值：编译结果；模板语法错误或格式未知时返回错误。
+func compileLokiTemplates(labels LokiLabelTemplates, lineFormat string, lines LokiLineTemplates) (*lokiTemplates, error) {
+	pick := func(configured, fallback map[string]string) map[string]string {
+		if len(configured) > 0 {
+			return configured
+		}
+		return fallback
+	}
+	out := &lokiTemplates{lines: map[string]*template.Template{}}
+	var err error
+	if out.tracing, err = compileLabelTemplates("tracing", pick(labels.Tracing, defaultLabelTemplates.Tracing)); err != nil {
+		return nil, err
+	}
+	if out.errors, err = compileLabelTemplates("error", pick(labels.Error, defaultLabelTemplates.Error)); err != nil {
+		return nil, err
+	}
+	if out.schedule, err = compileLabelTemplates("schedule", pick(labels.Schedule, defaultLabelTemplates.Schedule)); err != nil {
+		return nil, err
+	}
+
+	out.lineFormat = strings.ToLower(strings.TrimSpace(lineFormat))
+	switch out.lineFormat {
+	case "", LineFormatJSON:
+		out.lineFormat = LineFormatJSON
+	case LineFormatLogfmt:
+	case LineFormatTemplate:
+		for dataType, text := range map[string]string{"tracing": lines.Tracing, "error": lines.Error, "schedule": lines.Schedule} {
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			tpl, err := template.New(dataType).Funcs(templateFuncs).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("parse loki %s line template failed: %w", dataType, err)
+			}
+			out.lines[dataType] = tpl
+		}
+	default:
+		return nil, fmt.Errorf("unknown loki line format %q", lineFormat)
+	}
+	return out, nil
+}
+
+// defaultLokiTemplates 未经 InitLokiMonitor 初始化时（如测试）使用的默认模板。
+var defaultLokiTemplates = sync.OnceValue(func() *lokiTemplates {
+	out, err := compileLokiTemplates(LokiLabelTemplates{}, "", LokiLineTemplates{})
+	if err != nil {
+		panic(err)
+	}
+	return out
+})
+
+func (lm *LokiSetting) lokiTemplates() *lokiTemplates {
+	if lm.templates != nil {
+		return lm.templates
+	}
+	return defaultLokiTemplates()
+}
+
+// renderFixedLabels 渲染 FixedLabels，仅在启动时执行一次。
+// mapping: label 名到模板的映射。
+// data: 模板数据。
+// labels: 目标 label 集合，同名 label 会被覆盖。
+func renderFixedLabels(mapping map[string]string, data fixedLabelData, labels map[string]string) error {
+	compiled, err := compileLabelTemplates("fixed", mapping)
+	if err != nil {
+		return err
+	}
+	for _, item := range compiled {
+		var buf bytes.Buffer
+		if err := item.tpl.Execute(&buf, data); err != nil {
+			return fmt.Errorf("render loki fixed label %q failed: %w", item.name, err)
+		}
+		setLokiLabel(labels, item.name, buf.String())
+	}
+	return nil
+}
+
+// applyLabels 渲染 label 模板并写入 labels，渲染失败或为空的 label 不发送，超出基数上限的值按配置归并或丢弃。
+func (lm *LokiSetting) applyLabels(labels map[string]string, items []labelTemplate, data any) {
+	var buf bytes.Buffer
+	for _, item := range items {
+		buf.Reset()
+		if err := item.tpl.Execute(&buf, data); err != nil {
+			lm.Logger.Debug("render loki label failed", zap.String("label", item.name), zap.Error(err))
+			continue
+		}
+		value := strings.TrimSpace(buf.String())
+		if value == "" || value == "<no value>" {
+			continue
+		}
+		value, ok := lm.labelGuard.admit(item.name, value)
+		if !ok {
+			continue
+		}
+		setLokiLabel(labels, item.name, value)
+	}
+}
+
+// formatLine 按配置的正文格式渲染日志。
+// dataType: tracing/error/schedule。
+// data: 正文数据。
+// fallback: json 格式下的正文。
+// 返回值：渲染后的正文；logfmt/template 渲染失败时回退为 fallback。
+func (lm *LokiSetting) formatLine(dataType string, data any, fallback func() (string, error)) (string, error) {
+	tpls := lm.lokiTemplates()
+	switch tpls.lineFormat {
+	case LineFormatLogfmt:
+		line, err := toLogfmt(data)
+		if err == nil {
+			return line, nil
+		}
+		lm.Logger.Warn("format loki line as logfmt failed, fallback to json", zap.String("data_type", dataType), zap.Error(err))
+	case LineFormatTemplate:
+		if tpl, ok := tpls.lines[dataType]; ok {
+			var buf bytes.Buffer
+			err := tpl.Execute(&buf, data)
+			if err == nil {
+				return buf.String(), nil
+			}
+			lm.Logger.Warn("render loki line template failed, fallback to json", zap.String("data_type", dataType), zap.Error(err))
+		}
+	}
+	return fallback()
+}
+
+// toLogfmt 将结构体按 JSON 字段展开为 logfmt，key 排序输出；嵌套对象以 JSON 文本作为值。
+func toLogfmt(data any) (string, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	fields := map[string]any{}
+	if err := decoder.Decode(&fields); err != nil {
+		return "", err
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	for _, key := range keys {
+		var value string
+		switch v := fields[key].(type) {
+		case nil:
+			continue
+		case string:
+			value = v
+		case json.Number:
+			value = v.String()
+		case bool:
+			value = strconv.FormatBool(v)
+		default:
+			nested, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			value = string(nested)
+		}
+		if builder.Len() > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(key)
+		builder.WriteByte('=')
+		builder.WriteString(logfmtValue(value))
+	}
+	return builder.String(), nil
+}
+
+// logfmtValue 值为空或包含空白、引号、等号时加引号。
+func logfmtValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\r\n\"=\\") {
+		return strconv.Quote(value)
+	}
+	return value
+}
@@ -0,0 +1,116 @@
+package loki
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+)
+
+func reportOne(t *testing.T, lm *LokiSetting, client *fakeLokiClient, report func() error) LokiStream {
+	assert.NoError(t, report())
+	lm.shutdownWriter()
+	if !assert.Len(t, client.pushes, 1) {
+		t.FailNow()
+	}
+	return client.pushes[0][0]
+}
+
+func TestDefaultLabelsUnchanged(t *testing.T) {
+	client := &fakeLokiClient{}
+	lm := newTestSetting(client, 100, time.Hour)
+	lm.FixedHeaders = map[string]string{"env": "test"}
+	tr := monitor.TracingDetails{Optionname: "order.create", Method: "POST", Status: 201, AppName: "demo", AppVersion: "1.0", Tenant: "acme"}
+	stream := reportOne(t, lm, client, func() error { return lm.ReportTracing(tr) })
+
+	assert.Equal(t, map[string]string{
+		"env": "test", "data_type": "tracing", "optionname": "order.create", "method": "POST",
+		"status": "201", "verbosity_level": "0", "app": "demo", "version": "1.0", "tenant": "acme",
+	}, stream.Labels)
+	assert.Contains(t, stream.Entries[0].Line, `"Optionname":"order.create"`)
+}
+
+func TestCustomLabelTemplatesAndLogfmt(t *testing.T) {
+	templates, err := compileLokiTemplates(LokiLabelTemplates{
+		Tracing: map[string]string{
+			"status_class": "{{statusClass .Status}}",
+			"route":        "{{pathPrefix 2 .Uri}}",
+			"tenant":       `{{.Tenant | default "none"}}`,
+		},
+	}, LineFormatLogfmt, LokiLineTemplates{})
+	assert.NoError(t, err)
+
+	client := &fakeLokiClient{}
+	lm := newTestSetting(client, 100, time.Hour)
+	lm.templates = templates
+	tr := monitor.TracingDetails{Uri: "/v1/orders/42?x=1", Status: 404, Method: "GET", Operator: "alice smith"}
+	stream := reportOne(t, lm, client, func() error { return lm.ReportTracing(tr) })
+
+	assert.Equal(t, map[string]string{"data_type": "tracing", "status_class": "4xx", "route": "/v1/orders", "tenant": "none"}, stream.Labels)
+	line := stream.Entries[0].Line
+	assert.Contains(t, line, "Method=GET")
+	assert.Contains(t, line, `Operator="alice smith"`)
+	assert.Contains(t, line, "Status=404")
+}
+
+func TestLineTemplate(t *testing.T) {
+	templates, err := compileLokiTemplates(LokiLabelTemplates{}, LineFormatTemplate, LokiLineTemplates{
+		Schedule: "job={{.Job}} ok={{.Succeed}} took={{.Duration}}",
+	})
+	assert.NoError(t, err)
+
+	client := &fakeLokiClient{}
+	lm := newTestSetting(client, 100, time.Hour)
+	lm.templates = templates
+	job := schedule.JobHistory{Job: "cleanup", App: "demo", Succeed: true, Duration: 2 * time.Second}
+	before := time.Now()
+	stream := reportOne(t, lm, client, func() error { return lm.ReportScheduleJob(job) })
+
+	assert.Equal(t, "job=cleanup ok=true took=2s", stream.Entries[0].Line)
+	assert.Equal(t, "cleanup", stream.Labels["job"])
+	// 以上报时间作为任务结束时间。
+	assert.WithinDuration(t, before, stream.Entries[0].Timestamp, time.Second)
+}
+
+func TestCompileTemplateErrors(t *testing.T) {
+	_, err := compileLokiTemplates(LokiLabelTemplates{Tracing: map[string]string{"bad": "{{.Uri"}}, "", LokiLineTemplates{})
+	assert.Error(t, err)
+	_, err = compileLokiTemplates(LokiLabelTemplates{Tracing: map[string]string{"data_type": "x"}}, "", LokiLineTemplates{})
+	assert.Error(t, err)
+	_, err = compileLokiTemplates(LokiLabelTemplates{}, "xml", LokiLineTemplates{})
+	assert.Error(t, err)
+}
+
+func TestLabelGuard(t *testing.T) {
+	assert.Nil(t, newLabelGuard(0, nil, "", ""))
+
+	guard := newLabelGuard(2, map[string]int{"Route": 1, "app": 0}, "", "")
+	for _, value := range []string{"a", "b", "a"} {
+		got, ok := guard.admit("optionname", value)
+		assert.True(t, ok)
+		assert.Equal(t, value, got)
+	}
+	got, ok := guard.admit("optionname", "c")
+	assert.True(t, ok)
+	assert.Equal(t, defaultOverflowBucket, got)
+
+	_, _ = guard.admit("route", "/v1")
+	got, _ = guard.admit("route", "/v2")
+	assert.Equal(t, defaultOverflowBucket, got, "per-label limit overrides default")
+
+	for _, value := range []string{"x", "y", "z"} {
+		got, _ = guard.admit("app", value)
+		assert.Equal(t, value, got, "limit 0 disables the guard for a label")
+	}
+
+	drop := newLabelGuard(1, nil, LabelOverflowDrop, "")
+	_, ok = drop.admit("device", "d1")
+	assert.True(t, ok)
+	_, ok = drop.admit("device", "d2")
+	assert.False(t, ok)
+	distinct, rejected := drop.stats()
+	assert.Equal(t, 1, distinct["device"])
+	assert.Equal(t, 1, rejected["device"])
+}
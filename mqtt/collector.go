@@ -0,0 +1,166 @@
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/spf13/viper"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/mqttclient"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+)
+
+// MqttCollectorConfig tracing.mqttCollector 配置，topic 需与边缘端 MqttSink 一致。
+// SharedGroup: 缺省为空，每个实例都收到全部数据；非空时以 $share/<SharedGroup>/ 共享订阅，多个 collector 实例分摊消息。
+type MqttCollectorConfig struct {
+	TracingTopic  string
+	ErrorTopic    string
+	ScheduleTopic string
+	QoS           byte
+	SharedGroup   string
+}
+
+// MqttCollector 订阅 MqttSink 发布的数据，推送回 monitor.TracingAdaptor、core.ErrorAdaptor 与 schedule.JobHistoryAdaptor，
+// 由本进程启用的各后端持久化。
+type MqttCollector struct {
+	Config *MqttCollectorConfig
+	Client *mqttclient.MqttService
+	Logger *zap.Logger
+}
+
+func applyCollectorDefaults(conf *MqttCollectorConfig) {
+	if conf.TracingTopic == "" {
+		conf.TracingTopic = DefaultTracingTopic
+	}
+	if conf.ErrorTopic == "" {
+		conf.ErrorTopic = DefaultErrorTopic
+	}
+	if conf.ScheduleTopic == "" {
+		conf.ScheduleTopic = DefaultScheduleTopic
+	}
+}
+
+// InitMqttCollector 从 tracing.mqttCollector 读取配置并连接 MQTT。
+// 返回值：未配置 tracing.mqttCollector 时返回 nil。
+func InitMqttCollector(logger *zap.Logger) (*MqttCollector, error) {
+	if !viper.IsSet("tracing.mqttCollector") {
+		logger.Info("no mqtt collector config, return nil")
+		return nil, nil
+	}
+	conf := &MqttCollectorConfig{QoS: 1}
+	if err := viper.UnmarshalKey("tracing.mqttCollector", conf); err != nil {
+		logger.Error("mqtt collector config error.", zap.Error(err))
+		return nil, err
+	}
+	if conf.QoS > 2 {
+		return nil, fmt.Errorf("invalid mqtt qos %d", conf.QoS)
+	}
+	applyCollectorDefaults(conf)
+	svc, err := mqttclient.InitMqttService("monitor-collector-{{.hostname}}", conf.QoS, true, "")
+	if err != nil {
+		logger.Error("connect to mqtt for monitor collector failed.", zap.Error(err))
+		return nil, err
+	}
+	return &MqttCollector{Config: conf, Client: svc, Logger: logger}, nil
+}
+
+// Start 订阅三类数据的 topic。
+func (mc *MqttCollector) Start() error {
+	subs := map[string]mqtt.MessageHandler{
+		mc.Config.TracingTopic:  mc.onTracing,
+		mc.Config.ErrorTopic:    mc.onError,
+		mc.Config.ScheduleTopic: mc.onSchedule,
+	}
+	var errs []error
+	for topic, handler := range subs {
+		if mc.Config.SharedGroup != "" {
+			topic = "$share/" + mc.Config.SharedGroup + "/" + topic
+		}
+		if err := mc.Client.Sub(topic, handler); err != nil {
+			mc.Logger.Error("failed to subscribe topic", zap.String("topic", topic), zap.Error(err))
+			errs = append(errs, err)
+			continue
+		}
+		mc.Logger.Info("mqtt collector subscribed", zap.String("topic", topic))
+	}
+	return errors.Join(errs...)
+}
+
+func (mc *MqttCollector) onTracing(_ mqtt.Client, msg mqtt.Message) {
+	items, err := decodeBatch[monitor.TracingDetails](msg.Payload())
+	if err != nil {
+		mc.Logger.Warn("invalid tracing batch", zap.String("topic", msg.Topic()), zap.Error(err))
+		return
+	}
+	for _, item := range items {
+		monitor.TracingAdaptor.Push(item)
+	}
+}
+
+func (mc *MqttCollector) onError(_ mqtt.Client, msg mqtt.Message) {
+	items, err := decodeErrorBatch(msg.Payload())
+	if err != nil {
+		mc.Logger.Warn("invalid error batch", zap.String("topic", msg.Topic()), zap.Error(err))
+		return
+	}
+	for _, item := range items {
+		core.ErrorAdaptor.Push(item)
+	}
+}
+
+func (mc *MqttCollector) onSchedule(_ mqtt.Client, msg mqtt.Message) {
+	items, err := decodeBatch[schedule.JobHistory](msg.Payload())
+	if err != nil {
+		mc.Logger.Warn("invalid schedule batch", zap.String("topic", msg.Topic()), zap.Error(err))
+		return
+	}
+	for _, item := range items {
+		schedule.JobHistoryAdaptor.Push(item)
+	}
+}
+
+// decodeErrorBatch 将传输格式还原为 core.ErrorReport，空的错误信息还原为 nil。
+func decodeErrorBatch(payload []byte) ([]core.ErrorReport, error) {
+	items, err := decodeBatch[errorMessage](payload)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]core.ErrorReport, 0, len(items))
+	for _, item := range items {
+		var err error
+		if item.Error != "" {
+			err = errors.New(item.Error)
+		}
+		reports = append(reports, core.ErrorReport{
+			Error:      err,
+			Uri:        item.Uri,
+			FullStack:  item.FullStack,
+			HappendAT:  item.HappendAT,
+			AppName:    item.AppName,
+			AppVersion: item.AppVersion,
+		})
+	}
+	return reports, nil
+}
+
+// EnableMqttCollector 向容器注册 MQTT collector，并在启动时订阅。
+// 同一进程启用了 MqttSink 时不启动，否则收到的数据会被重新发布形成回环。
+func EnableMqttCollector() {
+	core.Provide(InitMqttCollector)
+	core.ProvideStartup(func(logger *zap.Logger, mc *MqttCollector) core.Startup {
+		if mc == nil {
+			return nil
+		}
+		if sinkEnabled {
+			logger.Error("mqtt sink and collector can not be enabled in the same process, collector disabled")
+			return nil
+		}
+		if err := mc.Start(); err != nil {
+			logger.Error("mqtt collector start failed", zap.Error(err))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,248 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultCorrelationTimeout    = 30 * time.Second
+	defaultCorrelationMaxPending = 10000
+	// StatusCorrelationTimeout 超时未收到响应的请求记录的状态码。
+	StatusCorrelationTimeout = 504
+)
+
+// CorrelationConfig 请求/响应配对配置（tracing.mqtt.correlation）。
+// RequestTopics/ResponseTopics: 请求与响应的 topic 模板，写法同 TopicTemplates（{name}、+、#）；
+// 命名段（如 {tenant}、{device}）的取值与关联字段一起作为配对键，请求与响应模板中的命名段需一致。
+// Field: 请求与响应 JSON 正文中的关联字段，支持 a.b.c 形式的路径。
+// Timeout: 等待响应的最长时间，超时后以 504 推送请求。
+// MaxPending: 最多同时等待的请求数，超出后新请求不再配对，直接按单条消息推送。
+// 仅按 JSON 正文中的关联字段配对：paho.mqtt.golang 只支持 MQTT 3.1.1，
+// MQTT v5 的 response-topic 与 correlation-data 未实现，需要改用支持 v5 的客户端（如 paho.golang）。
+type CorrelationConfig struct {
+	RequestTopics  []string
+	ResponseTopics []string
+	Field          string
+	Timeout        time.Duration
+	MaxPending     int
+}
+
+// pendingRequest 等待响应的请求。
+type pendingRequest struct {
+	details  monitor.TracingDetails
+	deadline time.Time
+}
+
+// correlator 按关联字段将请求与响应合并为一条 TracingDetails。
+type correlator struct {
+	requests  []*topicTemplate
+	responses []*topicTemplate
+	field     []string
+	timeout   time.Duration
+	max       int
+	push      func(monitor.TracingDetails)
+	logger    *zap.Logger
+
+	mu sync.Mutex
+	// pending 以 topic 命名段取值加关联字段为键，不同设备使用相同的本地序号时互不干扰。
+	pending map[string]*pendingRequest
+}
+
+// newCorrelator 编译配对配置。
+// 返回值：未配置 Field 或请求/响应 topic 时返回 nil（不启用配对）；topic 模板无效时返回错误。
+func newCorrelator(conf *CorrelationConfig, push func(monitor.TracingDetails), logger *zap.Logger) (*correlator, error) {
+	if conf == nil || conf.Field == "" || len(conf.RequestTopics) == 0 || len(conf.ResponseTopics) == 0 {
+		return nil, nil
+	}
+	requests, err := compileTopicTemplates(conf.RequestTopics)
+	if err != nil {
+		return nil, err
+	}
+	responses, err := compileTopicTemplates(conf.ResponseTopics)
+	if err != nil {
+		return nil, err
+	}
+	c := &correlator{
+		requests:  requests,
+		responses: responses,
+		field:     strings.Split(conf.Field, "."),
+		timeout:   conf.Timeout,
+		max:       conf.MaxPending,
+		push:      push,
+		logger:    logger,
+		pending:   map[string]*pendingRequest{},
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultCorrelationTimeout
+	}
+	if c.max <= 0 {
+		c.max = defaultCorrelationMaxPending
+	}
+	return c, nil
+}
+
+// matchTemplates 返回第一个匹配模板的命名段取值。
+func matchTemplates(templates []*topicTemplate, topic string) (map[string]string, bool) {
+	for _, tpl := range templates {
+		if m, ok := tpl.match(topic); ok {
+			return m.Values, true
+		}
+	}
+	return nil, false
+}
+
+// pendingKey 由命名段取值（按名称排序）与关联字段生成配对键。
+func pendingKey(values map[string]string, id string) string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name + "=" + values[name] + "\x00")
+	}
+	sb.WriteString(id)
+	return sb.String()
+}
+
+// correlationID 从 JSON 正文中读取关联字段，字段不存在或正文不是 JSON 对象时返回空字符串。
+func (c *correlator) correlationID(payload []byte) string {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return ""
+	}
+	for _, key := range c.field {
+		obj, ok := value.(map[string]any)
+		if !ok {
+			return ""
+		}
+		if value, ok = obj[key]; !ok {
+			return ""
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil, map[string]any, []any:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// handle 处理一条消息。
+// 返回值：消息已被配对逻辑接管（等待响应或已合并推送）时返回 true，调用方不再单独推送。
+// 配对结果在释放锁之后推送，采样、脱敏与后端推送不占用锁。
+func (c *correlator) handle(details monitor.TracingDetails, topic string, now time.Time) bool {
+	values, isRequest := matchTemplates(c.requests, topic)
+	isResponse := false
+	if !isRequest {
+		values, isResponse = matchTemplates(c.responses, topic)
+	}
+	if !isRequest && !isResponse {
+		return false
+	}
+	id := c.correlationID(details.Body)
+	if id == "" {
+		return false
+	}
+	key := pendingKey(values, id)
+
+	records, handled := c.correlate(details, key, isResponse, now)
+	for _, record := range records {
+		c.push(record)
+	}
+	return handled
+}
+
+// correlate 在锁内更新等待队列。
+// 返回值：需要推送的记录，以及消息是否已被配对逻辑接管。
+func (c *correlator) correlate(details monitor.TracingDetails, key string, isResponse bool, now time.Time) ([]monitor.TracingDetails, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if isResponse {
+		req, ok := c.pending[key]
+		if !ok {
+			// 找不到请求（已超时或由其它实例接收），按单条消息推送。
+			return nil, false
+		}
+		delete(c.pending, key)
+		exchange := req.details
+		exchange.Resp = details.Body
+		exchange.RespEnc = details.BodyEnc
+		exchange.Durtion = now.Sub(exchange.StartedAt)
+		exchange.Status = 200
+		return []monitor.TracingDetails{exchange}, true
+	}
+
+	var records []monitor.TracingDetails
+	if previous, ok := c.pending[key]; ok {
+		// 关联字段被新请求复用，之前的请求视为未收到响应。
+		delete(c.pending, key)
+		records = append(records, timedOut(previous.details, now))
+	}
+	if len(c.pending) >= c.max {
+		c.logger.Warn("too many pending mqtt requests, correlation skipped", zap.Int("maxPending", c.max))
+		return records, false
+	}
+	c.pending[key] = &pendingRequest{details: details, deadline: now.Add(c.timeout)}
+	return records, true
+}
+
+// timedOut 将未收到响应的请求标记为超时。
+func timedOut(details monitor.TracingDetails, now time.Time) monitor.TracingDetails {
+	details.Status = StatusCorrelationTimeout
+	details.Durtion = now.Sub(details.StartedAt)
+	return details
+}
+
+// expire 推送所有已超时的请求。
+// 返回值：超时的请求数。
+func (c *correlator) expire(now time.Time) int {
+	c.mu.Lock()
+	records := []monitor.TracingDetails{}
+	for key, req := range c.pending {
+		if now.Before(req.deadline) {
+			continue
+		}
+		delete(c.pending, key)
+		records = append(records, timedOut(req.details, now))
+	}
+	c.mu.Unlock()
+	for _, record := range records {
+		c.push(record)
+	}
+	return len(records)
+}
+
+// run 定期检查超时请求，ctx 结束时返回。
+func (c *correlator) run(ctx context.Context) {
+	interval := max(c.timeout/4, 100*time.Millisecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if expired := c.expire(now); expired > 0 {
+				c.logger.Debug("mqtt requests timed out", zap.Int("count", expired))
+			}
+		}
+	}
+}
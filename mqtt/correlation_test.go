@@ -0,0 +1,150 @@
+package mqtt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+)
+
+func newTestCorrelator(t *testing.T, pushed *[]monitor.TracingDetails) *correlator {
+	c, err := newCorrelator(&CorrelationConfig{
+		RequestTopics:  []string{"t/{tenant}/d/{device}/cmd"},
+		ResponseTopics: []string{"t/{tenant}/d/{device}/cmd_reply"},
+		Field:          "meta.id",
+		Timeout:        10 * time.Second,
+		MaxPending:     2,
+	}, func(tr monitor.TracingDetails) { *pushed = append(*pushed, tr) }, zap.NewNop())
+	assert.NoError(t, err)
+	return c
+}
+
+func message(topic string, body string, at time.Time) monitor.TracingDetails {
+	return monitor.TracingDetails{Optionname: topic, Uri: "mqtt://" + topic, Method: MethodMQTT, Status: 200, StartedAt: at, Body: []byte(body), BodyEnc: monitor.PayloadEncodingUTF8}
+}
+
+func TestCorrelatorPairsRequestAndResponse(t *testing.T) {
+	pushed := []monitor.TracingDetails{}
+	c := newTestCorrelator(t, &pushed)
+	started := time.Unix(1714608000, 0)
+
+	assert.True(t, c.handle(message("t/acme/d/dev-01/cmd", `{"meta":{"id":42},"op":"on"}`, started), "t/acme/d/dev-01/cmd", started))
+	assert.Empty(t, pushed)
+
+	replied := started.Add(350 * time.Millisecond)
+	assert.True(t, c.handle(message("t/acme/d/dev-01/cmd_reply", `{"meta":{"id":42},"ok":true}`, replied), "t/acme/d/dev-01/cmd_reply", replied))
+	if assert.Len(t, pushed, 1) {
+		exchange := pushed[0]
+		assert.Equal(t, "t/acme/d/dev-01/cmd", exchange.Optionname)
+		assert.Equal(t, `{"meta":{"id":42},"op":"on"}`, string(exchange.Body))
+		assert.Equal(t, `{"meta":{"id":42},"ok":true}`, string(exchange.Resp))
+		assert.Equal(t, 350*time.Millisecond, exchange.Durtion)
+		assert.Equal(t, 200, exchange.Status)
+	}
+
+	// 没有对应请求的响应、没有关联字段的消息与其它 topic 由调用方单独推送。
+	assert.False(t, c.handle(message("t/acme/d/dev-01/cmd_reply", `{"meta":{"id":42}}`, replied), "t/acme/d/dev-01/cmd_reply", replied))
+	assert.False(t, c.handle(message("t/acme/d/dev-01/cmd", `{"op":"on"}`, replied), "t/acme/d/dev-01/cmd", replied))
+	assert.False(t, c.handle(message("t/acme/d/dev-01/cmd", `not json`, replied), "t/acme/d/dev-01/cmd", replied))
+	assert.False(t, c.handle(message("t/acme/d/dev-01/event", `{"meta":{"id":1}}`, replied), "t/acme/d/dev-01/event", replied))
+	assert.Len(t, pushed, 1)
+}
+
+func TestCorrelatorSeparatesDevicesWithSameID(t *testing.T) {
+	pushed := []monitor.TracingDetails{}
+	c := newTestCorrelator(t, &pushed)
+	started := time.Unix(1714608000, 0)
+
+	// 两台设备使用相同的本地序号。
+	assert.True(t, c.handle(message("t/acme/d/dev-01/cmd", `{"meta":{"id":1},"op":"on"}`, started), "t/acme/d/dev-01/cmd", started))
+	assert.True(t, c.handle(message("t/acme/d/dev-02/cmd", `{"meta":{"id":1},"op":"off"}`, started), "t/acme/d/dev-02/cmd", started))
+	assert.Empty(t, pushed, "the second request must not evict the first as a timeout")
+
+	replied := started.Add(200 * time.Millisecond)
+	assert.True(t, c.handle(message("t/acme/d/dev-02/cmd_reply", `{"meta":{"id":1},"ok":2}`, replied), "t/acme/d/dev-02/cmd_reply", replied))
+	replied = started.Add(300 * time.Millisecond)
+	assert.True(t, c.handle(message("t/acme/d/dev-01/cmd_reply", `{"meta":{"id":1},"ok":1}`, replied), "t/acme/d/dev-01/cmd_reply", replied))
+	if assert.Len(t, pushed, 2) {
+		assert.Equal(t, `{"meta":{"id":1},"op":"off"}`, string(pushed[0].Body))
+		assert.Equal(t, `{"meta":{"id":1},"ok":2}`, string(pushed[0].Resp))
+		assert.Equal(t, 200*time.Millisecond, pushed[0].Durtion)
+		assert.Equal(t, `{"meta":{"id":1},"op":"on"}`, string(pushed[1].Body))
+		assert.Equal(t, `{"meta":{"id":1},"ok":1}`, string(pushed[1].Resp))
+		assert.Equal(t, 300*time.Millisecond, pushed[1].Durtion)
+	}
+
+	// 其它租户下同名设备的响应不会配对。
+	assert.True(t, c.handle(message("t/acme/d/dev-01/cmd", `{"meta":{"id":7}}`, started), "t/acme/d/dev-01/cmd", started))
+	assert.False(t, c.handle(message("t/other/d/dev-01/cmd_reply", `{"meta":{"id":7}}`, replied), "t/other/d/dev-01/cmd_reply", replied))
+}
+
+func TestCorrelatorPushesOutsideLock(t *testing.T) {
+	var c *correlator
+	c, err := newCorrelator(&CorrelationConfig{
+		RequestTopics:  []string{"t/{tenant}/d/{device}/cmd"},
+		ResponseTopics: []string{"t/{tenant}/d/{device}/cmd_reply"},
+		Field:          "id",
+		Timeout:        time.Second,
+	}, func(monitor.TracingDetails) {
+		// 推送时能再次获取锁，说明未在持锁时推送。
+		c.mu.Lock()
+		c.mu.Unlock()
+	}, zap.NewNop())
+	assert.NoError(t, err)
+	started := time.Unix(1714608000, 0)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.handle(message("t/acme/d/dev-01/cmd", `{"id":1}`, started), "t/acme/d/dev-01/cmd", started)
+		c.handle(message("t/acme/d/dev-01/cmd_reply", `{"id":1}`, started), "t/acme/d/dev-01/cmd_reply", started)
+		c.handle(message("t/acme/d/dev-01/cmd", `{"id":2}`, started), "t/acme/d/dev-01/cmd", started)
+		c.handle(message("t/acme/d/dev-01/cmd", `{"id":2}`, started), "t/acme/d/dev-01/cmd", started)
+		c.expire(started.Add(time.Minute))
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("push called while holding the correlator lock")
+	}
+}
+
+func TestCorrelatorTimeout(t *testing.T) {
+	pushed := []monitor.TracingDetails{}
+	c := newTestCorrelator(t, &pushed)
+	started := time.Unix(1714608000, 0)
+
+	assert.True(t, c.handle(message("t/acme/d/dev-01/cmd", `{"meta":{"id":"a"}}`, started), "t/acme/d/dev-01/cmd", started))
+	assert.True(t, c.handle(message("t/acme/d/dev-02/cmd", `{"meta":{"id":"b"}}`, started.Add(5*time.Second)), "t/acme/d/dev-02/cmd", started.Add(5*time.Second)))
+	// 超过 MaxPending 后不再配对。
+	assert.False(t, c.handle(message("t/acme/d/dev-03/cmd", `{"meta":{"id":"c"}}`, started), "t/acme/d/dev-03/cmd", started))
+
+	assert.Equal(t, 0, c.expire(started.Add(9*time.Second)))
+	assert.Equal(t, 1, c.expire(started.Add(10*time.Second)))
+	if assert.Len(t, pushed, 1) {
+		assert.Equal(t, StatusCorrelationTimeout, pushed[0].Status)
+		assert.Equal(t, 10*time.Second, pushed[0].Durtion)
+		assert.Nil(t, pushed[0].Resp)
+	}
+
+	// 关联字段被复用时，之前的请求按超时推送。
+	at := started.Add(11 * time.Second)
+	assert.True(t, c.handle(message("t/acme/d/dev-02/cmd", `{"meta":{"id":"b"}}`, at), "t/acme/d/dev-02/cmd", at))
+	if assert.Len(t, pushed, 2) {
+		assert.Equal(t, StatusCorrelationTimeout, pushed[1].Status)
+		assert.Equal(t, 6*time.Second, pushed[1].Durtion)
+	}
+}
+
+func TestNewCorrelatorDisabled(t *testing.T) {
+	c, err := newCorrelator(nil, nil, zap.NewNop())
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+	c, err = newCorrelator(&CorrelationConfig{Field: "id", RequestTopics: []string{"a"}}, nil, zap.NewNop())
+	assert.NoError(t, err)
+	assert.Nil(t, c)
+	_, err = newCorrelator(&CorrelationConfig{Field: "id", RequestTopics: []string{"a/#/b"}, ResponseTopics: []string{"r"}}, nil, zap.NewNop())
+	assert.Error(t, err)
+}
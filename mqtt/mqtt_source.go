@@ -13,19 +13,30 @@ import (
 	"go.uber.org/zap"
 )
 
+// MqttConfig tracing.mqtt 配置。
+// TopicTemplates: topic 模板，如 t/{tenant}/d/{device}/{event}，按顺序取第一个匹配的模板，
+// 提取 tenant/device/operator 到 TracingDetails 并生成归一化的 Optionname；均不匹配时 Optionname 为原始 topic。
+// Correlation: 可选，将请求与响应配对为一条 TracingDetails 并记录往返耗时。
+// PublishTimeout: TracedClient 等待 broker 确认发布的最长时间，缺省 10s。
 type MqttConfig struct {
 	SharedMode          bool
 	Topic               []string
 	TopicVerbosityLevel map[string]int
+	TopicTemplates      []string
+	Correlation         *CorrelationConfig
+	PublishTimeout      time.Duration
 }
 
 type MqttSource struct {
-	Config *MqttConfig
-	Client *mqttclient.MqttService
-	Logger *zap.Logger
+	Config     *MqttConfig
+	Service    *monitor.TracingRequestService
+	Client     *mqttclient.MqttService
+	Logger     *zap.Logger
+	templates  []*topicTemplate
+	correlator *correlator
 }
 
-func NewMqttSource(logger *zap.Logger) (*MqttSource, error) {
+func NewMqttSource(logger *zap.Logger, sr *monitor.TracingRequestService) (*MqttSource, error) {
 	settings := viper.Sub("tracing.mqtt")
 	if settings == nil {
 		return nil, nil
@@ -38,6 +49,22 @@ func NewMqttSource(logger *zap.Logger) (*MqttSource, error) {
 		logger.Error("failed to unmarshal mqtt config", zap.Error(err))
 		return nil, err
 	}
+	templates, err := compileTopicTemplates(conf.TopicTemplates)
+	if err != nil {
+		logger.Error("invalid mqtt topic template", zap.Error(err))
+		return nil, err
+	}
+	push := func(details monitor.TracingDetails) {
+		monitor.PushTracing(sr, &details, nil)
+	}
+	correlator, err := newCorrelator(conf.Correlation, push, logger)
+	if err != nil {
+		logger.Error("invalid mqtt correlation config", zap.Error(err))
+		return nil, err
+	}
+	if correlator != nil && conf.SharedMode {
+		logger.Warn("mqtt correlation enabled with shared subscription, requests and responses received by different instances will not be paired")
+	}
 
 	client, err := mqttclient.InitMqttService("monitor-{{.hostname}}", 1, true, "")
 	if err != nil {
@@ -46,9 +73,12 @@ func NewMqttSource(logger *zap.Logger) (*MqttSource, error) {
 	}
 
 	return &MqttSource{
-		Config: conf,
-		Logger: logger,
-		Client: client,
+		Config:     conf,
+		Service:    sr,
+		Logger:     logger,
+		Client:     client,
+		templates:  templates,
+		correlator: correlator,
 	}, nil
 }
 
@@ -57,6 +87,13 @@ func (ms *MqttSource) Start() {
 		ms.Logger.Warn("mqtt tracing source enabled, but no topic configured")
 		return
 	}
+	if ms.correlator != nil {
+		go ms.correlator.run(core.RootCtx())
+		ms.Logger.Info("mqtt request/response correlation enabled",
+			zap.String("field", ms.Config.Correlation.Field),
+			zap.Duration("timeout", ms.correlator.timeout),
+		)
+	}
 
 	for _, topic := range ms.Config.Topic {
 		if ms.Config.SharedMode {
@@ -71,37 +108,51 @@ func (ms *MqttSource) Start() {
 	}
 }
 
-func (ms *MqttSource) onMessage(client mqtt.Client, msg mqtt.Message) {
-	verbosityLevel := monitor.TracingVerbosityLevelRead
-	if ms.Config != nil && ms.Config.TopicVerbosityLevel != nil {
-		if lvl, ok := ms.Config.TopicVerbosityLevel[msg.Topic()]; ok {
-			verbosityLevel = monitor.TracingVerbosityLevel(lvl)
-		} else {
-			for pattern, lvl := range ms.Config.TopicVerbosityLevel {
-				if strings.Contains(pattern, "*") {
-					if matched, _ := doublestar.Match(pattern, msg.Topic()); matched {
-						verbosityLevel = monitor.TracingVerbosityLevel(lvl)
-						break
-					}
-				}
+// verbosityLevel 按 TopicVerbosityLevel 计算 topic 的级别，先精确匹配再按通配符匹配，缺省为 Read。
+func (conf *MqttConfig) verbosityLevel(topic string) monitor.TracingVerbosityLevel {
+	if lvl, ok := conf.TopicVerbosityLevel[topic]; ok {
+		return monitor.TracingVerbosityLevel(lvl)
+	}
+	for pattern, lvl := range conf.TopicVerbosityLevel {
+		if strings.Contains(pattern, "*") {
+			if matched, _ := doublestar.Match(pattern, topic); matched {
+				return monitor.TracingVerbosityLevel(lvl)
 			}
 		}
 	}
+	return monitor.TracingVerbosityLevelRead
+}
+
+func (ms *MqttSource) onMessage(client mqtt.Client, msg mqtt.Message) {
+	details := ms.tracingDetails(msg.Topic(), msg.Payload())
+	if ms.correlator != nil && ms.correlator.handle(details, msg.Topic(), time.Now()) {
+		return
+	}
+	monitor.PushTracing(ms.Service, &details, nil)
+}
+
+// tracingDetails 将收到的消息转换为 TracingDetails。
+func (ms *MqttSource) tracingDetails(topic string, payload []byte) monitor.TracingDetails {
+	verbosityLevel := monitor.TracingVerbosityLevelRead
+	if ms.Config != nil {
+		verbosityLevel = ms.Config.verbosityLevel(topic)
+	}
 	details := monitor.TracingDetails{
-		Optionname:     msg.Topic(),
-		Uri:            "mqtt://" + msg.Topic(),
-		Method:         "MQTT",
+		Optionname:     topic,
+		Uri:            "mqtt://" + topic,
+		Method:         MethodMQTT,
 		AppName:        core.AppName,
 		AppVersion:     core.Version,
 		VerbosityLevel: verbosityLevel,
-		Body:           append([]byte(nil), msg.Payload()...),
-		BodyEnc:        monitor.DetectPayloadEncoding(msg.Payload()),
+		Body:           append([]byte(nil), payload...),
+		BodyEnc:        monitor.DetectPayloadEncoding(payload),
 		Durtion:        0, // Message receipt is instantaneous in this context
 		Status:         200,
 		StartedAt:      time.Now(),
 		// Fill other fields if necessary
 	}
-	monitor.TracingAdaptor.Push(details)
+	applyTopicTemplates(ms.templates, topic, &details)
+	return details
 }
 
 func init() {
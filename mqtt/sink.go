@@ -0,0 +1,282 @@
+package mqtt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/spf13/viper"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/mqttclient"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultTracingTopic  = "monitor/tracing"
+	DefaultErrorTopic    = "monitor/error"
+	DefaultScheduleTopic = "monitor/schedule"
+)
+
+// sinkEnabled 本进程是否启用了 MqttSink，用于阻止同一进程再启用 MqttCollector 造成回环。
+var sinkEnabled bool
+
+// MqttSinkConfig tracing.mqttSink 配置。
+// TracingTopic/ErrorTopic/ScheduleTopic: 三类数据的发布 topic。
+// QoS: 发布使用的 QoS（0、1、2），缺省 1。
+// BatchSize/FlushInterval: 每条 MQTT 消息最多包含的记录数与最长聚合时间。
+// QueueSize: 每类数据的本地队列长度，队列满时丢弃。
+// PublishTimeout: 等待 broker 确认的最长时间。
+// ShutdownTimeout: 停机时等待队列排空的最长时间。
+type MqttSinkConfig struct {
+	TracingTopic    string
+	ErrorTopic      string
+	ScheduleTopic   string
+	QoS             byte
+	BatchSize       int
+	FlushInterval   time.Duration
+	QueueSize       int
+	PublishTimeout  time.Duration
+	ShutdownTimeout time.Duration
+	Included        []string
+	Excluded        []string
+	IncludedIPs     []string
+	ExcludedIPs     []string
+}
+
+// errorMessage core.ErrorReport 的传输格式，error 接口无法直接序列化为 JSON。
+type errorMessage struct {
+	Error      string
+	Uri        string
+	FullStack  []byte
+	HappendAT  time.Time
+	AppName    string
+	AppVersion string
+}
+
+// publisher 发布消息所需的客户端能力，mqtt.Client 满足该接口。
+type publisher interface {
+	Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token
+}
+
+// MqttSink 将 tracing、错误与定时任务以 JSON 数组批量发布到 MQTT，供只有 MQTT 上行链路的边缘网关转发监控数据。
+type MqttSink struct {
+	monitor.BaseFilter
+	Config   *MqttSinkConfig
+	Logger   *zap.Logger
+	client   publisher
+	tracing  *monitor.BatchQueue[json.RawMessage]
+	errs     *monitor.BatchQueue[json.RawMessage]
+	jobs     *monitor.BatchQueue[json.RawMessage]
+	shutdown sync.Once
+}
+
+func applySinkDefaults(conf *MqttSinkConfig) {
+	if conf.TracingTopic == "" {
+		conf.TracingTopic = DefaultTracingTopic
+	}
+	if conf.ErrorTopic == "" {
+		conf.ErrorTopic = DefaultErrorTopic
+	}
+	if conf.ScheduleTopic == "" {
+		conf.ScheduleTopic = DefaultScheduleTopic
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 100
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = time.Second
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 10000
+	}
+	if conf.PublishTimeout <= 0 {
+		conf.PublishTimeout = defaultPublishTimeout
+	}
+	if conf.ShutdownTimeout <= 0 {
+		conf.ShutdownTimeout = 5 * time.Second
+	}
+}
+
+// NewMqttSink 创建 sink 并启动后台批量发布协程。
+// conf: 发布配置。
+// client: MQTT 客户端。
+// 返回值：QoS 无效时返回错误。
+func NewMqttSink(conf *MqttSinkConfig, client publisher, logger *zap.Logger) (*MqttSink, error) {
+	if conf == nil || client == nil {
+		return nil, errors.New("mqtt sink config and client are required")
+	}
+	if conf.QoS > 2 {
+		return nil, fmt.Errorf("invalid mqtt qos %d", conf.QoS)
+	}
+	applySinkDefaults(conf)
+
+	s := &MqttSink{
+		BaseFilter: monitor.BaseFilter{
+			Included:    conf.Included,
+			Excluded:    conf.Excluded,
+			IncludedIPs: conf.IncludedIPs,
+			ExcludedIPs: conf.ExcludedIPs,
+		},
+		Config: conf,
+		Logger: logger,
+		client: client,
+	}
+	opts := monitor.BatchOptions{
+		Name:          "mqtt-sink",
+		QueueSize:     conf.QueueSize,
+		BatchSize:     conf.BatchSize,
+		FlushInterval: conf.FlushInterval,
+	}
+	s.tracing = monitor.NewBatchQueue(opts, logger, s.publishTo(conf.TracingTopic))
+	s.errs = monitor.NewBatchQueue(opts, logger, s.publishTo(conf.ErrorTopic))
+	s.jobs = monitor.NewBatchQueue(opts, logger, s.publishTo(conf.ScheduleTopic))
+	return s, nil
+}
+
+// publishTo 返回发布到 topic 的批量发送函数。
+func (s *MqttSink) publishTo(topic string) func([]json.RawMessage) error {
+	return func(items []json.RawMessage) error {
+		return s.publish(topic, items)
+	}
+}
+
+// publish 将一批记录编码为 JSON 数组发布，并等待 broker 确认。
+func (s *MqttSink) publish(topic string, items []json.RawMessage) error {
+	payload, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	token := s.client.Publish(topic, s.Config.QoS, false, payload)
+	if !token.WaitTimeout(s.Config.PublishTimeout) {
+		return fmt.Errorf("publish to %s timeout after %s", topic, s.Config.PublishTimeout)
+	}
+	if err := token.Error(); err != nil {
+		return fmt.Errorf("publish to %s: %w", topic, err)
+	}
+	return nil
+}
+
+// enqueue 编码后入队，队列满或停机中时由 BatchQueue 丢弃并告警。
+func (s *MqttSink) enqueue(queue *monitor.BatchQueue[json.RawMessage], item any, source string) error {
+	payload, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	queue.Push(payload, source)
+	return nil
+}
+
+func (s *MqttSink) ReportTracing(tr monitor.TracingDetails) error {
+	return s.enqueue(s.tracing, tr, "tracing")
+}
+
+func (s *MqttSink) ReportError(rr core.ErrorReport) error {
+	msg := errorMessage{
+		Uri:        rr.Uri,
+		FullStack:  rr.FullStack,
+		HappendAT:  rr.HappendAT,
+		AppName:    rr.AppName,
+		AppVersion: rr.AppVersion,
+	}
+	if rr.Error != nil {
+		msg.Error = rr.Error.Error()
+	}
+	if msg.AppName == "" {
+		msg.AppName = core.AppName
+		msg.AppVersion = core.Version
+	}
+	return s.enqueue(s.errs, msg, "error")
+}
+
+func (s *MqttSink) ReportScheduleJob(req schedule.JobHistory) error {
+	return s.enqueue(s.jobs, req, "schedule")
+}
+
+// Shutdown 停止接收新数据并等待三类队列发布完毕，最多等待 ShutdownTimeout。
+func (s *MqttSink) Shutdown() {
+	s.shutdown.Do(func() {
+		s.tracing.Close()
+		s.errs.Close()
+		s.jobs.Close()
+		if monitor.WaitDone(s.Config.ShutdownTimeout, s.tracing.Done(), s.errs.Done(), s.jobs.Done()) {
+			s.Logger.Info("[mqtt-sink] pending data published")
+			return
+		}
+		s.Logger.Warn("[mqtt-sink] flush timeout reached, stop waiting",
+			zap.Int("tracing", s.tracing.Len()),
+			zap.Int("errors", s.errs.Len()),
+			zap.Int("jobs", s.jobs.Len()),
+		)
+	})
+}
+
+// InitMqttSink 从 tracing.mqttSink 读取配置并连接 MQTT。
+// 返回值：未配置 tracing.mqttSink 时返回 nil。
+func InitMqttSink(logger *zap.Logger) (*MqttSink, error) {
+	if !viper.IsSet("tracing.mqttSink") {
+		logger.Info("no mqtt sink config, return nil")
+		return nil, nil
+	}
+	conf := &MqttSinkConfig{QoS: 1}
+	if err := viper.UnmarshalKey("tracing.mqttSink", conf); err != nil {
+		logger.Error("mqtt sink config error.", zap.Error(err))
+		return nil, err
+	}
+	if conf.QoS > 2 {
+		return nil, fmt.Errorf("invalid mqtt qos %d", conf.QoS)
+	}
+	svc, err := mqttclient.InitMqttService("monitor-sink-{{.hostname}}", conf.QoS, true, "")
+	if err != nil {
+		logger.Error("connect to mqtt for monitor sink failed.", zap.Error(err))
+		return nil, err
+	}
+	s, err := NewMqttSink(conf, svc.Client, logger)
+	if err != nil {
+		return nil, err
+	}
+	core.OnServiceStopping(s.Shutdown)
+	logger.Info("mqtt sink is ready",
+		zap.String("tracingTopic", conf.TracingTopic),
+		zap.String("errorTopic", conf.ErrorTopic),
+		zap.String("scheduleTopic", conf.ScheduleTopic),
+		zap.Uint8("qos", conf.QoS),
+		zap.Int("batchSize", conf.BatchSize),
+		zap.Duration("flushInterval", conf.FlushInterval),
+	)
+	return s, nil
+}
+
+// EnableMqttSink 向容器注册 MQTT sink，并在启动时订阅监控事件。
+func EnableMqttSink() {
+	sinkEnabled = true
+	core.Provide(InitMqttSink)
+	core.ProvideStartup(func(logger *zap.Logger, s *MqttSink) core.Startup {
+		if s != nil {
+			monitor.SubscribeMonitor(logger, s)
+		}
+		return nil
+	})
+}
+
+// decodeBatch 解析 sink 发布的 JSON 数组，也兼容单条 JSON 对象。
+func decodeBatch[T any](payload []byte) ([]T, error) {
+	payload = bytes.TrimSpace(payload)
+	if len(payload) > 0 && payload[0] == '{' {
+		var item T
+		if err := json.Unmarshal(payload, &item); err != nil {
+			return nil, err
+		}
+		return []T{item}, nil
+	}
+	var items []T
+	if err := json.Unmarshal(payload, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
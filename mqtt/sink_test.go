@@ -0,0 +1,123 @@
+package mqtt
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+)
+
+type publishedMessage struct {
+	topic   string
+	qos     byte
+	payload []byte
+}
+
+// recordingPublisher 记录发布的消息，立即确认。
+type recordingPublisher struct {
+	mu       sync.Mutex
+	messages []publishedMessage
+}
+
+func (p *recordingPublisher) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	p.mu.Lock()
+	p.messages = append(p.messages, publishedMessage{topic: topic, qos: qos, payload: payload.([]byte)})
+	p.mu.Unlock()
+	token := &fakeToken{done: make(chan struct{})}
+	close(token.done)
+	return token
+}
+
+func (p *recordingPublisher) byTopic(topic string) [][]byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := [][]byte{}
+	for _, msg := range p.messages {
+		if msg.topic == topic {
+			out = append(out, msg.payload)
+		}
+	}
+	return out
+}
+
+func TestMqttSinkBatchesAndRoundTrips(t *testing.T) {
+	pub := &recordingPublisher{}
+	sink, err := NewMqttSink(&MqttSinkConfig{QoS: 1, BatchSize: 2, FlushInterval: time.Hour}, pub, zap.NewNop())
+	assert.NoError(t, err)
+
+	started := time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC)
+	for _, uri := range []string{"/a", "/b", "/c"} {
+		assert.NoError(t, sink.ReportTracing(monitor.TracingDetails{Uri: uri, Status: 200, StartedAt: started, Body: []byte{0xff, 0x00}}))
+	}
+	assert.NoError(t, sink.ReportError(core.ErrorReport{Error: errors.New("boom"), Uri: "/a", FullStack: []byte("stack"), HappendAT: started, AppName: "edge"}))
+	assert.NoError(t, sink.ReportScheduleJob(schedule.JobHistory{Job: "sync", Duration: time.Second, Succeed: true}))
+
+	// BatchSize 达到后立即发布第一批，其余在停机时发布。
+	assert.Eventually(t, func() bool { return len(pub.byTopic(DefaultTracingTopic)) == 1 }, time.Second, 10*time.Millisecond)
+	sink.Shutdown()
+	assert.NoError(t, sink.ReportTracing(monitor.TracingDetails{Uri: "/late"}))
+
+	batches := pub.byTopic(DefaultTracingTopic)
+	if assert.Len(t, batches, 2) {
+		first, err := decodeBatch[monitor.TracingDetails](batches[0])
+		assert.NoError(t, err)
+		second, err := decodeBatch[monitor.TracingDetails](batches[1])
+		assert.NoError(t, err)
+		assert.Len(t, first, 2)
+		assert.Len(t, second, 1)
+		assert.Equal(t, "/a", first[0].Uri)
+		assert.Equal(t, []byte{0xff, 0x00}, first[0].Body)
+		assert.True(t, started.Equal(first[0].StartedAt))
+	}
+
+	errs := pub.byTopic(DefaultErrorTopic)
+	if assert.Len(t, errs, 1) {
+		reports, err := decodeErrorBatch(errs[0])
+		assert.NoError(t, err)
+		assert.EqualError(t, reports[0].Error, "boom")
+		assert.Equal(t, []byte("stack"), reports[0].FullStack)
+		assert.Equal(t, "edge", reports[0].AppName)
+	}
+
+	jobs := pub.byTopic(DefaultScheduleTopic)
+	if assert.Len(t, jobs, 1) {
+		items, err := decodeBatch[schedule.JobHistory](jobs[0])
+		assert.NoError(t, err)
+		assert.Equal(t, []schedule.JobHistory{{Job: "sync", Duration: time.Second, Succeed: true}}, items)
+	}
+	for _, msg := range pub.messages {
+		assert.Equal(t, byte(1), msg.qos)
+	}
+}
+
+func TestNewMqttSinkValidation(t *testing.T) {
+	_, err := NewMqttSink(&MqttSinkConfig{QoS: 3}, &recordingPublisher{}, zap.NewNop())
+	assert.Error(t, err)
+	_, err = NewMqttSink(&MqttSinkConfig{}, nil, zap.NewNop())
+	assert.Error(t, err)
+}
+
+func TestDecodeBatchAcceptsSingleObject(t *testing.T) {
+	items, err := decodeBatch[schedule.JobHistory]([]byte(` {"Job":"sync","Succeed":true}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []schedule.JobHistory{{Job: "sync", Succeed: true}}, items)
+	_, err = decodeBatch[schedule.JobHistory]([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestDecodeErrorBatchKeepsNilError(t *testing.T) {
+	reports, err := decodeErrorBatch([]byte(`[{"Error":"","Uri":"/a"},{"Error":"boom","Uri":"/b"}]`))
+	assert.NoError(t, err)
+	if assert.Len(t, reports, 2) {
+		assert.NoError(t, reports[0].Error)
+		assert.Equal(t, "/a", reports[0].Uri)
+		assert.EqualError(t, reports[1].Error, "boom")
+	}
+}
@@ -0,0 +1,145 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/techquest-tech/monitor"
+)
+
+// topicFields 模板中可提取到 TracingDetails 的命名段。
+// 这些段在归一化后的 Optionname 中保留占位符，避免设备、租户等高基数值进入操作名。
+var topicFields = map[string]func(*monitor.TracingDetails, string){
+	"tenant":   func(tr *monitor.TracingDetails, v string) { tr.Tenant = v },
+	"device":   func(tr *monitor.TracingDetails, v string) { tr.Device = v },
+	"operator": func(tr *monitor.TracingDetails, v string) { tr.Operator = v },
+}
+
+// topicSegment 模板中的一段。
+// name 非空时为命名段 {name}；literal 为字面量或通配符 +、#。
+type topicSegment struct {
+	name    string
+	literal string
+}
+
+// topicTemplate 编译后的 topic 模板，如 t/{tenant}/d/{device}/{event}。
+type topicTemplate struct {
+	raw      string
+	segments []topicSegment
+}
+
+// topicMatch 模板匹配结果。
+// Values: 命名段的取值。
+// Optionname: 归一化后的操作名。
+type topicMatch struct {
+	Values     map[string]string
+	Optionname string
+}
+
+// compileTopicTemplate 编译 topic 模板。
+// 段的写法：{name} 匹配单层并命名，+ 匹配单层，# 匹配剩余所有层（只能在末尾），其余为字面量。
+// 返回值：模板为空、命名重复或 # 不在末尾时返回错误。
+func compileTopicTemplate(raw string) (*topicTemplate, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, fmt.Errorf("empty topic template")
+	}
+	parts := strings.Split(raw, "/")
+	tpl := &topicTemplate{raw: raw}
+	names := map[string]bool{}
+	for i, part := range parts {
+		switch {
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			name := strings.ToLower(strings.TrimSpace(part[1 : len(part)-1]))
+			if name == "" {
+				return nil, fmt.Errorf("topic template %q: empty segment name", raw)
+			}
+			if names[name] {
+				return nil, fmt.Errorf("topic template %q: duplicate segment %q", raw, name)
+			}
+			names[name] = true
+			tpl.segments = append(tpl.segments, topicSegment{name: name})
+		case part == "#" && i != len(parts)-1:
+			return nil, fmt.Errorf("topic template %q: # must be the last segment", raw)
+		case strings.ContainsAny(part, "{}"):
+			return nil, fmt.Errorf("topic template %q: invalid segment %q", raw, part)
+		default:
+			tpl.segments = append(tpl.segments, topicSegment{literal: part})
+		}
+	}
+	return tpl, nil
+}
+
+// match 按模板匹配 topic。
+// 归一化 Optionname：映射到 TracingDetails 的段（tenant/device/operator）与通配符保留原样，其余命名段替换为实际值。
+// 返回值：不匹配时返回 false。
+func (tpl *topicTemplate) match(topic string) (topicMatch, bool) {
+	levels := strings.Split(topic, "/")
+	result := topicMatch{Values: map[string]string{}}
+	normalized := make([]string, 0, len(tpl.segments))
+	for i, seg := range tpl.segments {
+		if seg.literal == "#" {
+			normalized = append(normalized, "#")
+			result.Optionname = strings.Join(normalized, "/")
+			return result, true
+		}
+		if i >= len(levels) {
+			return topicMatch{}, false
+		}
+		level := levels[i]
+		switch {
+		case seg.name != "":
+			if level == "" {
+				return topicMatch{}, false
+			}
+			result.Values[seg.name] = level
+			if _, ok := topicFields[seg.name]; ok {
+				normalized = append(normalized, "{"+seg.name+"}")
+			} else {
+				normalized = append(normalized, level)
+			}
+		case seg.literal == "+":
+			normalized = append(normalized, "+")
+		case seg.literal != level:
+			return topicMatch{}, false
+		default:
+			normalized = append(normalized, level)
+		}
+	}
+	if len(levels) != len(tpl.segments) {
+		return topicMatch{}, false
+	}
+	result.Optionname = strings.Join(normalized, "/")
+	return result, true
+}
+
+// compileTopicTemplates 按配置顺序编译模板。
+func compileTopicTemplates(raws []string) ([]*topicTemplate, error) {
+	out := make([]*topicTemplate, 0, len(raws))
+	for _, raw := range raws {
+		tpl, err := compileTopicTemplate(raw)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tpl)
+	}
+	return out, nil
+}
+
+// applyTopicTemplates 使用第一个匹配的模板填充 tracing 的 Optionname、Tenant、Device、Operator。
+// 返回值：是否有模板匹配。
+func applyTopicTemplates(templates []*topicTemplate, topic string, tr *monitor.TracingDetails) bool {
+	for _, tpl := range templates {
+		m, ok := tpl.match(topic)
+		if !ok {
+			continue
+		}
+		tr.Optionname = m.Optionname
+		for name, value := range m.Values {
+			if set, ok := topicFields[name]; ok {
+				set(tr, value)
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/monitor"
+)
+
+func TestTopicTemplateMatch(t *testing.T) {
+	tpl, err := compileTopicTemplate("t/{tenant}/d/{device}/{event}")
+	assert.NoError(t, err)
+
+	m, ok := tpl.match("t/acme/d/dev-01/telemetry")
+	assert.True(t, ok)
+	assert.Equal(t, map[string]string{"tenant": "acme", "device": "dev-01", "event": "telemetry"}, m.Values)
+	assert.Equal(t, "t/{tenant}/d/{device}/telemetry", m.Optionname)
+
+	for _, topic := range []string{"t/acme/d/dev-01", "t/acme/d/dev-01/telemetry/extra", "x/acme/d/dev-01/telemetry", "t//d/dev-01/telemetry"} {
+		_, ok = tpl.match(topic)
+		assert.False(t, ok, topic)
+	}
+
+	tpl, err = compileTopicTemplate("cmd/{device}/+/#")
+	assert.NoError(t, err)
+	m, ok = tpl.match("cmd/dev-01/req-42/a/b")
+	assert.True(t, ok)
+	assert.Equal(t, "cmd/{device}/+/#", m.Optionname)
+	assert.Equal(t, "dev-01", m.Values["device"])
+}
+
+func TestCompileTopicTemplateErrors(t *testing.T) {
+	for _, raw := range []string{"", "a/#/b", "a/{}/b", "a/{device}/{device}", "a/x{y}"} {
+		_, err := compileTopicTemplate(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestTracingDetailsFromTemplates(t *testing.T) {
+	templates, err := compileTopicTemplates([]string{"t/{tenant}/d/{device}/{event}", "t/{tenant}/u/{operator}/{event}"})
+	assert.NoError(t, err)
+	ms := &MqttSource{
+		Config:    &MqttConfig{TopicVerbosityLevel: map[string]int{"t/*/u/**": int(monitor.TracingVerbosityLevelWrite)}},
+		templates: templates,
+	}
+
+	tr := ms.tracingDetails("t/acme/u/alice/login", []byte(`{}`))
+	assert.Equal(t, "acme", tr.Tenant)
+	assert.Equal(t, "alice", tr.Operator)
+	assert.Empty(t, tr.Device)
+	assert.Equal(t, "t/{tenant}/u/{operator}/login", tr.Optionname)
+	assert.Equal(t, "mqtt://t/acme/u/alice/login", tr.Uri)
+	assert.Equal(t, monitor.TracingVerbosityLevelWrite, tr.VerbosityLevel)
+
+	tr = ms.tracingDetails("other/topic", nil)
+	assert.Equal(t, "other/topic", tr.Optionname)
+	assert.Empty(t, tr.Tenant)
+}
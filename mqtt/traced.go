@@ -0,0 +1,241 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/mqttclient"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+)
+
+// MethodMQTT MQTT 流量在 TracingDetails.Method 中的取值。
+const MethodMQTT = "MQTT"
+
+// defaultPublishTimeout 等待 broker 确认发布的缺省时长。
+const defaultPublishTimeout = 10 * time.Second
+
+// HandlerFunc 可返回错误的消息处理函数，返回错误时 tracing 状态为 500 并上报 ErrorReport。
+type HandlerFunc func(client mqtt.Client, msg mqtt.Message) error
+
+// TracedClient 包装 paho 客户端，记录本应用发布的消息与消息处理函数的耗时、QoS、retained 与错误/panic。
+// Service: tracing 配置，用于过滤、采样、脱敏与正文采集开关；为 nil 时全部记录。
+// Config: 可选，复用 tracing.mqtt 的 TopicVerbosityLevel、TopicTemplates 与 PublishTimeout。
+type TracedClient struct {
+	mqtt.Client
+	Service   *monitor.TracingRequestService
+	Config    *MqttConfig
+	templates []*topicTemplate
+}
+
+// NewTracedClient 创建带 tracing 的 paho 客户端。
+// client: 原始客户端。
+// sr: tracing 配置，可为 nil。
+// conf: MQTT 配置，可为 nil。
+// 返回值：topic 模板无效时返回错误。
+func NewTracedClient(client mqtt.Client, sr *monitor.TracingRequestService, conf *MqttConfig) (*TracedClient, error) {
+	tc := &TracedClient{Client: client, Service: sr, Config: conf}
+	if conf != nil {
+		templates, err := compileTopicTemplates(conf.TopicTemplates)
+		if err != nil {
+			return nil, err
+		}
+		tc.templates = templates
+	}
+	return tc, nil
+}
+
+// NewTracedService 为 mqttclient.MqttService 的底层客户端创建 TracedClient。
+func NewTracedService(svc *mqttclient.MqttService, sr *monitor.TracingRequestService, conf *MqttConfig) (*TracedClient, error) {
+	return NewTracedClient(svc.Client, sr, conf)
+}
+
+func (tc *TracedClient) shouldLog(topic string) bool {
+	return tc.Service == nil || tc.Service.ShouldLogReq(context.Background(), topic)
+}
+
+func (tc *TracedClient) captureRequest() bool {
+	return tc.Service == nil || tc.Service.Request
+}
+
+func (tc *TracedClient) publishTimeout() time.Duration {
+	if tc.Config == nil || tc.Config.PublishTimeout <= 0 {
+		return defaultPublishTimeout
+	}
+	return tc.Config.PublishTimeout
+}
+
+// newDetails 生成 MQTT tracing 详情，Uri 中附带 qos 与 retained。
+func (tc *TracedClient) newDetails(topic string, qos byte, retained bool, level monitor.TracingVerbosityLevel) *monitor.TracingDetails {
+	uri := "mqtt://" + topic + "?qos=" + strconv.Itoa(int(qos))
+	if retained {
+		uri += "&retained=true"
+	}
+	details := &monitor.TracingDetails{
+		Optionname:     topic,
+		Uri:            uri,
+		Method:         MethodMQTT,
+		AppName:        core.AppName,
+		AppVersion:     core.Version,
+		VerbosityLevel: level,
+		Status:         200,
+		StartedAt:      time.Now(),
+	}
+	applyTopicTemplates(tc.templates, topic, details)
+	return details
+}
+
+// reportError 记录日志并上报 ErrorReport。
+// stack: panic 时的调用栈，其它情况为 nil。
+func reportError(uri, topic string, err error, stack []byte) {
+	core.ErrorAdaptor.Push(core.ErrorReport{
+		Error:     fmt.Errorf("mqtt %s, err %v", uri, err),
+		Uri:       uri,
+		FullStack: stack,
+		HappendAT: time.Now(),
+	})
+	zap.L().Error("mqtt message error", zap.String("Optionname", topic), zap.Error(err))
+}
+
+// finish 补全耗时与状态，失败时上报 ErrorReport。
+// stack: panic 时的调用栈，其它情况为 nil。
+func (tc *TracedClient) finish(details *monitor.TracingDetails, err error, stack []byte) {
+	details.Durtion = time.Since(details.StartedAt)
+	if err != nil {
+		details.Status = 500
+		details.Resp = []byte("error:" + err.Error())
+		reportError(details.Uri, details.Optionname, err, stack)
+	}
+	details.BodyEnc = monitor.DetectPayloadEncoding(details.Body)
+	details.RespEnc = monitor.DetectPayloadEncoding(details.Resp)
+	monitor.PushTracing(tc.Service, details, nil)
+}
+
+// WrapHandler 包装消息处理函数，记录处理耗时与结果。
+// 处理函数 panic 时会被恢复并记录为 500（附带调用栈），避免 paho 的回调 goroutine 导致进程退出。
+func (tc *TracedClient) WrapHandler(handler HandlerFunc) mqtt.MessageHandler {
+	return func(client mqtt.Client, msg mqtt.Message) {
+		tc.handle(handler, client, msg)
+	}
+}
+
+// handle 执行处理函数并推送 tracing。
+// topic 被过滤时只跳过 tracing，处理失败或 panic 仍记录日志并上报 ErrorReport。
+// 返回值：推送的 tracing 详情；topic 被过滤时返回 nil。
+func (tc *TracedClient) handle(handler HandlerFunc, client mqtt.Client, msg mqtt.Message) *monitor.TracingDetails {
+	if !tc.shouldLog(msg.Topic()) {
+		if result := runHandler(handler, client, msg); result.err != nil {
+			reportError("mqtt://"+msg.Topic(), msg.Topic(), result.err, result.stack)
+		}
+		return nil
+	}
+	level := monitor.TracingVerbosityLevelRead
+	if tc.Config != nil {
+		level = tc.Config.verbosityLevel(msg.Topic())
+	}
+	details := tc.newDetails(msg.Topic(), msg.Qos(), msg.Retained(), level)
+	details.ApplyTrace(monitor.NewTraceContext())
+	if tc.captureRequest() {
+		details.Body = append([]byte(nil), msg.Payload()...)
+	}
+	result := runHandler(handler, client, msg)
+	tc.finish(details, result.err, result.stack)
+	return details
+}
+
+// WrapMessageHandler 包装 paho 原生的消息处理函数（无返回值），仅 panic 视为失败。
+func (tc *TracedClient) WrapMessageHandler(handler mqtt.MessageHandler) mqtt.MessageHandler {
+	if handler == nil {
+		return nil
+	}
+	return tc.WrapHandler(func(client mqtt.Client, msg mqtt.Message) error {
+		handler(client, msg)
+		return nil
+	})
+}
+
+type handlerResult struct {
+	err   error
+	stack []byte
+}
+
+// runHandler 执行处理函数并恢复 panic。
+func runHandler(handler HandlerFunc, client mqtt.Client, msg mqtt.Message) (result handlerResult) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result = handlerResult{err: fmt.Errorf("panic: %v", recovered), stack: debug.Stack()}
+		}
+	}()
+	return handlerResult{err: handler(client, msg)}
+}
+
+// Subscribe 订阅并包装回调；callback 为 nil 时使用客户端默认回调，不记录。
+func (tc *TracedClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	return tc.Client.Subscribe(topic, qos, tc.WrapMessageHandler(callback))
+}
+
+// SubscribeMultiple 批量订阅并包装回调。
+func (tc *TracedClient) SubscribeMultiple(filters map[string]byte, callback mqtt.MessageHandler) mqtt.Token {
+	return tc.Client.SubscribeMultiple(filters, tc.WrapMessageHandler(callback))
+}
+
+// AddRoute 注册路由并包装回调。
+func (tc *TracedClient) AddRoute(topic string, callback mqtt.MessageHandler) {
+	tc.Client.AddRoute(topic, tc.WrapMessageHandler(callback))
+}
+
+// Publish 发布消息并记录，等价于 PublishContext(context.Background(), ...)。
+func (tc *TracedClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	return tc.PublishContext(context.Background(), topic, qos, retained, payload)
+}
+
+// PublishContext 发布消息并记录为对外调用（TracingVerbosityLevelThirdParty）。
+// ctx 中带有链路信息时生成子 span，否则开启新链路。
+// 不阻塞调用方：在 token 完成（broker 确认或失败）后再推送 tracing，耗时为发布到确认的时间；
+// 超过 PublishTimeout 仍未完成（如断线时的 QoS>0 发布）时按超时失败记录，等待的 goroutine 随之退出。
+func (tc *TracedClient) PublishContext(ctx context.Context, topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	if !tc.shouldLog(topic) {
+		return tc.Client.Publish(topic, qos, retained, payload)
+	}
+	trace := monitor.NewTraceContext()
+	if parent, ok := monitor.TraceFromContext(ctx); ok {
+		trace = parent.Child()
+	}
+	details := tc.newDetails(topic, qos, retained, monitor.TracingVerbosityLevelThirdParty)
+	details.ApplyTrace(trace)
+	if tc.captureRequest() {
+		details.Body = payloadBytes(payload)
+	}
+	token := tc.Client.Publish(topic, qos, retained, payload)
+	timeout := tc.publishTimeout()
+	go func() {
+		if !token.WaitTimeout(timeout) {
+			tc.finish(details, fmt.Errorf("publish not acknowledged within %s", timeout), nil)
+			return
+		}
+		tc.finish(details, token.Error(), nil)
+	}()
+	return token
+}
+
+// payloadBytes 复制 paho 支持的 payload 类型（string、[]byte、bytes.Buffer）。
+func payloadBytes(payload interface{}) []byte {
+	switch p := payload.(type) {
+	case string:
+		return []byte(p)
+	case []byte:
+		return append([]byte(nil), p...)
+	case bytes.Buffer:
+		return append([]byte(nil), p.Bytes()...)
+	case *bytes.Buffer:
+		return append([]byte(nil), p.Bytes()...)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,168 @@
+package mqtt
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type fakeMessage struct {
+	topic    string
+	qos      byte
+	retained bool
+	payload  []byte
+}
+
+func (m *fakeMessage) Duplicate() bool   { return false }
+func (m *fakeMessage) Qos() byte         { return m.qos }
+func (m *fakeMessage) Retained() bool    { return m.retained }
+func (m *fakeMessage) Topic() string     { return m.topic }
+func (m *fakeMessage) MessageID() uint16 { return 1 }
+func (m *fakeMessage) Payload() []byte   { return m.payload }
+func (m *fakeMessage) Ack()              {}
+
+type fakeToken struct {
+	done chan struct{}
+	err  error
+}
+
+func (t *fakeToken) Wait() bool            { <-t.done; return true }
+func (t *fakeToken) Done() <-chan struct{} { return t.done }
+func (t *fakeToken) Error() error          { return t.err }
+
+func (t *fakeToken) WaitTimeout(d time.Duration) bool {
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(d):
+		return false
+	}
+}
+
+// fakeClient 只实现 Publish 与 Subscribe，其余方法调用时 panic。
+// pending 为 true 时发布的 token 永不完成，模拟断线时的 QoS>0 发布。
+type fakeClient struct {
+	mqtt.Client
+	published []string
+	handlers  map[string]mqtt.MessageHandler
+	pending   bool
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	c.published = append(c.published, topic)
+	token := &fakeToken{done: make(chan struct{})}
+	if !c.pending {
+		close(token.done)
+	}
+	return token
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, callback mqtt.MessageHandler) mqtt.Token {
+	if c.handlers == nil {
+		c.handlers = map[string]mqtt.MessageHandler{}
+	}
+	c.handlers[topic] = callback
+	token := &fakeToken{done: make(chan struct{})}
+	close(token.done)
+	return token
+}
+
+func TestTracedHandler(t *testing.T) {
+	tc, err := NewTracedClient(&fakeClient{}, nil, &MqttConfig{TopicTemplates: []string{"t/{tenant}/d/{device}/{event}"}})
+	assert.NoError(t, err)
+	msg := &fakeMessage{topic: "t/acme/d/dev-01/cmd", qos: 1, retained: true, payload: []byte(`{"on":true}`)}
+
+	details := tc.handle(func(mqtt.Client, mqtt.Message) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}, nil, msg)
+	assert.Equal(t, 200, details.Status)
+	assert.GreaterOrEqual(t, details.Durtion, 5*time.Millisecond)
+	assert.Equal(t, "mqtt://t/acme/d/dev-01/cmd?qos=1&retained=true", details.Uri)
+	assert.Equal(t, "t/{tenant}/d/{device}/cmd", details.Optionname)
+	assert.Equal(t, "dev-01", details.Device)
+	assert.Equal(t, MethodMQTT, details.Method)
+	assert.Equal(t, msg.payload, details.Body)
+	assert.NotEmpty(t, details.TraceID)
+
+	details = tc.handle(func(mqtt.Client, mqtt.Message) error { return errors.New("device offline") }, nil, msg)
+	assert.Equal(t, 500, details.Status)
+	assert.Equal(t, "error:device offline", string(details.Resp))
+
+	details = tc.handle(func(mqtt.Client, mqtt.Message) error { panic("boom") }, nil, msg)
+	assert.Equal(t, 500, details.Status)
+	assert.True(t, strings.HasPrefix(string(details.Resp), "error:panic: boom"))
+}
+
+func TestRunHandlerRecoversPanic(t *testing.T) {
+	result := runHandler(func(mqtt.Client, mqtt.Message) error { panic("boom") }, nil, &fakeMessage{})
+	assert.EqualError(t, result.err, "panic: boom")
+	assert.True(t, bytes.HasPrefix(result.stack, []byte("goroutine ")))
+}
+
+func TestTracedClientWrapsSubscribeAndPublish(t *testing.T) {
+	raw := &fakeClient{}
+	tc, err := NewTracedClient(raw, &monitor.TracingRequestService{Excluded: []string{"ignored"}}, nil)
+	assert.NoError(t, err)
+
+	called := 0
+	tc.Subscribe("cmd/#", 1, func(mqtt.Client, mqtt.Message) { called++ })
+	assert.NotPanics(t, func() {
+		raw.handlers["cmd/#"](raw, &fakeMessage{topic: "cmd/a"})
+	})
+	assert.Equal(t, 1, called)
+
+	token := tc.Publish("events/a", 0, false, "hello")
+	assert.True(t, token.Wait())
+	tc.Publish("ignored", 0, false, []byte("x"))
+	assert.Equal(t, []string{"events/a", "ignored"}, raw.published)
+
+	assert.Nil(t, tc.WrapMessageHandler(nil))
+	assert.Equal(t, []byte("hi"), payloadBytes(*bytes.NewBufferString("hi")))
+	assert.Nil(t, payloadBytes(42))
+}
+
+// observeErrors 替换全局 logger，返回记录到的日志。
+func observeErrors(t *testing.T) *observer.ObservedLogs {
+	obs, logs := observer.New(zap.ErrorLevel)
+	t.Cleanup(zap.ReplaceGlobals(zap.New(obs)))
+	return logs
+}
+
+func TestTracedHandlerReportsErrorsOnExcludedTopics(t *testing.T) {
+	logs := observeErrors(t)
+	tc, err := NewTracedClient(&fakeClient{}, &monitor.TracingRequestService{Excluded: []string{"ignored"}}, nil)
+	assert.NoError(t, err)
+
+	msg := &fakeMessage{topic: "ignored"}
+	assert.Nil(t, tc.handle(func(mqtt.Client, mqtt.Message) error { return nil }, nil, msg))
+	assert.Zero(t, logs.Len())
+
+	// 过滤只跳过 tracing，panic 仍被记录。
+	assert.Nil(t, tc.handle(func(mqtt.Client, mqtt.Message) error { panic("boom") }, nil, msg))
+	if assert.Equal(t, 1, logs.Len()) {
+		entry := logs.All()[0]
+		assert.Equal(t, "ignored", entry.ContextMap()["Optionname"])
+		assert.Contains(t, entry.ContextMap()["error"], "panic: boom")
+	}
+}
+
+func TestTracedPublishTimesOut(t *testing.T) {
+	logs := observeErrors(t)
+	raw := &fakeClient{pending: true}
+	tc, err := NewTracedClient(raw, nil, &MqttConfig{PublishTimeout: 20 * time.Millisecond})
+	assert.NoError(t, err)
+
+	token := tc.Publish("events/a", 1, false, "hello")
+	assert.Eventually(t, func() bool { return logs.Len() == 1 }, time.Second, 5*time.Millisecond)
+	assert.Contains(t, logs.All()[0].ContextMap()["error"], "publish not acknowledged within 20ms")
+	assert.False(t, token.WaitTimeout(time.Millisecond))
+}
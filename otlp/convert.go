@@ -0,0 +1,254 @@
+package otlp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+const (
+	scopeName = "github.com/techquest-tech/monitor"
+)
+
+func stringAttr(key string, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}},
+	}
+}
+
+func intAttr(key string, value int64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: value}},
+	}
+}
+
+func doubleAttr(key string, value float64) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: value}},
+	}
+}
+
+func boolAttr(key string, value bool) *commonpb.KeyValue {
+	return &commonpb.KeyValue{
+		Key:   key,
+		Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: value}},
+	}
+}
+
+// appendStringAttr 仅在值非空时追加属性，避免产生大量空属性。
+func appendStringAttr(attrs []*commonpb.KeyValue, key string, value string) []*commonpb.KeyValue {
+	if value == "" {
+		return attrs
+	}
+	return append(attrs, stringAttr(key, value))
+}
+
+func unixNano(t time.Time) uint64 {
+	if t.IsZero() {
+		return 0
+	}
+	return uint64(t.UnixNano())
+}
+
+// decodeID 将十六进制 ID 解码为字节，长度不符时返回 nil。
+func decodeID(id string, size int) []byte {
+	if len(id) != size*2 {
+		return nil
+	}
+	b, err := hex.DecodeString(id)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// newResource 构建 OTLP resource，标识当前应用。
+func newResource(serviceName string) *resourcepb.Resource {
+	attrs := []*commonpb.KeyValue{stringAttr("service.name", serviceName)}
+	attrs = appendStringAttr(attrs, "service.version", core.Version)
+	if hostname, err := os.Hostname(); err == nil {
+		attrs = appendStringAttr(attrs, "host.name", hostname)
+	}
+	env := os.Getenv("ENV")
+	if env == "" {
+		env = "default"
+	}
+	attrs = append(attrs, stringAttr("deployment.environment", env))
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+// spanKind 按 OTel messaging 约定，MQTT 发布（ThirdParty）为 PRODUCER、收到的消息为 CONSUMER；
+// 其余出站请求（ThirdParty）为 CLIENT，入站为 SERVER。
+func spanKind(tr monitor.TracingDetails) tracepb.Span_SpanKind {
+	thirdParty := tr.VerbosityLevel == monitor.TracingVerbosityLevelThirdParty
+	switch {
+	case strings.EqualFold(tr.Method, "MQTT") && thirdParty:
+		return tracepb.Span_SPAN_KIND_PRODUCER
+	case strings.EqualFold(tr.Method, "MQTT"):
+		return tracepb.Span_SPAN_KIND_CONSUMER
+	case thirdParty:
+		return tracepb.Span_SPAN_KIND_CLIENT
+	default:
+		return tracepb.Span_SPAN_KIND_SERVER
+	}
+}
+
+// TracingToSpan 将 TracingDetails 转换为 OTLP span。
+// tr: tracing 详情。
+// details: 是否附带请求体与响应体。
+// 返回值：OTLP span；缺少 TraceID 时生成新的链路标识。
+func TracingToSpan(tr monitor.TracingDetails, details bool) *tracepb.Span {
+	traceID, spanID := decodeID(tr.TraceID, 16), decodeID(tr.SpanID, 8)
+	if traceID == nil || spanID == nil {
+		tc := monitor.NewTraceContext()
+		traceID, spanID = decodeID(tc.TraceID, 16), decodeID(tc.SpanID, 8)
+	}
+	name := tr.Optionname
+	if name == "" {
+		name = fmt.Sprintf("%s %s", tr.Method, tr.Uri)
+	}
+	start := tr.StartedAt
+	if start.IsZero() {
+		start = time.Now().Add(-tr.Durtion)
+	}
+	kind := spanKind(tr)
+
+	attrs := []*commonpb.KeyValue{
+		stringAttr("http.request.method", tr.Method),
+		intAttr("http.response.status_code", int64(tr.Status)),
+		intAttr("monitor.verbosity_level", int64(tr.VerbosityLevel)),
+	}
+	attrs = appendStringAttr(attrs, "url.full", tr.Uri)
+	attrs = appendStringAttr(attrs, "http.route", tr.Optionname)
+	attrs = appendStringAttr(attrs, "client.address", tr.ClientIP)
+	attrs = appendStringAttr(attrs, "user_agent.original", tr.UserAgent)
+	attrs = appendStringAttr(attrs, "monitor.tenant", tr.Tenant)
+	attrs = appendStringAttr(attrs, "monitor.operator", tr.Operator)
+	attrs = appendStringAttr(attrs, "monitor.device", tr.Device)
+	attrs = appendStringAttr(attrs, "monitor.app", tr.AppName)
+	attrs = appendStringAttr(attrs, "monitor.app_version", tr.AppVersion)
+	if tr.TargetID > 0 {
+		attrs = append(attrs, intAttr("monitor.target_id", int64(tr.TargetID)))
+	}
+	if tr.SampleRate > 0 {
+		attrs = append(attrs, doubleAttr("monitor.sample_rate", tr.SampleRate))
+	}
+	attrs = appendStringAttr(attrs, "monitor.sampled_by", tr.SampledBy)
+	if tr.BodySize > 0 {
+		attrs = append(attrs, intAttr("http.request.body.size", tr.BodySize))
+	}
+	if tr.RespSize > 0 {
+		attrs = append(attrs, intAttr("http.response.body.size", tr.RespSize))
+	}
+	if tr.BodyTruncated || tr.RespTruncated {
+		attrs = append(attrs, boolAttr("monitor.truncated", true))
+	}
+	if details {
+		bodyText, bodyEnc := monitor.EncodePayloadForText(tr.Body)
+		respText, respEnc := monitor.EncodePayloadForText(tr.Resp)
+		attrs = appendStringAttr(attrs, "monitor.request.body", bodyText)
+		attrs = appendStringAttr(attrs, "monitor.request.body_enc", bodyEnc)
+		attrs = appendStringAttr(attrs, "monitor.response.body", respText)
+		attrs = appendStringAttr(attrs, "monitor.response.body_enc", respEnc)
+	}
+
+	status := &tracepb.Status{Code: tracepb.Status_STATUS_CODE_UNSET}
+	// 服务端仅 5xx 视为错误，客户端 4xx 也视为错误，与 OpenTelemetry HTTP 语义约定一致。
+	if tr.Status >= 500 || (kind == tracepb.Span_SPAN_KIND_CLIENT && tr.Status >= 400) {
+		status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: fmt.Sprintf("status %d", tr.Status)}
+	}
+
+	return &tracepb.Span{
+		TraceId:           traceID,
+		SpanId:            spanID,
+		ParentSpanId:      decodeID(tr.ParentSpanID, 8),
+		Name:              name,
+		Kind:              kind,
+		StartTimeUnixNano: unixNano(start),
+		EndTimeUnixNano:   unixNano(start.Add(tr.Durtion)),
+		Attributes:        attrs,
+		Status:            status,
+	}
+}
+
+// JobToSpan 将定时任务执行记录转换为 INTERNAL span，并附带 job.finished 事件。
+func JobToSpan(job schedule.JobHistory) *tracepb.Span {
+	tc := monitor.NewTraceContext()
+	end := time.Now()
+	start := end.Add(-job.Duration)
+	attrs := []*commonpb.KeyValue{
+		stringAttr("job.name", job.Job),
+		boolAttr("job.succeed", job.Succeed),
+	}
+	attrs = appendStringAttr(attrs, "monitor.app", job.App)
+	attrs = appendStringAttr(attrs, "monitor.app_version", job.AppVersion)
+
+	status := &tracepb.Status{Code: tracepb.Status_STATUS_CODE_OK}
+	if !job.Succeed {
+		status = &tracepb.Status{Code: tracepb.Status_STATUS_CODE_ERROR, Message: "job failed"}
+	}
+	return &tracepb.Span{
+		TraceId:           decodeID(tc.TraceID, 16),
+		SpanId:            decodeID(tc.SpanID, 8),
+		Name:              "cron " + job.Job,
+		Kind:              tracepb.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: unixNano(start),
+		EndTimeUnixNano:   unixNano(end),
+		Attributes:        attrs,
+		Events: []*tracepb.Span_Event{
+			{
+				TimeUnixNano: unixNano(end),
+				Name:         "job.finished",
+				Attributes: []*commonpb.KeyValue{
+					boolAttr("job.succeed", job.Succeed),
+					intAttr("job.duration_ms", job.Duration.Milliseconds()),
+				},
+			},
+		},
+		Status: status,
+	}
+}
+
+// ErrorToLogRecord 将错误上报转换为 ERROR 级别的 OTLP 日志。
+func ErrorToLogRecord(rr core.ErrorReport) *logspb.LogRecord {
+	happened := rr.HappendAT
+	if happened.IsZero() {
+		happened = time.Now()
+	}
+	message := ""
+	if rr.Error != nil {
+		message = rr.Error.Error()
+	}
+	attrs := []*commonpb.KeyValue{}
+	attrs = appendStringAttr(attrs, "exception.message", message)
+	if len(rr.FullStack) > 0 {
+		stack, enc := monitor.EncodePayloadForText(rr.FullStack)
+		attrs = appendStringAttr(attrs, "exception.stacktrace", stack)
+		attrs = appendStringAttr(attrs, "monitor.stack_enc", enc)
+	}
+	attrs = appendStringAttr(attrs, "url.full", rr.Uri)
+	attrs = appendStringAttr(attrs, "monitor.app", rr.AppName)
+	attrs = appendStringAttr(attrs, "monitor.app_version", rr.AppVersion)
+
+	return &logspb.LogRecord{
+		TimeUnixNano:         unixNano(happened),
+		ObservedTimeUnixNano: unixNano(time.Now()),
+		SeverityNumber:       logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+		SeverityText:         "ERROR",
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: message}},
+		Attributes:           attrs,
+	}
+}
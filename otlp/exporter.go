@@ -0,0 +1,452 @@
+package otlp
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	EncodingProtobuf = "protobuf"
+	EncodingJSON     = "json"
+)
+
+// OTLPConfig OTLP/HTTP 导出配置，对应 tracing.otlp。
+type OTLPConfig struct {
+	// Endpoint collector 地址，如 http://localhost:4318。
+	Endpoint    string
+	TracesPath  string
+	LogsPath    string
+	MetricsPath string
+	// Encoding protobuf（默认）或 json。
+	Encoding string
+	Gzip     bool
+	Headers  map[string]string
+	// Details 为 true 时在 span 属性中附带请求体与响应体。
+	Details       bool
+	BatchSize     int
+	FlushInterval time.Duration
+	QueueSize     int
+	MaxRetries    int
+	RetryPause    time.Duration
+	Timeout       time.Duration
+	// DisableMetrics 为 true 时不导出请求量与耗时指标。
+	DisableMetrics bool
+	// MetricsInterval 指标导出周期。
+	MetricsInterval time.Duration
+	// DurationBuckets 耗时直方图的分桶上界（毫秒），缺省为 DefaultDurationBuckets。
+	DurationBuckets []float64
+	// ShutdownTimeout 停机时等待队列排空的最长时间。
+	ShutdownTimeout time.Duration
+	Included        []string
+	Excluded        []string
+	IncludedIPs     []string
+	ExcludedIPs     []string
+}
+
+// OTLPExporter 将 tracing、错误与定时任务以 OTLP span/log 的形式批量导出到 collector，
+// 并从 tracing 聚合请求量与耗时分布，按 MetricsInterval 周期导出为 OTLP 指标。
+type OTLPExporter struct {
+	monitor.BaseFilter
+	Config   *OTLPConfig
+	Logger   *zap.Logger
+	client   *http.Client
+	resource *resourcepb.Resource
+	spans    *monitor.BatchQueue[*tracepb.Span]
+	logs     *monitor.BatchQueue[*logspb.LogRecord]
+	metrics  *requestMetrics
+	// stop 停机时关闭，通知指标协程做最后一次导出；metricsDone 在指标协程退出（或未启用指标）时关闭。
+	stop        chan struct{}
+	metricsDone chan struct{}
+	shutdown    sync.Once
+}
+
+// exportError collector 返回的非 2xx 响应。
+type exportError struct {
+	Status     int
+	RetryAfter time.Duration
+	Body       string
+}
+
+func (e *exportError) Error() string {
+	return fmt.Sprintf("otlp export failed, status %d: %s", e.Status, e.Body)
+}
+
+// retryable 按 OTLP/HTTP 规范，仅 429/502/503/504 可重试。
+func (e *exportError) retryable() bool {
+	switch e.Status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func applyDefaults(conf *OTLPConfig) {
+	conf.Endpoint = strings.TrimRight(strings.TrimSpace(conf.Endpoint), "/")
+	if conf.TracesPath == "" {
+		conf.TracesPath = "/v1/traces"
+	}
+	if conf.LogsPath == "" {
+		conf.LogsPath = "/v1/logs"
+	}
+	if conf.MetricsPath == "" {
+		conf.MetricsPath = "/v1/metrics"
+	}
+	if conf.MetricsInterval <= 0 {
+		conf.MetricsInterval = time.Minute
+	}
+	conf.Encoding = strings.ToLower(strings.TrimSpace(conf.Encoding))
+	if conf.Encoding != EncodingJSON {
+		conf.Encoding = EncodingProtobuf
+	}
+	if conf.BatchSize <= 0 {
+		conf.BatchSize = 200
+	}
+	if conf.FlushInterval <= 0 {
+		conf.FlushInterval = 5 * time.Second
+	}
+	if conf.QueueSize <= 0 {
+		conf.QueueSize = 20000
+	}
+	if conf.MaxRetries <= 0 {
+		conf.MaxRetries = 3
+	}
+	if conf.RetryPause <= 0 {
+		conf.RetryPause = time.Second
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = 10 * time.Second
+	}
+	if conf.ShutdownTimeout <= 0 {
+		conf.ShutdownTimeout = 5 * time.Second
+	}
+}
+
+// NewOTLPExporter 创建导出器并启动后台批量发送协程。
+// conf: 导出配置，Endpoint 不能为空。
+// logger: 应用日志实例。
+// 返回值：导出器实例；Endpoint 为空时返回错误。
+func NewOTLPExporter(conf *OTLPConfig, logger *zap.Logger) (*OTLPExporter, error) {
+	if conf == nil || strings.TrimSpace(conf.Endpoint) == "" {
+		return nil, errors.New("otlp endpoint is required")
+	}
+	applyDefaults(conf)
+
+	e := &OTLPExporter{
+		BaseFilter: monitor.BaseFilter{
+			Included:    conf.Included,
+			Excluded:    conf.Excluded,
+			IncludedIPs: conf.IncludedIPs,
+			ExcludedIPs: conf.ExcludedIPs,
+		},
+		Config:      conf,
+		Logger:      logger,
+		client:      &http.Client{Timeout: conf.Timeout},
+		resource:    newResource(core.AppName),
+		stop:        make(chan struct{}),
+		metricsDone: make(chan struct{}),
+	}
+	opts := monitor.BatchOptions{
+		Name:          "otlp",
+		QueueSize:     conf.QueueSize,
+		BatchSize:     conf.BatchSize,
+		FlushInterval: conf.FlushInterval,
+	}
+	e.spans = monitor.NewBatchQueue(opts, logger, e.exportSpans)
+	e.logs = monitor.NewBatchQueue(opts, logger, e.exportLogs)
+	if conf.DisableMetrics {
+		close(e.metricsDone)
+	} else {
+		e.metrics = newRequestMetrics(conf.DurationBuckets)
+		go e.runMetrics()
+	}
+	return e, nil
+}
+
+// runMetrics 按 MetricsInterval 导出累计指标，停机时再导出一次后退出。
+func (e *OTLPExporter) runMetrics() {
+	defer close(e.metricsDone)
+	ticker := time.NewTicker(e.Config.MetricsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.stop:
+			e.flushMetrics()
+			return
+		}
+		e.flushMetrics()
+	}
+}
+
+func (e *OTLPExporter) flushMetrics() {
+	metrics := e.metrics.snapshot(time.Now())
+	if len(metrics) == 0 {
+		return
+	}
+	if err := e.exportMetrics(metrics); err != nil {
+		e.Logger.Error("[otlp] export metrics failed", zap.Error(err))
+	}
+}
+
+func (e *OTLPExporter) ReportTracing(tr monitor.TracingDetails) error {
+	if e.metrics != nil {
+		e.metrics.record(tr)
+	}
+	e.spans.Push(TracingToSpan(tr, e.Config.Details), "tracing")
+	return nil
+}
+
+func (e *OTLPExporter) ReportError(rr core.ErrorReport) error {
+	e.logs.Push(ErrorToLogRecord(rr), "error")
+	return nil
+}
+
+func (e *OTLPExporter) ReportScheduleJob(job schedule.JobHistory) error {
+	e.spans.Push(JobToSpan(job), "schedule")
+	return nil
+}
+
+func (e *OTLPExporter) scope() *commonpb.InstrumentationScope {
+	return &commonpb.InstrumentationScope{Name: scopeName, Version: core.Version}
+}
+
+func (e *OTLPExporter) exportSpans(spans []*tracepb.Span) error {
+	data := &tracepb.TracesData{
+		ResourceSpans: []*tracepb.ResourceSpans{{
+			Resource:   e.resource,
+			ScopeSpans: []*tracepb.ScopeSpans{{Scope: e.scope(), Spans: spans}},
+		}},
+	}
+	return e.send(e.Config.Endpoint+e.Config.TracesPath, data)
+}
+
+func (e *OTLPExporter) exportLogs(records []*logspb.LogRecord) error {
+	data := &logspb.LogsData{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource:  e.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{Scope: e.scope(), LogRecords: records}},
+		}},
+	}
+	return e.send(e.Config.Endpoint+e.Config.LogsPath, data)
+}
+
+func (e *OTLPExporter) exportMetrics(metrics []*metricspb.Metric) error {
+	data := &metricspb.MetricsData{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource:     e.resource,
+			ScopeMetrics: []*metricspb.ScopeMetrics{{Scope: e.scope(), Metrics: metrics}},
+		}},
+	}
+	return e.send(e.Config.Endpoint+e.Config.MetricsPath, data)
+}
+
+// marshal 按配置编码；TracesData/LogsData/MetricsData 与 Export*ServiceRequest 的线上格式一致。
+func (e *OTLPExporter) marshal(msg proto.Message) ([]byte, string, error) {
+	if e.Config.Encoding == EncodingJSON {
+		b, err := protojson.MarshalOptions{UseEnumNumbers: true}.Marshal(msg)
+		if err != nil {
+			return nil, "", err
+		}
+		b, err = hexEncodeIDs(b)
+		return b, "application/json", err
+	}
+	b, err := proto.Marshal(msg)
+	return b, "application/x-protobuf", err
+}
+
+// idFields OTLP JSON 要求以十六进制而非 base64 表示的字段。
+var idFields = map[string]bool{"traceId": true, "spanId": true, "parentSpanId": true}
+
+// hexEncodeIDs 将 protojson 输出中 base64 编码的 traceId/spanId/parentSpanId 转为十六进制。
+func hexEncodeIDs(payload []byte) ([]byte, error) {
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	var walk func(v any)
+	walk = func(v any) {
+		switch val := v.(type) {
+		case map[string]any:
+			for k, child := range val {
+				if s, ok := child.(string); ok && idFields[k] {
+					if raw, err := base64.StdEncoding.DecodeString(s); err == nil {
+						val[k] = hex.EncodeToString(raw)
+					}
+					continue
+				}
+				walk(child)
+			}
+		case []any:
+			for _, child := range val {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+	return json.Marshal(doc)
+}
+
+// send 编码并发送到 collector，对网络错误及 429/502/503/504 按 RetryPause 指数退避重试，优先使用 Retry-After。
+func (e *OTLPExporter) send(url string, msg proto.Message) error {
+	body, contentType, err := e.marshal(msg)
+	if err != nil {
+		return err
+	}
+	if e.Config.Gzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	backoff := e.Config.RetryPause
+	for attempt := 1; ; attempt++ {
+		err = e.post(url, contentType, body)
+		if err == nil {
+			return nil
+		}
+		wait := backoff
+		var expErr *exportError
+		if errors.As(err, &expErr) {
+			if !expErr.retryable() {
+				return err
+			}
+			if expErr.RetryAfter > 0 {
+				wait = expErr.RetryAfter
+			}
+		}
+		if attempt > e.Config.MaxRetries || e.isClosed() && attempt >= 2 {
+			return err
+		}
+		e.Logger.Warn("[otlp] retry export after backoff",
+			zap.String("url", url),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", wait),
+			zap.Error(err),
+		)
+		time.Sleep(wait)
+		backoff *= 2
+	}
+}
+
+func (e *OTLPExporter) post(url string, contentType string, body []byte) error {
+	// 不绑定 RootCtx，停机排空阶段 RootCtx 可能已取消，超时由 http.Client.Timeout 控制。
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if e.Config.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range e.Config.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	expErr := &exportError{Status: resp.StatusCode, Body: strings.TrimSpace(string(msg))}
+	if sec, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && sec > 0 {
+		expErr.RetryAfter = time.Duration(sec) * time.Second
+	}
+	return expErr
+}
+
+func (e *OTLPExporter) isClosed() bool {
+	return e.spans.Closed()
+}
+
+// Shutdown 停止接收新数据并等待队列排空与最后一次指标导出，最多等待 ShutdownTimeout。
+func (e *OTLPExporter) Shutdown() {
+	e.shutdown.Do(func() {
+		e.spans.Close()
+		e.logs.Close()
+		close(e.stop)
+		if monitor.WaitDone(e.Config.ShutdownTimeout, e.spans.Done(), e.logs.Done(), e.metricsDone) {
+			e.Logger.Info("[otlp] pending data flushed")
+			return
+		}
+		e.Logger.Warn("[otlp] flush timeout reached, stop waiting",
+			zap.Int("spans", e.spans.Len()),
+			zap.Int("logs", e.logs.Len()),
+		)
+	})
+}
+
+// InitOTLPExporter 从 tracing.otlp 读取配置并创建导出器。
+// logger: 应用日志实例。
+// 返回值：未配置 Endpoint 时返回 nil。
+func InitOTLPExporter(logger *zap.Logger) (*OTLPExporter, error) {
+	conf := &OTLPConfig{}
+	if err := viper.UnmarshalKey("tracing.otlp", conf); err != nil {
+		logger.Error("otlp config error.", zap.Error(err))
+		return nil, err
+	}
+	if conf.Endpoint == "" {
+		logger.Info("no otlp endpoint config, return nil")
+		return nil, nil
+	}
+	e, err := NewOTLPExporter(conf, logger)
+	if err != nil {
+		return nil, err
+	}
+	core.OnServiceStopping(e.Shutdown)
+	logger.Info("otlp exporter is ready",
+		zap.String("endpoint", conf.Endpoint),
+		zap.String("encoding", conf.Encoding),
+		zap.Bool("gzip", conf.Gzip),
+		zap.Int("batchSize", conf.BatchSize),
+		zap.Duration("flushInterval", conf.FlushInterval),
+		zap.Int("queueSize", conf.QueueSize),
+		zap.Bool("metrics", !conf.DisableMetrics),
+	)
+	return e, nil
+}
+
+// EnableOTLPExporter 向容器注册 OTLP 导出器，并在启动时订阅监控事件。
+func EnableOTLPExporter() {
+	core.Provide(InitOTLPExporter)
+	core.ProvideStartup(func(logger *zap.Logger, e *OTLPExporter) core.Startup {
+		if e != nil {
+			monitor.SubscribeMonitor(logger, e)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,260 @@
+package otlp_test
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/gin-shared/pkg/core"
+	"github.com/techquest-tech/gin-shared/pkg/schedule"
+	"github.com/techquest-tech/monitor"
+	"github.com/techquest-tech/monitor/otlp"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeCollector 模拟 OTLP/HTTP collector，记录收到的 span 与日志。
+type fakeCollector struct {
+	mu        sync.Mutex
+	spans     []*tracepb.Span
+	logs      []*logspb.LogRecord
+	metrics   []*metricspb.Metric
+	rawJSON   []string
+	failFirst int
+	calls     int
+}
+
+func (f *fakeCollector) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.calls++
+		if f.failFirst > 0 {
+			f.failFirst--
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var reader io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			assert.NoError(t, err)
+			reader = zr
+		}
+		body, err := io.ReadAll(reader)
+		assert.NoError(t, err)
+
+		isJSON := r.Header.Get("Content-Type") == "application/json"
+		if isJSON {
+			f.rawJSON = append(f.rawJSON, string(body))
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		switch r.URL.Path {
+		case "/v1/traces":
+			data := &tracepb.TracesData{}
+			assert.NoError(t, proto.Unmarshal(body, data))
+			for _, rs := range data.ResourceSpans {
+				for _, ss := range rs.ScopeSpans {
+					f.spans = append(f.spans, ss.Spans...)
+				}
+			}
+		case "/v1/logs":
+			data := &logspb.LogsData{}
+			assert.NoError(t, proto.Unmarshal(body, data))
+			for _, rl := range data.ResourceLogs {
+				for _, sl := range rl.ScopeLogs {
+					f.logs = append(f.logs, sl.LogRecords...)
+				}
+			}
+		case "/v1/metrics":
+			data := &metricspb.MetricsData{}
+			assert.NoError(t, proto.Unmarshal(body, data))
+			for _, rm := range data.ResourceMetrics {
+				for _, sm := range rm.ScopeMetrics {
+					f.metrics = append(f.metrics, sm.Metrics...)
+				}
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func newExporter(t *testing.T, url string, conf otlp.OTLPConfig) *otlp.OTLPExporter {
+	conf.Endpoint = url
+	conf.FlushInterval = 20 * time.Millisecond
+	conf.RetryPause = time.Millisecond
+	e, err := otlp.NewOTLPExporter(&conf, zap.NewNop())
+	assert.NoError(t, err)
+	return e
+}
+
+func TestExportProtobuf(t *testing.T) {
+	collector := &fakeCollector{}
+	server := httptest.NewServer(collector.handler(t))
+	defer server.Close()
+
+	e := newExporter(t, server.URL, otlp.OTLPConfig{BatchSize: 2})
+	tc := monitor.NewTraceContext()
+	child := tc.Child()
+	assert.NoError(t, e.ReportTracing(monitor.TracingDetails{
+		Optionname:   "/api/orders",
+		Uri:          "/api/orders?page=1",
+		Method:       "GET",
+		Status:       502,
+		Durtion:      120 * time.Millisecond,
+		StartedAt:    time.Now(),
+		TraceID:      child.TraceID,
+		SpanID:       child.SpanID,
+		ParentSpanID: child.ParentSpanID,
+		Tenant:       "t1",
+	}))
+	assert.NoError(t, e.ReportScheduleJob(schedule.JobHistory{Job: "cleanup", Succeed: true, Duration: time.Second}))
+	assert.NoError(t, e.ReportError(core.ErrorReport{Error: errors.New("boom"), Uri: "/api/orders", FullStack: []byte("stack")}))
+	e.Shutdown()
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	assert.Len(t, collector.spans, 2)
+	assert.Len(t, collector.logs, 1)
+
+	span := collector.spans[0]
+	assert.Equal(t, "/api/orders", span.Name)
+	assert.Len(t, span.TraceId, 16)
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, span.Status.Code)
+	assert.Equal(t, tracepb.Span_SPAN_KIND_SERVER, span.Kind)
+	assert.Len(t, span.ParentSpanId, 8)
+	assert.Equal(t, uint64(120*time.Millisecond), span.EndTimeUnixNano-span.StartTimeUnixNano)
+
+	job := collector.spans[1]
+	assert.Equal(t, tracepb.Span_SPAN_KIND_INTERNAL, job.Kind)
+	assert.Len(t, job.Events, 1)
+
+	assert.Equal(t, "boom", collector.logs[0].Body.GetStringValue())
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_ERROR, collector.logs[0].SeverityNumber)
+}
+
+func TestExportJSONGzip(t *testing.T) {
+	collector := &fakeCollector{}
+	server := httptest.NewServer(collector.handler(t))
+	defer server.Close()
+
+	e := newExporter(t, server.URL, otlp.OTLPConfig{Encoding: "json", Gzip: true, DisableMetrics: true})
+	tc := monitor.NewTraceContext()
+	assert.NoError(t, e.ReportTracing(monitor.TracingDetails{Method: "POST", Uri: "/api/orders", Status: 200, TraceID: tc.TraceID, SpanID: tc.SpanID}))
+	e.Shutdown()
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	assert.Len(t, collector.rawJSON, 1)
+	raw := collector.rawJSON[0]
+	assert.Contains(t, raw, `"traceId":"`+tc.TraceID+`"`)
+	assert.Contains(t, raw, `"spanId":"`+tc.SpanID+`"`)
+	assert.Contains(t, raw, `"kind":2`)
+	assert.True(t, json.Valid([]byte(raw)))
+}
+
+func TestExportRetry(t *testing.T) {
+	collector := &fakeCollector{failFirst: 2}
+	server := httptest.NewServer(collector.handler(t))
+	defer server.Close()
+
+	e := newExporter(t, server.URL, otlp.OTLPConfig{DisableMetrics: true})
+	assert.NoError(t, e.ReportTracing(monitor.TracingDetails{Method: "GET", Uri: "/ping", Status: 200}))
+	// 停机阶段会缩短重试，因此先等待正常运行时的重试完成。
+	assert.Eventually(t, func() bool {
+		collector.mu.Lock()
+		defer collector.mu.Unlock()
+		return len(collector.spans) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+	e.Shutdown()
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	assert.Equal(t, 3, collector.calls)
+}
+
+func TestExportMetrics(t *testing.T) {
+	collector := &fakeCollector{}
+	server := httptest.NewServer(collector.handler(t))
+	defer server.Close()
+
+	e := newExporter(t, server.URL, otlp.OTLPConfig{MetricsInterval: time.Hour, DurationBuckets: []float64{100, 10}})
+	for _, dur := range []time.Duration{5 * time.Millisecond, 50 * time.Millisecond, 500 * time.Millisecond} {
+		assert.NoError(t, e.ReportTracing(monitor.TracingDetails{Optionname: "/api/orders", Method: "GET", Status: 200, Durtion: dur}))
+	}
+	// 采样率 0.5 的请求按 2 次计入。
+	assert.NoError(t, e.ReportTracing(monitor.TracingDetails{Optionname: "/api/orders", Method: "GET", Status: 500, Durtion: time.Millisecond, SampleRate: 0.5}))
+	e.Shutdown()
+
+	collector.mu.Lock()
+	defer collector.mu.Unlock()
+	if !assert.Len(t, collector.metrics, 2) {
+		return
+	}
+	count := collector.metrics[0]
+	assert.Equal(t, otlp.MetricRequestCount, count.Name)
+	assert.True(t, count.GetSum().IsMonotonic)
+	assert.Equal(t, metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE, count.GetSum().AggregationTemporality)
+	totals := map[int64]int64{}
+	for _, dp := range count.GetSum().DataPoints {
+		for _, attr := range dp.Attributes {
+			if attr.Key == "http.response.status_code" {
+				totals[attr.Value.GetIntValue()] = dp.GetAsInt()
+			}
+		}
+	}
+	assert.Equal(t, map[int64]int64{200: 3, 500: 2}, totals)
+
+	duration := collector.metrics[1]
+	assert.Equal(t, otlp.MetricRequestDuration, duration.Name)
+	assert.Equal(t, "ms", duration.Unit)
+	for _, dp := range duration.GetHistogram().DataPoints {
+		assert.Equal(t, []float64{10, 100}, dp.ExplicitBounds)
+		if dp.Count == 3 {
+			assert.Equal(t, []uint64{1, 1, 1}, dp.BucketCounts)
+			assert.Equal(t, 555.0, dp.GetSum())
+			assert.Equal(t, 5.0, dp.GetMin())
+			assert.Equal(t, 500.0, dp.GetMax())
+		} else {
+			assert.Equal(t, []uint64{2, 0, 0}, dp.BucketCounts)
+		}
+	}
+}
+
+func TestNewExporterRequiresEndpoint(t *testing.T) {
+	_, err := otlp.NewOTLPExporter(&otlp.OTLPConfig{}, zap.NewNop())
+	assert.Error(t, err)
+}
+
+func TestTracingToSpanKind(t *testing.T) {
+	cases := []struct {
+		method string
+		level  monitor.TracingVerbosityLevel
+		kind   tracepb.Span_SpanKind
+	}{
+		{"GET", monitor.TracingVerbosityLevelRead, tracepb.Span_SPAN_KIND_SERVER},
+		{"GET", monitor.TracingVerbosityLevelThirdParty, tracepb.Span_SPAN_KIND_CLIENT},
+		{"MQTT", monitor.TracingVerbosityLevelRead, tracepb.Span_SPAN_KIND_CONSUMER},
+		{"MQTT", monitor.TracingVerbosityLevelThirdParty, tracepb.Span_SPAN_KIND_PRODUCER},
+	}
+	for _, c := range cases {
+		span := otlp.TracingToSpan(monitor.TracingDetails{Method: c.method, VerbosityLevel: c.level, Status: 200}, false)
+		assert.Equal(t, c.kind, span.Kind, "%s/%d", c.method, c.level)
+	}
+}
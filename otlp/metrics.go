@@ -0,0 +1,160 @@
+package otlp
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/techquest-tech/monitor"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+)
+
+const (
+	MetricRequestCount    = "monitor.requests"
+	MetricRequestDuration = "monitor.request.duration"
+
+	// maxMetricSeries 单个导出器保留的最大时间序列数，超出后 http.route 归并为 otherRoute，避免路由基数失控。
+	maxMetricSeries = 2000
+	otherRoute      = "_other"
+)
+
+// DefaultDurationBuckets 请求耗时直方图的缺省分桶上界（毫秒）。
+var DefaultDurationBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+type metricKey struct {
+	method string
+	route  string
+	status int
+	kind   string
+}
+
+type metricSeries struct {
+	count   uint64
+	sum     float64
+	min     float64
+	max     float64
+	buckets []uint64
+}
+
+// requestMetrics 从 TracingDetails 聚合请求量与耗时分布，按累计（cumulative）语义导出。
+type requestMetrics struct {
+	mu     sync.Mutex
+	bounds []float64
+	start  time.Time
+	series map[metricKey]*metricSeries
+}
+
+func newRequestMetrics(bounds []float64) *requestMetrics {
+	if len(bounds) == 0 {
+		bounds = DefaultDurationBuckets
+	}
+	sorted := append([]float64{}, bounds...)
+	sort.Float64s(sorted)
+	return &requestMetrics{
+		bounds: sorted,
+		start:  time.Now(),
+		series: map[metricKey]*metricSeries{},
+	}
+}
+
+// sampleWeight 按采样率还原被采样丢弃的请求数量。
+func sampleWeight(rate float64) uint64 {
+	if rate <= 0 || rate >= 1 {
+		return 1
+	}
+	return uint64(math.Round(1 / rate))
+}
+
+// record 累加一次请求。
+func (m *requestMetrics) record(tr monitor.TracingDetails) {
+	key := metricKey{
+		method: tr.Method,
+		route:  tr.Optionname,
+		status: tr.Status,
+		kind:   strings.ToLower(strings.TrimPrefix(spanKind(tr).String(), "SPAN_KIND_")),
+	}
+	ms := float64(tr.Durtion) / float64(time.Millisecond)
+	weight := sampleWeight(tr.SampleRate)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.series[key]
+	if !ok {
+		if len(m.series) >= maxMetricSeries {
+			key.route = otherRoute
+			s, ok = m.series[key]
+		}
+		if !ok {
+			s = &metricSeries{min: ms, max: ms, buckets: make([]uint64, len(m.bounds)+1)}
+			m.series[key] = s
+		}
+	}
+	s.count += weight
+	s.sum += ms * float64(weight)
+	s.min = math.Min(s.min, ms)
+	s.max = math.Max(s.max, ms)
+	// 第 i 个桶统计 (bounds[i-1], bounds[i]] 区间内的值，最后一个桶统计大于所有上界的值。
+	s.buckets[sort.SearchFloat64s(m.bounds, ms)] += weight
+}
+
+// snapshot 生成当前累计值；尚无数据时返回 nil。
+func (m *requestMetrics) snapshot(now time.Time) []*metricspb.Metric {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.series) == 0 {
+		return nil
+	}
+	start, ts := unixNano(m.start), unixNano(now)
+	counts := make([]*metricspb.NumberDataPoint, 0, len(m.series))
+	durations := make([]*metricspb.HistogramDataPoint, 0, len(m.series))
+	for key, s := range m.series {
+		attrs := []*commonpb.KeyValue{
+			stringAttr("http.request.method", key.method),
+			intAttr("http.response.status_code", int64(key.status)),
+			stringAttr("monitor.span_kind", key.kind),
+		}
+		attrs = appendStringAttr(attrs, "http.route", key.route)
+		counts = append(counts, &metricspb.NumberDataPoint{
+			Attributes:        attrs,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      ts,
+			Value:             &metricspb.NumberDataPoint_AsInt{AsInt: int64(s.count)},
+		})
+		sum, min, max := s.sum, s.min, s.max
+		durations = append(durations, &metricspb.HistogramDataPoint{
+			Attributes:        attrs,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      ts,
+			Count:             s.count,
+			Sum:               &sum,
+			Min:               &min,
+			Max:               &max,
+			BucketCounts:      append([]uint64{}, s.buckets...),
+			ExplicitBounds:    m.bounds,
+		})
+	}
+	return []*metricspb.Metric{
+		{
+			Name:        MetricRequestCount,
+			Description: "Number of requests recorded by monitor tracing.",
+			Unit:        "{request}",
+			Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+				DataPoints:             counts,
+			}},
+		},
+		{
+			Name:        MetricRequestDuration,
+			Description: "Duration of requests recorded by monitor tracing.",
+			Unit:        "ms",
+			Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+				AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				DataPoints:             durations,
+			}},
+		},
+	}
+}
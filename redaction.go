@@ -0,0 +1,494 @@
+package monitor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+const (
+	RedactionStrategyMask = "mask"
+	RedactionStrategyHash = "hash"
+	RedactionStrategyDrop = "drop"
+
+	defaultRedactionMask = "******"
+)
+
+// RedactionRule 脱敏规则，Routes 为空时作用于全部请求。
+// JSONPaths: 以 . 分隔的字段路径，* 匹配任意一级；不含 . 时匹配任意层级的同名字段，数组层级透明。
+// FormFields: urlencoded 正文及 Uri 查询参数中的字段名。
+// Headers: 请求头名称，其值在正文、响应与 Uri 中出现时会被替换。
+// Regexes: 对文本正文直接匹配替换的正则表达式。
+// Strategy: mask/hash/drop，缺省为 mask。
+type RedactionRule struct {
+	Name       string
+	Routes     []string
+	JSONPaths  []string
+	FormFields []string
+	Headers    []string
+	Regexes    []string
+	Strategy   string
+}
+
+type RedactionConfig struct {
+	Mask  string
+	Rules []RedactionRule
+}
+
+type compiledRedactionRule struct {
+	RedactionRule
+	jsonPaths [][]string
+	// jsonKeys 按 JSONPaths 末级字段名在文本中定位值，用于 JSON 无法解析（如被截断）的正文；末级含 * 时为 nil。
+	jsonKeys *regexp.Regexp
+	regexes  []*regexp.Regexp
+}
+
+// Redactor 在 tracing 详情推送到各后端之前执行脱敏。
+type Redactor struct {
+	mask  string
+	rules []*compiledRedactionRule
+}
+
+// DefaultRedactor 由 InitTracingService 按 tracing.redaction 配置初始化；未配置时不做任何处理。
+var DefaultRedactor = &Redactor{mask: defaultRedactionMask}
+
+// NewRedactor 编译脱敏规则。
+// conf: 脱敏配置。
+// 返回值：编译后的 Redactor；正则非法时返回错误。
+func NewRedactor(conf RedactionConfig) (*Redactor, error) {
+	r := &Redactor{mask: conf.Mask}
+	if r.mask == "" {
+		r.mask = defaultRedactionMask
+	}
+	for idx, rule := range conf.Rules {
+		compiled := &compiledRedactionRule{RedactionRule: rule}
+		if compiled.Name == "" {
+			compiled.Name = fmt.Sprintf("rule%d", idx+1)
+		}
+		switch strings.ToLower(strings.TrimSpace(compiled.Strategy)) {
+		case "", RedactionStrategyMask:
+			compiled.Strategy = RedactionStrategyMask
+		case RedactionStrategyHash:
+			compiled.Strategy = RedactionStrategyHash
+		case RedactionStrategyDrop:
+			compiled.Strategy = RedactionStrategyDrop
+		default:
+			return nil, fmt.Errorf("redaction rule %s: unknown strategy %q", compiled.Name, rule.Strategy)
+		}
+		leaves := []string{}
+		for _, path := range rule.JSONPaths {
+			if path = strings.TrimSpace(path); path != "" {
+				segments := strings.Split(path, ".")
+				compiled.jsonPaths = append(compiled.jsonPaths, segments)
+				leaves = append(leaves, segments[len(segments)-1])
+			}
+		}
+		compiled.jsonKeys = compileJSONKeys(leaves)
+		for _, expr := range rule.Regexes {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("redaction rule %s: %w", compiled.Name, err)
+			}
+			compiled.regexes = append(compiled.regexes, re)
+		}
+		r.rules = append(r.rules, compiled)
+	}
+	return r, nil
+}
+
+// Apply 对请求正文、响应与 Uri 执行脱敏，并把命中的规则名写入 tr.Redactions。
+// tr: 待推送的 tracing 详情。
+// headers: 请求头（或 gRPC metadata），用于按名称匹配敏感头部的值，可为 nil。
+// 返回值：无。
+func (r *Redactor) Apply(tr *TracingDetails, headers map[string][]string) {
+	if r == nil || len(r.rules) == 0 {
+		return
+	}
+	for _, rule := range r.rules {
+		if !rule.matchRoute(tr) {
+			continue
+		}
+		fired := false
+		if out, ok := r.redactPayload(rule, tr.Body, headers); ok {
+			tr.Body = out
+			tr.BodyEnc = DetectPayloadEncoding(out)
+			fired = true
+		}
+		if out, ok := r.redactPayload(rule, tr.Resp, headers); ok {
+			tr.Resp = out
+			tr.RespEnc = DetectPayloadEncoding(out)
+			fired = true
+		}
+		if out, ok := r.redactURI(rule, tr.Uri, headers); ok {
+			tr.Uri = out
+			fired = true
+		}
+		if fired {
+			tr.Redactions = appendUnique(tr.Redactions, rule.Name)
+		}
+	}
+}
+
+func appendUnique(items []string, item string) []string {
+	for _, v := range items {
+		if v == item {
+			return items
+		}
+	}
+	return append(items, item)
+}
+
+func (rule *compiledRedactionRule) matchRoute(tr *TracingDetails) bool {
+	if len(rule.Routes) == 0 {
+		return true
+	}
+	for _, pattern := range rule.Routes {
+		for _, target := range []string{tr.Optionname, tr.Uri} {
+			if target == "" {
+				continue
+			}
+			if strings.Contains(pattern, "*") {
+				if matched, _ := doublestar.Match(pattern, target); matched {
+					return true
+				}
+			} else if strings.HasPrefix(target, pattern) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// replaceValue 按规则策略生成替换值。
+func (r *Redactor) replaceValue(rule *compiledRedactionRule, value string) string {
+	switch rule.Strategy {
+	case RedactionStrategyHash:
+		sum := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	case RedactionStrategyDrop:
+		return ""
+	default:
+		return r.mask
+	}
+}
+
+// redactPayload 依次执行 JSON、表单、请求头值与正则脱敏；二进制正文不处理。
+// 被采集上限截断的正文先去掉不完整的尾部字符；JSON 无法解析时按字段名在文本中替换，避免截断后漏脱敏。
+func (r *Redactor) redactPayload(rule *compiledRedactionRule, payload []byte, headers map[string][]string) ([]byte, bool) {
+	if len(payload) == 0 {
+		return payload, false
+	}
+	text, ok := trimPartialRune(payload)
+	if !ok {
+		return payload, false
+	}
+	changed := false
+	parsed := false
+	trimmed := bytes.TrimSpace(text)
+	if len(rule.jsonPaths) > 0 && len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		out, ok, err := r.redactJSON(rule, trimmed)
+		if err == nil {
+			parsed = true
+			if ok {
+				text = out
+				changed = true
+			}
+		} else if out, ok := r.redactJSONText(rule, string(text)); ok {
+			text = []byte(out)
+			changed = true
+		}
+	}
+	if !parsed && len(rule.FormFields) > 0 {
+		if out, ok := r.redactForm(rule, string(text)); ok {
+			text = []byte(out)
+			changed = true
+		}
+	}
+	if out, ok := r.redactText(rule, string(text), headers); ok {
+		text = []byte(out)
+		changed = true
+	}
+	if !changed {
+		return payload, false
+	}
+	return text, true
+}
+
+// trimPartialRune 去掉截断产生的不完整尾部字符。
+// 返回值：去掉尾部后仍不是合法 UTF-8（二进制正文）时返回 false。
+func trimPartialRune(payload []byte) ([]byte, bool) {
+	if utf8.Valid(payload) {
+		return payload, true
+	}
+	for i := 1; i < utf8.UTFMax && i <= len(payload); i++ {
+		tail := payload[len(payload)-i:]
+		if !utf8.RuneStart(tail[0]) {
+			continue
+		}
+		if !utf8.FullRune(tail) && utf8.Valid(payload[:len(payload)-i]) {
+			return payload[:len(payload)-i], true
+		}
+		break
+	}
+	return payload, false
+}
+
+func (r *Redactor) redactURI(rule *compiledRedactionRule, uri string, headers map[string][]string) (string, bool) {
+	if uri == "" {
+		return uri, false
+	}
+	changed := false
+	if idx := strings.IndexByte(uri, '?'); idx >= 0 && len(rule.FormFields) > 0 {
+		if query, ok := r.redactForm(rule, uri[idx+1:]); ok {
+			uri = uri[:idx+1] + query
+			changed = true
+		}
+	}
+	if out, ok := r.redactText(rule, uri, headers); ok {
+		uri = out
+		changed = true
+	}
+	return uri, changed
+}
+
+// redactForm 处理 a=1&b=2 形式的正文，保持原有顺序且不重新编码。
+func (r *Redactor) redactForm(rule *compiledRedactionRule, form string) (string, bool) {
+	pairs := strings.Split(form, "&")
+	out := make([]string, 0, len(pairs))
+	changed := false
+	for _, pair := range pairs {
+		key, value, hasValue := strings.Cut(pair, "=")
+		if !hasValue || !containsFold(rule.FormFields, strings.TrimSpace(key)) {
+			out = append(out, pair)
+			continue
+		}
+		changed = true
+		if rule.Strategy == RedactionStrategyDrop {
+			continue
+		}
+		out = append(out, key+"="+r.replaceValue(rule, value))
+	}
+	if !changed {
+		return form, false
+	}
+	return strings.Join(out, "&"), true
+}
+
+// redactText 替换请求头值与正则命中的文本。
+func (r *Redactor) redactText(rule *compiledRedactionRule, text string, headers map[string][]string) (string, bool) {
+	changed := false
+	for _, name := range rule.Headers {
+		for key, values := range headers {
+			if !strings.EqualFold(key, name) {
+				continue
+			}
+			for _, value := range values {
+				if len(value) < 4 || !strings.Contains(text, value) {
+					continue
+				}
+				text = strings.ReplaceAll(text, value, r.replaceValue(rule, value))
+				changed = true
+			}
+		}
+	}
+	for _, re := range rule.regexes {
+		if !re.MatchString(text) {
+			continue
+		}
+		text = re.ReplaceAllStringFunc(text, func(m string) string {
+			return r.replaceValue(rule, m)
+		})
+		changed = true
+	}
+	return text, changed
+}
+
+// redactJSON 解析 JSON 正文并按 JSONPaths 替换字段。
+// 返回值：正文无法解析时返回错误，由调用方改用 redactJSONText。
+func (r *Redactor) redactJSON(rule *compiledRedactionRule, payload []byte) ([]byte, bool, error) {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	var doc any
+	if err := decoder.Decode(&doc); err != nil {
+		return payload, false, err
+	}
+	doc, changed := r.walkJSON(rule, doc, nil)
+	if !changed {
+		return payload, false, nil
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return payload, false, err
+	}
+	return out, true, nil
+}
+
+// compileJSONKeys 生成匹配 "name": 的正则，末级字段名含 * 时无法按名称定位，返回 nil。
+func compileJSONKeys(leaves []string) *regexp.Regexp {
+	if len(leaves) == 0 {
+		return nil
+	}
+	quoted := make([]string, 0, len(leaves))
+	for _, leaf := range leaves {
+		if leaf == "*" {
+			return nil
+		}
+		quoted = append(quoted, regexp.QuoteMeta(leaf))
+	}
+	return regexp.MustCompile(`"(?i:` + strings.Join(quoted, "|") + `)"\s*:\s*`)
+}
+
+// redactJSONText 在 JSON 无法解析时按字段名替换文本中的值（字符串、对象、数组或标量，允许在末尾被截断）。
+// 无法按名称定位（JSONPaths 末级为 *）时整个正文替换为掩码。
+func (r *Redactor) redactJSONText(rule *compiledRedactionRule, text string) (string, bool) {
+	if rule.jsonKeys == nil {
+		return r.mask, true
+	}
+	var sb strings.Builder
+	last := 0
+	for _, loc := range rule.jsonKeys.FindAllStringIndex(text, -1) {
+		if loc[0] < last {
+			continue
+		}
+		end := jsonValueEnd(text, loc[1])
+		sb.WriteString(text[last:loc[1]])
+		sb.WriteString(strconv.Quote(r.replaceValue(rule, strings.Trim(text[loc[1]:end], `"`))))
+		last = end
+	}
+	if last == 0 {
+		return text, false
+	}
+	sb.WriteString(text[last:])
+	return sb.String(), true
+}
+
+// jsonValueEnd 返回从 start 开始的 JSON 值的结束位置，值被截断时返回文本末尾。
+func jsonValueEnd(text string, start int) int {
+	if start >= len(text) {
+		return start
+	}
+	switch text[start] {
+	case '"':
+		for i := start + 1; i < len(text); i++ {
+			switch text[i] {
+			case '\\':
+				i++
+			case '"':
+				return i + 1
+			}
+		}
+	case '{', '[':
+		depth, inString := 0, false
+		for i := start; i < len(text); i++ {
+			c := text[i]
+			if inString {
+				if c == '\\' {
+					i++
+				} else if c == '"' {
+					inString = false
+				}
+				continue
+			}
+			switch c {
+			case '"':
+				inString = true
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+		}
+	default:
+		if idx := strings.IndexAny(text[start:], ",}] \t\r\n"); idx >= 0 {
+			return start + idx
+		}
+	}
+	return len(text)
+}
+
+func (r *Redactor) walkJSON(rule *compiledRedactionRule, node any, path []string) (any, bool) {
+	changed := false
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			childPath := append(path[:len(path):len(path)], key)
+			if rule.matchJSONPath(childPath) {
+				changed = true
+				if rule.Strategy == RedactionStrategyDrop {
+					delete(v, key)
+					continue
+				}
+				v[key] = r.replaceValue(rule, jsonScalarText(child))
+				continue
+			}
+			if out, ok := r.walkJSON(rule, child, childPath); ok {
+				v[key] = out
+				changed = true
+			}
+		}
+	case []any:
+		for idx, child := range v {
+			if out, ok := r.walkJSON(rule, child, path); ok {
+				v[idx] = out
+				changed = true
+			}
+		}
+	}
+	return node, changed
+}
+
+func (rule *compiledRedactionRule) matchJSONPath(path []string) bool {
+	for _, pattern := range rule.jsonPaths {
+		if len(pattern) == 1 {
+			if pattern[0] == "*" || strings.EqualFold(pattern[0], path[len(path)-1]) {
+				return true
+			}
+			continue
+		}
+		if len(pattern) != len(path) {
+			continue
+		}
+		matched := true
+		for i := range pattern {
+			if pattern[i] != "*" && !strings.EqualFold(pattern[i], path[i]) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonScalarText(v any) string {
+	switch val := v.(type) {
+	case string:
+		return val
+	case nil:
+		return ""
+	default:
+		b, _ := json.Marshal(val)
+		return string(b)
+	}
+}
+
+func containsFold(items []string, target string) bool {
+	for _, item := range items {
+		if strings.EqualFold(strings.TrimSpace(item), target) {
+			return true
+		}
+	}
+	return false
+}
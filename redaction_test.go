@@ -0,0 +1,130 @@
+package monitor_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/monitor"
+	"go.uber.org/zap"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := monitor.NewRedactor(monitor.RedactionConfig{
+		Rules: []monitor.RedactionRule{
+			{Name: "password", JSONPaths: []string{"password", "user.idNo"}, FormFields: []string{"password"}},
+			{Name: "token", Headers: []string{"Authorization"}, Strategy: "hash"},
+			{Name: "phone", Routes: []string{"/api/users/**"}, Regexes: []string{`1[3-9]\d{9}`}, Strategy: "drop"},
+		},
+	})
+	assert.NoError(t, err)
+
+	tr := monitor.TracingDetails{
+		Optionname: "/api/users/:id",
+		Uri:        "/api/users/1?password=abc&page=1",
+		Body:       []byte(`{"name":"a","password":"secret","user":{"idNo":"110101"},"items":[{"password":"x"}]}`),
+		Resp:       []byte(`token Bearer abcdefg issued for 13800138000`),
+	}
+	headers := http.Header{"Authorization": []string{"Bearer abcdefg"}}
+	r.Apply(&tr, headers)
+
+	body := map[string]any{}
+	assert.NoError(t, json.Unmarshal(tr.Body, &body))
+	assert.Equal(t, "******", body["password"])
+	assert.Equal(t, "******", body["user"].(map[string]any)["idNo"])
+	assert.Equal(t, "******", body["items"].([]any)[0].(map[string]any)["password"])
+	assert.Equal(t, "a", body["name"])
+
+	assert.Equal(t, "/api/users/1?password=******&page=1", tr.Uri)
+	assert.NotContains(t, string(tr.Resp), "abcdefg")
+	assert.True(t, strings.Contains(string(tr.Resp), "sha256:"))
+	assert.NotContains(t, string(tr.Resp), "13800138000")
+	assert.Equal(t, []string{"password", "token", "phone"}, tr.Redactions)
+
+	other := monitor.TracingDetails{Optionname: "/api/orders", Resp: []byte("13800138000")}
+	r.Apply(&other, nil)
+	assert.Equal(t, "13800138000", string(other.Resp))
+	assert.Empty(t, other.Redactions)
+}
+
+func TestRedactorTruncatedJSON(t *testing.T) {
+	r, err := monitor.NewRedactor(monitor.RedactionConfig{
+		Rules: []monitor.RedactionRule{
+			{Name: "secret", JSONPaths: []string{"password", "user.credential"}, Regexes: []string{`1[3-9]\d{9}`}},
+		},
+	})
+	assert.NoError(t, err)
+
+	// 采集上限在 password 的值中间截断，JSON 无法解析。
+	tr := monitor.TracingDetails{
+		Body: []byte(`{"name":"a","user":{"credential":{"k":"v"}},"phone":"13800138000","password":"sec`),
+	}
+	r.Apply(&tr, nil)
+	body := string(tr.Body)
+	assert.NotContains(t, body, `"sec`)
+	assert.NotContains(t, body, `"v"`)
+	assert.NotContains(t, body, "13800138000")
+	assert.Contains(t, body, `"name":"a"`)
+	assert.Contains(t, body, `"password":"******"`)
+	assert.Contains(t, body, `"credential":"******"`)
+	assert.Equal(t, []string{"secret"}, tr.Redactions)
+
+	// 末级为 * 时无法按名称定位，整体替换。
+	wildcard, err := monitor.NewRedactor(monitor.RedactionConfig{
+		Rules: []monitor.RedactionRule{{Name: "all", JSONPaths: []string{"user.*"}}},
+	})
+	assert.NoError(t, err)
+	tr = monitor.TracingDetails{Body: []byte(`{"user":{"idNo":"1101`)}
+	wildcard.Apply(&tr, nil)
+	assert.Equal(t, "******", string(tr.Body))
+}
+
+func TestRedactorBodyCutMidRune(t *testing.T) {
+	r, err := monitor.NewRedactor(monitor.RedactionConfig{
+		Rules: []monitor.RedactionRule{
+			{Name: "password", JSONPaths: []string{"password"}, FormFields: []string{"password"}},
+		},
+	})
+	assert.NoError(t, err)
+
+	full := `{"password":"secret","name":"张三"}`
+	// 截断在“三”的第二个字节处。
+	cut := []byte(full)[:len(full)-3]
+	tr := monitor.TracingDetails{Body: cut}
+	r.Apply(&tr, nil)
+	assert.NotContains(t, string(tr.Body), "secret")
+	assert.Contains(t, string(tr.Body), `"name":"张`)
+	assert.Equal(t, []string{"password"}, tr.Redactions)
+
+	form := []byte("password=secret&name=张三")
+	tr = monitor.TracingDetails{Body: form[:len(form)-1]}
+	r.Apply(&tr, nil)
+	assert.Equal(t, "password=******&name=张", string(tr.Body))
+
+	// 非 UTF-8 的二进制正文不处理。
+	binary := []byte{0xff, 0xfe, 'p', 'a', 's', 's'}
+	tr = monitor.TracingDetails{Body: binary}
+	r.Apply(&tr, nil)
+	assert.Equal(t, binary, tr.Body)
+	assert.Empty(t, tr.Redactions)
+}
+
+func TestRedactorInvalidRule(t *testing.T) {
+	_, err := monitor.NewRedactor(monitor.RedactionConfig{Rules: []monitor.RedactionRule{{Regexes: []string{"("}}}})
+	assert.Error(t, err)
+	_, err = monitor.NewRedactor(monitor.RedactionConfig{Rules: []monitor.RedactionRule{{Strategy: "encrypt"}}})
+	assert.Error(t, err)
+}
+
+func TestInitTracingServiceRejectsInvalidRedaction(t *testing.T) {
+	viper.Set("tracing.request", true)
+	viper.Set("tracing.redaction.rules", []map[string]any{{"name": "bad", "regexes": []string{"("}}})
+	defer viper.Reset()
+
+	sr, err := monitor.InitTracingService(zap.NewNop())
+	assert.Error(t, err)
+	assert.Nil(t, sr)
+}
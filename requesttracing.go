@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/carlmjohnson/requests"
@@ -14,6 +15,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// outboundService 对外请求使用的 tracing 配置（采集策略等），由 InitTracingService 设置；为 nil 时使用默认策略。
+var outboundService *TracingRequestService
+
 func Log(operationname string) http.RoundTripper {
 	return LogTracying(TracingDetails{
 		Optionname:     operationname,
@@ -23,12 +27,13 @@ func Log(operationname string) http.RoundTripper {
 	}, nil)
 }
 
-func LogTracying(fullLogging TracingDetails, rt http.RoundTripper) http.RoundTripper {
+func LogTracying(template TracingDetails, rt http.RoundTripper) http.RoundTripper {
 	if rt == nil {
 		rt = http.DefaultTransport
 	}
 	return requests.RoundTripFunc(func(req *http.Request) (res *http.Response, err error) {
 		start := time.Now()
+		fullLogging := template
 		// fullLogging := TracingDetails{
 		// 	Method:    req.Method,
 		// 	UserAgent: req.UserAgent(),
@@ -50,13 +55,20 @@ func LogTracying(fullLogging TracingDetails, rt http.RoundTripper) http.RoundTri
 		}
 		logger := zap.L().With(zap.String("Optionname", fullLogging.Optionname))
 
+		tc := NewTraceContext()
+		if parent, ok := TraceFromContext(req.Context()); ok {
+			tc = parent.Child()
+		}
+		fullLogging.ApplyTrace(tc)
+		req = injectTraceHeaders(req, tc)
+
 		logger.Info("outbound request")
 		if req.Body != nil {
 			// reqcache := make([]byte, 1024)
 			reqcache, _ := io.ReadAll(req.Body)
 			req.Body = io.NopCloser(bytes.NewBuffer(reqcache))
-			reqbody := reqcache
 			ct := req.Header.Get("Content-Type")
+			reqbody := summarizePayload(outboundService.CaptureModeFor(ct), ct, reqcache)
 			if req.Method == "POST" && ct == "application/x-www-form-urlencoded" {
 				decoded, decodeErr := url.QueryUnescape(string(reqcache))
 				if decodeErr == nil {
@@ -64,6 +76,7 @@ func LogTracying(fullLogging TracingDetails, rt http.RoundTripper) http.RoundTri
 				}
 			}
 			fullLogging.Body = reqbody
+			fullLogging.BodySize = int64(len(reqcache))
 			fullLogging.BodyEnc = DetectPayloadEncoding(reqbody)
 		}
 
@@ -82,33 +95,98 @@ func LogTracying(fullLogging TracingDetails, rt http.RoundTripper) http.RoundTri
 			})
 			logger.Error("outbound request error", zap.Error(wrapError))
 		} else {
-			respdetails, err := DumpRespBody(res)
-			if err == nil && len(respdetails) > 0 {
-				fullLogging.Resp = respdetails
-				fullLogging.RespEnc = DetectPayloadEncoding(respdetails)
-			}
-			if err != nil || res.StatusCode >= 400 {
-				rr := core.ErrorReport{
-					Error:     err,
-					Uri:       fullLogging.Uri,
-					FullStack: respdetails,
-					HappendAT: time.Now(),
+			fullLogging.Status = res.StatusCode
+			logger.Info("outbound request done", zap.Int("status", res.StatusCode), zap.Duration("duration", dur))
+			if res.Body != nil && res.Body != http.NoBody && res.ContentLength != 0 {
+				// 响应体在调用方读取时旁路采集，读完或关闭后再推送，避免为记录日志缓存整个响应。
+				respct := res.Header.Get("Content-Type")
+				mode := outboundService.CaptureModeFor(respct)
+				limit := 0
+				if outboundService != nil {
+					limit = outboundService.MaxResponseBytes
 				}
-				if rr.Error == nil {
-					rr.Error = fmt.Errorf("res unexpected status code %d", res.StatusCode)
+				headers := req.Header
+				res.Body = &tracingRespBody{
+					teeReadCloser: teeReadCloser{
+						ReadCloser: res.Body,
+						capture:    newPolicyCapture(mode, resolveCaptureLimit(limit)),
+					},
+					done: func(capture *captureBuffer) {
+						fullLogging.Resp = summarizeCapture(mode, respct, capture, nil)
+						fullLogging.RespEnc = DetectPayloadEncoding(fullLogging.Resp)
+						fullLogging.RespSize = capture.Size()
+						fullLogging.RespTruncated = capture.Truncated()
+						finishOutbound(&fullLogging, headers)
+					},
 				}
-				core.ErrorAdaptor.Push(rr)
+				return
 			}
-			fullLogging.Status = res.StatusCode
-			logger.Info("outbound request done", zap.Int("status", res.StatusCode), zap.Duration("duration", dur))
 		}
 
 		// core.Bus.Publish(core.EventTracing, fullLogging)
-		TracingAdaptor.Push(fullLogging)
+		finishOutbound(&fullLogging, req.Header)
 		return
 	})
 }
 
+// finishOutbound 推送对外请求详情；4xx/5xx 时同时上报 ErrorReport，FullStack 为采集并脱敏后的响应。
+func finishOutbound(details *TracingDetails, headers map[string][]string) {
+	if details.Status >= 400 {
+		// ErrorReport 不经过 pushTracing，单独按同一规则脱敏响应与 Uri。
+		redacted := *details
+		redacted.Body = nil
+		DefaultRedactor.Apply(&redacted, headers)
+		core.ErrorAdaptor.Push(core.ErrorReport{
+			Error:     fmt.Errorf("res unexpected status code %d", details.Status),
+			Uri:       redacted.Uri,
+			FullStack: redacted.Resp,
+			HappendAT: time.Now(),
+		})
+	}
+	pushTracing(outboundService, details, headers)
+}
+
+// tracingRespBody 旁路采集对外请求的响应体，在读到 EOF 或关闭时回调一次 done。
+type tracingRespBody struct {
+	teeReadCloser
+	once sync.Once
+	done func(capture *captureBuffer)
+}
+
+func (b *tracingRespBody) Read(p []byte) (int, error) {
+	n, err := b.teeReadCloser.Read(p)
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *tracingRespBody) Close() error {
+	err := b.teeReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *tracingRespBody) finish() {
+	b.once.Do(func() {
+		if !b.eof {
+			// 调用方未读完就关闭，未读部分视为截断。
+			b.capture.partial = true
+		}
+		b.done(b.capture)
+	})
+}
+
+// injectTraceHeaders 复制请求并写入 traceparent/tracestate，RoundTripper 不应修改调用方的请求。
+func injectTraceHeaders(req *http.Request, tc TraceContext) *http.Request {
+	out := req.Clone(req.Context())
+	out.Header.Set(HeaderTraceparent, tc.Traceparent())
+	if tc.TraceState != "" {
+		out.Header.Set(HeaderTracestate, tc.TraceState)
+	}
+	return out
+}
+
 func LogOutbound(rt http.RoundTripper) http.RoundTripper {
 	return LogTracying(TracingDetails{
 		AppName:        core.AppName,
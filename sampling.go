@@ -0,0 +1,156 @@
+package monitor
+
+import (
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+const (
+	SampledByHead  = "head"
+	SampledByError = "error"
+	SampledBySlow  = "slow"
+	SampledByWrite = "write"
+)
+
+// SamplingRoute 针对路由（Optionname）的采样设置，Pattern 含 * 时按 doublestar 匹配，否则按前缀匹配。
+// Rate 为 nil 时沿用全局采样率；SlowThreshold 覆盖全局慢请求阈值。
+type SamplingRoute struct {
+	Pattern       string
+	Rate          *float64
+	SlowThreshold time.Duration
+}
+
+// SamplingConfig 头部采样与尾部采样配置。
+// 头部采样率优先级：Routes > Methods > Levels > Rate。
+// 尾部采样：KeepErrors 保留 status >= 500 及未收到响应（status 为 0）的对外请求，KeepWrites 保留写操作，慢于阈值的请求始终保留。
+type SamplingConfig struct {
+	Enabled       bool
+	Rate          float64
+	Methods       map[string]float64
+	Levels        map[string]float64
+	Routes        []SamplingRoute
+	KeepErrors    bool
+	KeepWrites    bool
+	SlowThreshold time.Duration
+}
+
+// DefaultSamplingConfig 默认全量保留，启用后未配置的项保持该默认值。
+func DefaultSamplingConfig() SamplingConfig {
+	return SamplingConfig{
+		Rate:       1,
+		KeepErrors: true,
+		KeepWrites: true,
+	}
+}
+
+func (s *SamplingConfig) matchRoute(tr *TracingDetails) *SamplingRoute {
+	for i := range s.Routes {
+		route := &s.Routes[i]
+		if route.Pattern == "" {
+			continue
+		}
+		if strings.Contains(route.Pattern, "*") {
+			if matched, _ := doublestar.Match(route.Pattern, tr.Optionname); matched {
+				return route
+			}
+		} else if strings.HasPrefix(tr.Optionname, route.Pattern) {
+			return route
+		}
+	}
+	return nil
+}
+
+// headRate 计算头部采样率。
+func (s *SamplingConfig) headRate(tr *TracingDetails, route *SamplingRoute) float64 {
+	if route != nil && route.Rate != nil {
+		return clampRate(*route.Rate)
+	}
+	for method, rate := range s.Methods {
+		if strings.EqualFold(method, tr.Method) {
+			return clampRate(rate)
+		}
+	}
+	if rate, ok := s.Levels[strconv.Itoa(int(tr.VerbosityLevel))]; ok {
+		return clampRate(rate)
+	}
+	return clampRate(s.Rate)
+}
+
+// tailReason 判断是否命中尾部采样规则。
+func (s *SamplingConfig) tailReason(tr *TracingDetails, route *SamplingRoute) string {
+	// Status 为 0 表示对外请求未收到响应（连接失败、超时等），同样视为错误。
+	if s.KeepErrors && (tr.Status >= 500 || tr.Status == 0) {
+		return SampledByError
+	}
+	threshold := s.SlowThreshold
+	if route != nil && route.SlowThreshold > 0 {
+		threshold = route.SlowThreshold
+	}
+	if threshold > 0 && tr.Durtion >= threshold {
+		return SampledBySlow
+	}
+	if s.KeepWrites && isWriteLevel(tr.VerbosityLevel) {
+		return SampledByWrite
+	}
+	return ""
+}
+
+// isWriteLevel 判断是否为写操作；ThirdParty 虽小于 Write，但只代表对外调用，不属于写操作。
+func isWriteLevel(level TracingVerbosityLevel) bool {
+	return level == TracingVerbosityLevelWrite || level == TracingVerbosityLevelMostImportant
+}
+
+// Decide 对请求做采样决策，并把采样率与原因写入 tr.SampleRate/tr.SampledBy。
+// 尾部规则命中时视为全量保留（SampleRate=1），否则按 TraceID 做确定性头部采样，保证同一链路在各服务中决策一致。
+// 返回值：true 表示保留。
+func (s *SamplingConfig) Decide(tr *TracingDetails) bool {
+	if s == nil || !s.Enabled {
+		tr.SampleRate = 1
+		return true
+	}
+	route := s.matchRoute(tr)
+	if reason := s.tailReason(tr, route); reason != "" {
+		tr.SampleRate = 1
+		tr.SampledBy = reason
+		return true
+	}
+	rate := s.headRate(tr, route)
+	if !sampleByTraceID(tr.TraceID, rate) {
+		return false
+	}
+	tr.SampleRate = rate
+	tr.SampledBy = SampledByHead
+	return true
+}
+
+func clampRate(rate float64) float64 {
+	if rate < 0 || math.IsNaN(rate) {
+		return 0
+	}
+	if rate > 1 {
+		return 1
+	}
+	return rate
+}
+
+// sampleByTraceID 取 TraceID 低 64 位与采样率比较；TraceID 缺失时随机采样。
+func sampleByTraceID(traceID string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	v := rand.Uint64()
+	if len(traceID) == 32 {
+		if parsed, err := strconv.ParseUint(traceID[16:], 16, 64); err == nil {
+			v = parsed
+		}
+	}
+	return v>>1 < uint64(rate*float64(uint64(1)<<63))
+}
@@ -0,0 +1,101 @@
+package monitor_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/monitor"
+)
+
+func TestSamplingDecide(t *testing.T) {
+	zero := 0.0
+	s := monitor.DefaultSamplingConfig()
+	s.Enabled = true
+	s.Rate = 0.5
+	s.SlowThreshold = time.Second
+	s.Routes = []monitor.SamplingRoute{
+		{Pattern: "/api/health", Rate: &zero},
+		{Pattern: "/api/reports/**", SlowThreshold: 5 * time.Second},
+	}
+
+	read := func(optionname string, status int, dur time.Duration) *monitor.TracingDetails {
+		return &monitor.TracingDetails{
+			Optionname:     optionname,
+			Method:         "GET",
+			VerbosityLevel: monitor.TracingVerbosityLevelRead,
+			Status:         status,
+			Durtion:        dur,
+			TraceID:        monitor.NewTraceContext().TraceID,
+		}
+	}
+
+	health := read("/api/health", 200, 0)
+	assert.False(t, s.Decide(health))
+
+	failed := read("/api/health", 503, 0)
+	assert.True(t, s.Decide(failed))
+	assert.Equal(t, monitor.SampledByError, failed.SampledBy)
+	assert.Equal(t, 1.0, failed.SampleRate)
+
+	slow := read("/api/orders", 200, 2*time.Second)
+	assert.True(t, s.Decide(slow))
+	assert.Equal(t, monitor.SampledBySlow, slow.SampledBy)
+
+	// 低 64 位为 0 的 TraceID 在 0.5 采样率下必然保留，全为 f 时必然丢弃。
+	const headKept = "0123456789abcdef0000000000000000"
+	const headDropped = "0123456789abcdefffffffffffffffff"
+
+	// 路由阈值 5s 覆盖全局 1s：2s 的报表请求不算慢，只按头部采样决定。
+	report := read("/api/reports/daily", 200, 2*time.Second)
+	report.TraceID = headDropped
+	assert.False(t, s.Decide(report))
+	report = read("/api/reports/daily", 200, 2*time.Second)
+	report.TraceID = headKept
+	assert.True(t, s.Decide(report))
+	assert.Equal(t, monitor.SampledByHead, report.SampledBy)
+	assert.Equal(t, 0.5, report.SampleRate)
+
+	slowReport := read("/api/reports/daily", 200, 6*time.Second)
+	slowReport.TraceID = headDropped
+	assert.True(t, s.Decide(slowReport))
+	assert.Equal(t, monitor.SampledBySlow, slowReport.SampledBy)
+	assert.Equal(t, 1.0, slowReport.SampleRate)
+
+	write := read("/api/health", 200, 0)
+	write.VerbosityLevel = monitor.TracingVerbosityLevelWrite
+	assert.True(t, s.Decide(write))
+	assert.Equal(t, monitor.SampledByWrite, write.SampledBy)
+
+	// 对外调用不是写操作，走头部采样。
+	outbound := read("/api/health", 200, 0)
+	outbound.VerbosityLevel = monitor.TracingVerbosityLevelThirdParty
+	assert.False(t, s.Decide(outbound))
+
+	// 对外请求未收到响应（Status 为 0）视为错误。
+	transport := read("/api/health", 0, 0)
+	transport.VerbosityLevel = monitor.TracingVerbosityLevelThirdParty
+	assert.True(t, s.Decide(transport))
+	assert.Equal(t, monitor.SampledByError, transport.SampledBy)
+
+	kept := 0
+	for i := 0; i < 10000; i++ {
+		if s.Decide(read("/api/orders", 200, 0)) {
+			kept++
+		}
+	}
+	assert.InDelta(t, 5000, kept, 500)
+
+	same := read("/api/orders", 200, 0)
+	first := s.Decide(same)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, s.Decide(same))
+	}
+}
+
+func TestSamplingDisabled(t *testing.T) {
+	s := monitor.DefaultSamplingConfig()
+	tr := &monitor.TracingDetails{Optionname: "/api/orders"}
+	assert.True(t, s.Decide(tr))
+	assert.Equal(t, 1.0, tr.SampleRate)
+}
@@ -0,0 +1,151 @@
+package monitor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	HeaderTraceparent = "traceparent"
+	HeaderTracestate  = "tracestate"
+	HeaderRequestID   = "X-Request-ID"
+
+	// KeyTraceContext gin 上下文中保存 TraceContext 的键。
+	KeyTraceContext = "traceContext"
+
+	traceparentVersion = "00"
+	traceFlagSampled   = 0x01
+)
+
+type traceContextKey struct{}
+
+// TraceContext W3C Trace Context 中的链路标识。
+// TraceID/SpanID/ParentSpanID 均为小写十六进制字符串。
+type TraceContext struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Flags        byte
+	TraceState   string
+}
+
+// Sampled 返回 traceparent 中的 sampled 标记。
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&traceFlagSampled != 0
+}
+
+// IsValid 判断链路标识是否完整可用。
+func (tc TraceContext) IsValid() bool {
+	return isValidHexID(tc.TraceID, 32) && isValidHexID(tc.SpanID, 16)
+}
+
+// Traceparent 生成 W3C traceparent 头部值。
+func (tc TraceContext) Traceparent() string {
+	return traceparentVersion + "-" + tc.TraceID + "-" + tc.SpanID + "-" + hex.EncodeToString([]byte{tc.Flags})
+}
+
+// Child 基于当前上下文生成子 span，TraceID 与 TraceState 保持不变。
+func (tc TraceContext) Child() TraceContext {
+	return TraceContext{
+		TraceID:      tc.TraceID,
+		SpanID:       newSpanID(),
+		ParentSpanID: tc.SpanID,
+		Flags:        tc.Flags,
+		TraceState:   tc.TraceState,
+	}
+}
+
+// NewTraceContext 创建新的根链路。
+func NewTraceContext() TraceContext {
+	return TraceContext{
+		TraceID: newTraceID(),
+		SpanID:  newSpanID(),
+		Flags:   traceFlagSampled,
+	}
+}
+
+// ParseTraceparent 解析 W3C traceparent 头部。
+// traceparent: 头部值，如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01。
+// tracestate: 原样透传的 tracestate 头部值。
+// 返回值：解析结果；格式非法或 ID 全零时 ok 为 false。
+func ParseTraceparent(traceparent string, tracestate string) (tc TraceContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 {
+		return TraceContext{}, false
+	}
+	version, traceID, spanID, flags := strings.ToLower(parts[0]), strings.ToLower(parts[1]), strings.ToLower(parts[2]), strings.ToLower(parts[3])
+	if len(version) != 2 || version == "ff" || !isHex(version) {
+		return TraceContext{}, false
+	}
+	// 版本 00 只允许 4 段，更高版本允许追加字段。
+	if version == traceparentVersion && len(parts) != 4 {
+		return TraceContext{}, false
+	}
+	if !isValidHexID(traceID, 32) || !isValidHexID(spanID, 16) || len(flags) != 2 || !isHex(flags) {
+		return TraceContext{}, false
+	}
+	rawFlags, _ := hex.DecodeString(flags)
+	return TraceContext{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		Flags:      rawFlags[0],
+		TraceState: strings.TrimSpace(tracestate),
+	}, true
+}
+
+// ContextWithTrace 将链路标识写入 context。
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceFromContext 从 context 读取链路标识。
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	if ctx == nil {
+		return TraceContext{}, false
+	}
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok && tc.IsValid()
+}
+
+// ApplyTrace 将链路标识写入 tracing 详情。
+func (tr *TracingDetails) ApplyTrace(tc TraceContext) {
+	tr.TraceID = tc.TraceID
+	tr.SpanID = tc.SpanID
+	tr.ParentSpanID = tc.ParentSpanID
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9') && !(c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// isValidHexID 校验 ID 长度与字符集，W3C 规定全零 ID 无效。
+func isValidHexID(id string, size int) bool {
+	if len(id) != size || !isHex(id) {
+		return false
+	}
+	return strings.Trim(id, "0") != ""
+}
+
+func newHexID(size int) string {
+	b := make([]byte, size)
+	for {
+		_, _ = rand.Read(b)
+		for _, v := range b {
+			if v != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+func newTraceID() string { return newHexID(16) }
+
+func newSpanID() string { return newHexID(8) }
@@ -0,0 +1,62 @@
+package monitor_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/techquest-tech/monitor"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tc, ok := monitor.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "congo=t61rcWkgMzE")
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceID)
+	assert.Equal(t, "00f067aa0ba902b7", tc.SpanID)
+	assert.True(t, tc.Sampled())
+	assert.Equal(t, "congo=t61rcWkgMzE", tc.TraceState)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", tc.Traceparent())
+
+	child := tc.Child()
+	assert.Equal(t, tc.TraceID, child.TraceID)
+	assert.Equal(t, tc.SpanID, child.ParentSpanID)
+	assert.NotEqual(t, tc.SpanID, child.SpanID)
+
+	for _, invalid := range []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		_, ok := monitor.ParseTraceparent(invalid, "")
+		assert.False(t, ok, invalid)
+	}
+}
+
+func TestOutboundTraceparent(t *testing.T) {
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(monitor.HeaderTraceparent)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	parent := monitor.NewTraceContext()
+	ctx := monitor.ContextWithTrace(context.Background(), parent)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+
+	client := &http.Client{Transport: monitor.LogOutbound(nil)}
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	sent, ok := monitor.ParseTraceparent(received, "")
+	assert.True(t, ok)
+	assert.Equal(t, parent.TraceID, sent.TraceID)
+	assert.NotEqual(t, parent.SpanID, sent.SpanID)
+	assert.Empty(t, req.Header.Get(monitor.HeaderTraceparent))
+}
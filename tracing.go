@@ -1,7 +1,6 @@
 package monitor
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"strings"
@@ -41,6 +40,18 @@ type TracingDetails struct {
 	Tenant         string
 	Operator       string
 	StartedAt      time.Time
+	TraceID        string
+	SpanID         string
+	ParentSpanID   string
+	ReqMessages    int
+	RespMessages   int
+	Redactions     []string
+	BodySize       int64
+	BodyTruncated  bool
+	RespSize       int64
+	RespTruncated  bool
+	SampleRate     float64
+	SampledBy      string
 	// Props     map[string]interface{}
 }
 
@@ -92,14 +103,50 @@ func EncodePayloadForText(payload []byte) (string, string) {
 	}
 }
 
+// DecodePayloadText 是 EncodePayloadForText 的逆操作。
+// text: 文本化后的内容。
+// encoding: 编码方式，utf8/base64/empty。
+// 返回值：原始字节；未知编码按 utf8 处理。
+func DecodePayloadText(text string, encoding string) ([]byte, error) {
+	switch encoding {
+	case PayloadEncodingEmpty:
+		return nil, nil
+	case PayloadEncodingBase64:
+		return base64.StdEncoding.DecodeString(text)
+	default:
+		return []byte(text), nil
+	}
+}
+
 type RespLogging struct {
 	gin.ResponseWriter
-	cache *bytes.Buffer
+	cache       *captureBuffer
+	service     *TracingRequestService
+	limit       int
+	mode        string
+	contentType string
 }
 
-func (w RespLogging) Write(b []byte) (int, error) {
-	w.cache.Write(b)
-	return w.ResponseWriter.Write(b)
+// capture 首次写出时按响应 Content-Type 确定采集方式。
+func (w *RespLogging) capture() *captureBuffer {
+	if w.cache == nil {
+		w.contentType = w.Header().Get("Content-Type")
+		w.mode = w.service.CaptureModeFor(w.contentType)
+		w.cache = newPolicyCapture(w.mode, w.limit)
+	}
+	return w.cache
+}
+
+func (w *RespLogging) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.capture().Write(b[:n])
+	return n, err
+}
+
+func (w *RespLogging) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.capture().Write([]byte(s[:n]))
+	return n, err
 }
 
 type TracingRequestService struct {
@@ -110,6 +157,11 @@ type TracingRequestService struct {
 	Included               []string
 	Excluded               []string
 	VerbosityLevelByMethod map[string]TracingVerbosityLevel
+	Redaction              RedactionConfig
+	MaxRequestBytes        int
+	MaxResponseBytes       int
+	CapturePolicies        []CapturePolicy
+	Sampling               SamplingConfig
 }
 
 func (tr *TracingRequestService) ShouldLogReq(ctx context.Context, uri string) bool {
@@ -194,38 +246,91 @@ func VerbosityLevelByGRPCMethod(fullMethod string) TracingVerbosityLevel {
 	}
 }
 
+// Sample 对 tracing 详情执行采样决策，tr 为 nil 时全部保留。
+func (tr *TracingRequestService) Sample(details *TracingDetails) bool {
+	if tr == nil {
+		details.SampleRate = 1
+		return true
+	}
+	return tr.Sampling.Decide(details)
+}
+
+// pushTracing 依次执行采样与脱敏，最后推送给各后端。
+// sr: tracing 配置，可为 nil。
+// details: 待推送的 tracing 详情。
+// headers: 请求头或 gRPC metadata，用于脱敏。
+func pushTracing(sr *TracingRequestService, details *TracingDetails, headers map[string][]string) {
+	pushTracingTo(sr, details, headers, TracingAdaptor.Push)
+}
+
+// pushTracingTo 同 pushTracing，push 为采样、脱敏后的推送目标。
+func pushTracingTo(sr *TracingRequestService, details *TracingDetails, headers map[string][]string, push func(TracingDetails)) {
+	if !sr.Sample(details) {
+		return
+	}
+	DefaultRedactor.Apply(details, headers)
+	push(*details)
+}
+
+// PushTracing 供其它包的采集点（如 mqtt）复用采样、脱敏与推送流程。
+func PushTracing(sr *TracingRequestService, details *TracingDetails, headers map[string][]string) {
+	pushTracing(sr, details, headers)
+}
+
 // func (tr *TracingRequestService) LogRequest(ctx context.Context, req *TracingDetails) error {
 // 	// tr.Bus.Publish(core.EventTracing, req)
 // 	TracingAdaptor.Push(req)
 // 	return nil
 // }
 
-var InitTracingService = func(logger *zap.Logger) *TracingRequestService {
+// InitTracingService 从 tracing 读取配置初始化 tracing 服务。
+// 返回值：脱敏规则非法时返回错误，避免在未脱敏的情况下采集正文。
+var InitTracingService = func(logger *zap.Logger) (*TracingRequestService, error) {
 	sr := &TracingRequestService{
-		Log: logger,
+		Log:      logger,
+		Sampling: DefaultSamplingConfig(),
 	}
 
 	settings := viper.Sub("tracing")
 	if settings == nil {
 		logger.Warn("tracing module loaded, but disabled.")
-		return sr
+		return sr, nil
 	}
 	// if settings != nil {
 	settings.Unmarshal(sr)
 	// }
 	logger.Info("tracing service is enabled.")
+	outboundService = sr
+	if sr.Sampling.Enabled {
+		logger.Info("tracing sampling enabled.",
+			zap.Float64("rate", sr.Sampling.Rate),
+			zap.Bool("keepErrors", sr.Sampling.KeepErrors),
+			zap.Bool("keepWrites", sr.Sampling.KeepWrites),
+			zap.Duration("slowThreshold", sr.Sampling.SlowThreshold),
+		)
+	}
+	if len(sr.Redaction.Rules) > 0 {
+		redactor, err := NewRedactor(sr.Redaction)
+		if err != nil {
+			logger.Error("invalid tracing redaction config.", zap.Error(err))
+			return nil, err
+		}
+		DefaultRedactor = redactor
+		logger.Info("tracing redaction enabled.", zap.Int("rules", len(sr.Redaction.Rules)))
+	}
 	if (sr.Request || sr.Resp) && sr.Console {
 		c := InitConsoleTracingService(sr.Log)
 		TracingAdaptor.Subscripter("console", c.LogBody)
 	}
 
-	return sr
+	return sr, nil
 }
 
 var TracingAdaptor = core.NewChanAdaptor[TracingDetails](10000)
 
 func init() {
 	core.Provide(InitTracingService)
+	core.Provide(NewGrpcTracingService)
 	ginshared.Provide(func(sr *TracingRequestService) ginshared.Component {
 		zap.L().Info("tracing service for GIN loaded.")
 		comp := &GinTracingService{Service: sr}